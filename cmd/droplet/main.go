@@ -2,22 +2,21 @@ package main
 
 import (
 	"droplet/internal/command"
-	"droplet/internal/logs"
+	"droplet/internal/container"
+	"errors"
 	"log"
 	"os"
 )
 
 func main() {
-	// init logger
-	if err := logs.InitAuditLogger(); err != nil {
-		log.Fatalf("audit logger init failed: %v", err)
-	}
-	defer logs.AuditLogger.Close()
-	logs.StartAuditLogTrimmer()
-
 	app := command.NewApp()
 
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		// the exit status of a container process is passed through as is
+		var exitErr *container.ExitStatusError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Status)
+		}
+		log.Fatalf("error: %v", err)
 	}
 }
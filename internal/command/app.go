@@ -1,6 +1,10 @@
 package command
 
 import (
+	"droplet/internal/logs"
+	"droplet/internal/utils"
+	"fmt"
+
 	"github.com/urfave/cli/v2"
 )
 
@@ -8,6 +12,49 @@ func NewApp() *cli.App {
 	app := &cli.App{
 		Name:  "droplet",
 		Usage: "low-level container runtime",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "root",
+				Usage: "root directory for storage of container state",
+			},
+			&cli.StringFlag{
+				Name:  "log",
+				Usage: "set the log file to write runtime logs to",
+			},
+			&cli.StringFlag{
+				Name:  "log-format",
+				Usage: "set the log format [text|json]",
+				Value: "text",
+			},
+		},
+		Before: func(ctx *cli.Context) error {
+			// runtime log
+			if err := logs.SetupRuntimeLog(ctx.String("log"), ctx.String("log-format")); err != nil {
+				return err
+			}
+			// state root directory
+			if root := ctx.String("root"); root != "" {
+				if err := utils.SetRootDir(root); err != nil {
+					return err
+				}
+			}
+			// audit logger
+			// host diagnostics must work before /etc/raind is set up
+			if isDiagnosticCommand(ctx.Args().First()) {
+				return nil
+			}
+			if err := logs.InitAuditLogger(); err != nil {
+				return fmt.Errorf("audit logger init failed: %w", err)
+			}
+			logs.StartAuditLogTrimmer()
+			return nil
+		},
+		After: func(ctx *cli.Context) error {
+			if logs.AuditLogger != nil {
+				return logs.AuditLogger.Close()
+			}
+			return nil
+		},
 		Commands: []*cli.Command{
 			commandCreate(),
 			commandStart(),
@@ -22,6 +69,13 @@ func NewApp() *cli.App {
 			commandInit(),
 			commandShim(),
 			commandAttach(),
+			commandFeatures(),
+			commandCheck(),
+			commandHookExec(),
+			commandHooks(),
+			commandLogs(),
+			commandWait(),
+			commandPrune(),
 		},
 	}
 
@@ -30,3 +84,13 @@ func NewApp() *cli.App {
 
 	return app
 }
+
+// isDiagnosticCommand reports whether the command only inspects the host
+// and therefore does not need the audit logger.
+func isDiagnosticCommand(name string) bool {
+	switch name {
+	case "check", "features", "hook-exec":
+		return true
+	}
+	return false
+}
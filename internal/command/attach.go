@@ -2,6 +2,7 @@ package command
 
 import (
 	"droplet/internal/container"
+	"fmt"
 
 	"github.com/urfave/cli/v2"
 )
@@ -11,18 +12,58 @@ func commandAttach() *cli.Command {
 		Name:      "attach",
 		Usage:     "attach to container",
 		ArgsUsage: "<container-id>",
-		Action:    runAttach,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "read-only",
+				Usage: "view the output only; input and resize are not sent to the container",
+			},
+			&cli.Int64Flag{
+				Name:  "replay",
+				Usage: "replay the last N bytes of output before attaching",
+			},
+			&cli.BoolFlag{
+				Name:  "since-start",
+				Usage: "replay all output still held by the shim before attaching",
+			},
+			&cli.StringFlag{
+				Name:  "detach-keys",
+				Usage: "key sequence to detach without stopping the container (empty to disable)",
+				Value: container.DefaultDetachKeys,
+			},
+			&cli.BoolFlag{
+				Name:  "sig-proxy",
+				Usage: "forward received signals to the container process",
+				Value: true,
+			},
+		},
+		Action: runAttach,
 	}
 }
 
 func runAttach(ctx *cli.Context) error {
 	// retrieve container ID
 	containerId := ctx.Args().Get(0)
+	readOnly := ctx.Bool("read-only")
+	replay := ctx.Int64("replay")
+	sinceStart := ctx.Bool("since-start")
+	detachKeys := ctx.String("detach-keys")
+	sigProxy := ctx.Bool("sig-proxy")
+	if replay != 0 && sinceStart {
+		return fmt.Errorf("--replay and --since-start are mutually exclusive")
+	}
+	if replay < 0 {
+		return fmt.Errorf("--replay must not be negative")
+	}
 
 	// start container
 	containerAttach := container.NewContainerAttach()
 	err := containerAttach.Execute(container.AttachOption{
 		ContainerId: containerId,
+		ReadOnly:    readOnly,
+		Replay:      replay,
+		SinceStart:  sinceStart,
+		DetachKeys:  detachKeys,
+		SigProxy:    sigProxy,
 	})
 	if err != nil {
 		return err
@@ -0,0 +1,72 @@
+package command
+
+import (
+	"droplet/internal/container"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandCheck() *cli.Command {
+	return &cli.Command{
+		Name:  "check",
+		Usage: "check the host environment",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "bridge",
+				Usage: "bridge interface name",
+				Value: "raind0",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "output format [table|json]",
+				Value: "table",
+			},
+		},
+		Action: runCheck,
+	}
+}
+
+func runCheck(ctx *cli.Context) error {
+	hostChecker := container.NewHostChecker()
+	results := hostChecker.Check(
+		container.CheckOption{
+			BridgeInterface: ctx.String("bridge"),
+		},
+	)
+
+	switch ctx.String("format") {
+	case "json":
+		dataStr, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(dataStr))
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, r := range results {
+			fmt.Fprintf(w, "[%s]\t%s\t%s\n", strings.ToUpper(r.Status), r.Name, r.Detail)
+			if r.Status != container.CheckPass && r.Hint != "" {
+				fmt.Fprintf(w, "\t\thint: %s\n", r.Hint)
+			}
+		}
+		w.Flush()
+	default:
+		return fmt.Errorf("unknown format: %s", ctx.String("format"))
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == container.CheckFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
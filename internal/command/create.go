@@ -2,6 +2,7 @@ package command
 
 import (
 	"droplet/internal/container"
+	"droplet/internal/utils"
 
 	"github.com/urfave/cli/v2"
 )
@@ -12,6 +13,11 @@ func commandCreate() *cli.Command {
 		Usage:     "create a container",
 		ArgsUsage: "<container-id>",
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "bundle",
+				Aliases: []string{"b"},
+				Usage:   "path to the root of the bundle directory (default: container state directory)",
+			},
 			&cli.BoolFlag{
 				Name:   "print-pid",
 				Hidden: true,
@@ -22,6 +28,31 @@ func commandCreate() *cli.Command {
 				Aliases: []string{"t"},
 				Value:   false,
 			},
+			&cli.StringFlag{
+				Name:  "pid-file",
+				Usage: "file to write the process id to",
+			},
+			&cli.StringFlag{
+				Name:  "console-socket",
+				Usage: "path to an AF_UNIX socket which will receive the pty master (requires --tty)",
+			},
+			&cli.IntFlag{
+				Name:  "preserve-fds",
+				Usage: "pass N additional file descriptors to the container (stdio + $LISTEN_FDS + N in total)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-pivot",
+				Usage: "do not use pivot_root to jail process inside rootfs",
+			},
+			&cli.BoolFlag{
+				Name:  "no-new-keyring",
+				Usage: "do not create a new session keyring for the container",
+			},
+			&cli.StringFlag{
+				Name:  "hooks-dir",
+				Usage: "directory of oci-hooks.d style hook definitions (empty to disable)",
+				Value: utils.HooksDir,
+			},
 		},
 		Action: runCreate,
 	}
@@ -30,15 +61,29 @@ func commandCreate() *cli.Command {
 func runCreate(ctx *cli.Context) error {
 	// retrieve container ID
 	containerId := ctx.Args().Get(0)
+	bundle := ctx.String("bundle")
 	pidPrintFlag := ctx.Bool("print-pid")
 	ttyFlag := ctx.Bool("tty")
+	pidFile := ctx.String("pid-file")
+	consoleSocket := ctx.String("console-socket")
+	preserveFds := ctx.Int("preserve-fds")
+	noPivot := ctx.Bool("no-pivot")
+	noNewKeyring := ctx.Bool("no-new-keyring")
+	hooksDir := ctx.String("hooks-dir")
 
 	containerCreator := container.NewContainerCreator()
 	err := containerCreator.Create(
 		container.CreateOption{
-			ContainerId:  containerId,
-			PrintPidFlag: pidPrintFlag,
-			TtyFlag:      ttyFlag,
+			ContainerId:   containerId,
+			Bundle:        bundle,
+			PrintPidFlag:  pidPrintFlag,
+			TtyFlag:       ttyFlag,
+			PidFile:       pidFile,
+			ConsoleSocket: consoleSocket,
+			PreserveFds:   preserveFds,
+			NoPivot:       noPivot,
+			NoNewKeyring:  noNewKeyring,
+			HooksDir:      hooksDir,
 		},
 	)
 
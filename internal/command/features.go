@@ -0,0 +1,30 @@
+package command
+
+import (
+	"droplet/internal/container"
+	"encoding/json"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandFeatures() *cli.Command {
+	return &cli.Command{
+		Name:   "features",
+		Usage:  "show the enabled features (features.json)",
+		Action: runFeatures,
+	}
+}
+
+func runFeatures(ctx *cli.Context) error {
+	containerFeatures := container.NewContainerFeatures()
+	features := containerFeatures.Features()
+
+	dataStr, err := json.MarshalIndent(features, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(dataStr))
+
+	return nil
+}
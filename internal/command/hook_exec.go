@@ -0,0 +1,22 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+// commandHookExec is the entry point used to run in-container hooks.
+//
+// The work is done by the nsexec constructor before the Go runtime starts,
+// so the action is only reached when the command is invoked directly.
+func commandHookExec() *cli.Command {
+	return &cli.Command{
+		Name:   "hook-exec",
+		Usage:  "run a hook inside a container (internal use only)",
+		Hidden: true,
+		Action: func(ctx *cli.Context) error {
+			return fmt.Errorf("hook-exec must be started by the runtime")
+		},
+	}
+}
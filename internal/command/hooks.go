@@ -0,0 +1,71 @@
+package command
+
+import (
+	"droplet/internal/hook"
+	"droplet/internal/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandHooks() *cli.Command {
+	return &cli.Command{
+		Name:      "hooks",
+		Usage:     "show the last run result of each hook of a container",
+		ArgsUsage: "<container-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "print format [default|json]",
+			},
+		},
+		Action: runHooks,
+	}
+}
+
+func runHooks(ctx *cli.Context) error {
+	// retrieve container id
+	containerId := ctx.Args().Get(0)
+	if containerId == "" {
+		return fmt.Errorf("container id is required")
+	}
+
+	// the results outlive state.json, so that the poststop hooks run by
+	// delete can still be inspected
+	if _, err := os.Stat(utils.ContainerDir(containerId)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("container %s does not exist", containerId)
+		}
+		return err
+	}
+
+	results, err := hook.ReadHookResults(containerId)
+	if err != nil {
+		return err
+	}
+
+	if ctx.String("format") == "json" {
+		if results == nil {
+			results = []hook.HookRunResult{}
+		}
+		dataStr, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(dataStr))
+		return nil
+	}
+
+	fmt.Printf("%-16s %-6s %-8s %-5s %-10s %-s\n", "PHASE", "INDEX", "RESULT", "EXIT", "DURATION", "PATH")
+	for _, r := range results {
+		fmt.Printf("%-16s %-6d %-8s %-5d %-10s %-s\n",
+			r.Phase, r.Index, r.Result, r.ExitCode, fmt.Sprintf("%dms", r.DurationMS), r.Path)
+		if r.Error != "" {
+			fmt.Printf("  error: %s\n", r.Error)
+		}
+		fmt.Printf("  log:   %s\n", r.Log)
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ func commandInit() *cli.Command {
 		Usage:     "initialize a container",
 		ArgsUsage: "<container-id> <fifo-path> <entrypoint>",
 		Hidden:    true,
+		Flags:     initProcessFlags(),
 		Action:    runInit,
 	}
 }
@@ -25,9 +26,13 @@ func runInit(ctx *cli.Context) error {
 
 	containerInit := container.NewContainerInit()
 	err := containerInit.Execute(container.InitOption{
-		ContainerId: containerId,
-		Fifo:        fifo,
-		Entrypoint:  entrypoint,
+		ContainerId:  containerId,
+		Fifo:         fifo,
+		Entrypoint:   entrypoint,
+		ListenFds:    ctx.Int("listen-fds"),
+		PreserveFds:  ctx.Int("preserve-fds"),
+		NoPivot:      ctx.Bool("no-pivot"),
+		NoNewKeyring: ctx.Bool("no-new-keyring"),
 	})
 	if err != nil {
 		return err
@@ -35,3 +40,22 @@ func runInit(ctx *cli.Context) error {
 
 	return nil
 }
+
+// initProcessFlags returns the hidden flags forwarded from create/run to
+// the shim and init subcommands.
+func initProcessFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name: "listen-fds",
+		},
+		&cli.IntFlag{
+			Name: "preserve-fds",
+		},
+		&cli.BoolFlag{
+			Name: "no-pivot",
+		},
+		&cli.BoolFlag{
+			Name: "no-new-keyring",
+		},
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"droplet/internal/status"
 	"encoding/json"
 	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"text/template"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
@@ -15,7 +20,16 @@ func commandList() *cli.Command {
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:  "format",
-				Usage: "print format [default|json]",
+				Usage: "print format [default|json|<go template>], e.g. '{{.Id}} {{.Pid}}'",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "print container ids only",
+			},
+			&cli.StringSliceFlag{
+				Name:  "filter",
+				Usage: "filter containers [status=<status>|id=<id>|annotation=<key>[=<value>]]",
 			},
 		},
 		Action: runList,
@@ -26,6 +40,12 @@ func runList(ctx *cli.Context) error {
 	// format option
 	formatOption := ctx.String("format")
 
+	// filter option
+	filter, err := status.ParseListFilter(ctx.StringSlice("filter"))
+	if err != nil {
+		return err
+	}
+
 	containerStatusHandler := status.NewStatusHandler()
 
 	// read state.json
@@ -33,24 +53,81 @@ func runList(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	list := []status.StatusObject{}
+	for _, entry := range containerStatusList {
+		if filter.Match(entry) {
+			list = append(list, entry)
+		}
+	}
 
-	printList(containerStatusList, formatOption)
-
-	return nil
+	if ctx.Bool("quiet") {
+		for _, entry := range list {
+			fmt.Println(entry.Id)
+		}
+		return nil
+	}
+	return printList(list, formatOption)
 }
 
-func printList(list []status.StatusObject, format string) {
-
-	if format == "json" {
+func printList(list []status.StatusObject, format string) error {
+	switch format {
+	case "", "default":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tPID\tEXIT\tCREATED\tSTARTED\tFINISHED\tOWNER\tBUNDLE")
+		for _, entry := range list {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				entry.Id, entry.Status, entry.Pid, exitColumn(entry),
+				timeColumn(entry.Created), timeColumn(entry.StartedAt), timeColumn(entry.FinishedAt),
+				textColumn(entry.Owner), entry.Bundle)
+		}
+		return w.Flush()
+	case "json":
 		dataStr, err := json.Marshal(list)
 		if err != nil {
-			return
+			return err
 		}
 		fmt.Print(string(dataStr))
-	} else {
-		fmt.Printf("%-15s %-15s %-8s %-s\n", "ID", "STATUS", "PID", "BUNDLE")
+		return nil
+	default:
+		tmpl, err := template.New("format").Parse(format)
+		if err != nil {
+			return fmt.Errorf("invalid format template: %w", err)
+		}
 		for _, entry := range list {
-			fmt.Printf("%-15s %-15s %-8d %-s\n", entry.Id, entry.Status, entry.Pid, entry.Bundle)
+			if err := tmpl.Execute(os.Stdout, entry); err != nil {
+				return err
+			}
+			fmt.Println()
 		}
+		return nil
+	}
+}
+
+// exitColumn formats the exit of a container, e.g. "137 SIGKILL oom".
+func exitColumn(entry status.StatusObject) string {
+	if entry.ExitCode == nil {
+		return "-"
+	}
+	s := strconv.Itoa(*entry.ExitCode)
+	if entry.ExitSignal != "" {
+		s += " " + entry.ExitSignal
+	}
+	if entry.OomKilled {
+		s += " oom"
+	}
+	return s
+}
+
+func timeColumn(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func textColumn(s string) string {
+	if s == "" {
+		return "-"
 	}
+	return s
 }
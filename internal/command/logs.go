@@ -0,0 +1,81 @@
+package command
+
+import (
+	"droplet/internal/container"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandLogs() *cli.Command {
+	return &cli.Command{
+		Name:      "logs",
+		Usage:     "print the output of a container",
+		ArgsUsage: "<container-id>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "follow",
+				Aliases: []string{"f"},
+				Usage:   "keep printing new output until the container stops",
+			},
+			&cli.IntFlag{
+				Name:  "tail",
+				Usage: "number of lines to show from the end of the log (-1 for all)",
+				Value: -1,
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "show output since a timestamp (RFC3339) or a relative duration (e.g. 10m)",
+			},
+			&cli.BoolFlag{
+				Name:    "timestamps",
+				Aliases: []string{"t"},
+				Usage:   "prefix each line with its timestamp",
+			},
+			&cli.BoolFlag{
+				Name:  "exec",
+				Usage: "print the output of the exec sessions",
+			},
+		},
+		Action: runLogs,
+	}
+}
+
+func runLogs(ctx *cli.Context) error {
+	// retrieve container id
+	containerId := ctx.Args().Get(0)
+	if containerId == "" {
+		return fmt.Errorf("container id is required")
+	}
+
+	since, err := parseSince(ctx.String("since"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	containerLogs := container.NewContainerLogs()
+	return containerLogs.Execute(container.LogsOption{
+		ContainerId: containerId,
+		Follow:      ctx.Bool("follow"),
+		Tail:        ctx.Int("tail"),
+		Since:       since,
+		Timestamps:  ctx.Bool("timestamps"),
+		Exec:        ctx.Bool("exec"),
+	})
+}
+
+// parseSince parses an RFC3339 timestamp or a duration relative to now.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid --since: %q", value)
+	}
+	return now.Add(-d), nil
+}
@@ -0,0 +1,28 @@
+package command
+
+import (
+	"droplet/internal/container"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandPrune() *cli.Command {
+	return &cli.Command{
+		Name:  "prune",
+		Usage: "remove the leftovers of containers whose processes are gone",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "only print what would be removed",
+			},
+		},
+		Action: runPrune,
+	}
+}
+
+func runPrune(ctx *cli.Context) error {
+	containerPrune := container.NewContainerPrune()
+	return containerPrune.Execute(container.PruneOption{
+		DryRun: ctx.Bool("dry-run"),
+	})
+}
@@ -2,6 +2,7 @@ package command
 
 import (
 	"droplet/internal/container"
+	"droplet/internal/utils"
 
 	"github.com/urfave/cli/v2"
 )
@@ -12,6 +13,11 @@ func commandRun() *cli.Command {
 		Usage:     "run a container",
 		ArgsUsage: "<container-id>",
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "bundle",
+				Aliases: []string{"b"},
+				Usage:   "path to the root of the bundle directory (default: container state directory)",
+			},
 			&cli.BoolFlag{
 				Name:    "tty",
 				Usage:   "attach tty to container",
@@ -22,6 +28,31 @@ func commandRun() *cli.Command {
 				Hidden: true,
 				Value:  false,
 			},
+			&cli.StringFlag{
+				Name:  "pid-file",
+				Usage: "file to write the process id to",
+			},
+			&cli.StringFlag{
+				Name:  "console-socket",
+				Usage: "path to an AF_UNIX socket which will receive the pty master (requires --tty)",
+			},
+			&cli.IntFlag{
+				Name:  "preserve-fds",
+				Usage: "pass N additional file descriptors to the container (stdio + $LISTEN_FDS + N in total)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-pivot",
+				Usage: "do not use pivot_root to jail process inside rootfs",
+			},
+			&cli.BoolFlag{
+				Name:  "no-new-keyring",
+				Usage: "do not create a new session keyring for the container",
+			},
+			&cli.StringFlag{
+				Name:  "hooks-dir",
+				Usage: "directory of oci-hooks.d style hook definitions (empty to disable)",
+				Value: utils.HooksDir,
+			},
 		},
 		Action: runRun,
 	}
@@ -31,17 +62,33 @@ func runRun(ctx *cli.Context) error {
 	// retrieve container ID
 	containerId := ctx.Args().Get(0)
 	// options
+	// bundle
+	bundle := ctx.String("bundle")
 	// interactive
 	tty := ctx.Bool("tty")
 	// print-pid
 	printPidFlag := ctx.Bool("print-pid")
+	// runc compatible options
+	pidFile := ctx.String("pid-file")
+	consoleSocket := ctx.String("console-socket")
+	preserveFds := ctx.Int("preserve-fds")
+	noPivot := ctx.Bool("no-pivot")
+	noNewKeyring := ctx.Bool("no-new-keyring")
+	hooksDir := ctx.String("hooks-dir")
 
 	containerRun := container.NewContainerRun()
 	err := containerRun.Run(
 		container.RunOption{
-			ContainerId:  containerId,
-			Tty:          tty,
-			PrintPidFlag: printPidFlag,
+			ContainerId:   containerId,
+			Bundle:        bundle,
+			Tty:           tty,
+			PrintPidFlag:  printPidFlag,
+			PidFile:       pidFile,
+			ConsoleSocket: consoleSocket,
+			PreserveFds:   preserveFds,
+			NoPivot:       noPivot,
+			NoNewKeyring:  noNewKeyring,
+			HooksDir:      hooksDir,
 		},
 	)
 
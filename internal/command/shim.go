@@ -12,7 +12,12 @@ func commandShim() *cli.Command {
 		Usage:     "shim process",
 		ArgsUsage: "<container-id> <fifo-path> <entrypoint>",
 		Hidden:    true,
-		Action:    runShim,
+		Flags: append(initProcessFlags(),
+			&cli.BoolFlag{
+				Name: "no-tty",
+			},
+		),
+		Action: runShim,
 	}
 }
 
@@ -24,7 +29,16 @@ func runShim(ctx *cli.Context) error {
 	entrypoint := args[2:]
 
 	containerShim := container.NewContainerShim()
-	err := containerShim.Execute(containerId, fifo, entrypoint)
+	err := containerShim.Execute(container.ShimOption{
+		ContainerId:  containerId,
+		Fifo:         fifo,
+		Entrypoint:   entrypoint,
+		ListenFds:    ctx.Int("listen-fds"),
+		PreserveFds:  ctx.Int("preserve-fds"),
+		NoPivot:      ctx.Bool("no-pivot"),
+		NoNewKeyring: ctx.Bool("no-new-keyring"),
+		NoTty:        ctx.Bool("no-tty"),
+	})
 	if err != nil {
 		return err
 	}
@@ -80,6 +80,11 @@ func commandSpec() *cli.Command {
 			},
 
 			// layer
+			&cli.StringFlag{
+				Name:  "rootfs_type",
+				Usage: "rootfs type [bind|overlay|overlay-volatile]",
+				Value: "overlay",
+			},
 			&cli.StringSliceFlag{
 				Name:  "image_layer",
 				Usage: "image layer path",
@@ -151,6 +156,12 @@ func commandSpec() *cli.Command {
 				Usage: "poststop hook env (format: KEY=VALUE)",
 			},
 
+			// annotation
+			&cli.StringSliceFlag{
+				Name:  "annotation",
+				Usage: "annotation (format: KEY=VALUE)",
+			},
+
 			&cli.StringFlag{
 				Name:  "output",
 				Usage: "output path",
@@ -219,6 +230,8 @@ func createConfigOptions(ctx *cli.Context) (spec.ConfigOptions, error) {
 	dns := ctx.StringSlice("dns")
 
 	// image
+	// rootfs type
+	rootfsType := ctx.String("rootfs_type")
 	// image layer
 	imageLayer := ctx.StringSlice("image_layer")
 	// upper dir
@@ -257,6 +270,12 @@ func createConfigOptions(ctx *cli.Context) (spec.ConfigOptions, error) {
 		return spec.ConfigOptions{}, err
 	}
 
+	// annotation
+	annotations, err := parseAnnotationFlag(ctx.StringSlice("annotation"))
+	if err != nil {
+		return spec.ConfigOptions{}, err
+	}
+
 	return spec.ConfigOptions{
 		Rootfs: rootfs,
 		Mounts: mounts,
@@ -276,6 +295,7 @@ func createConfigOptions(ctx *cli.Context) (spec.ConfigOptions, error) {
 			Dns:                 dns,
 		},
 		Image: spec.ImageOption{
+			RootfsType: rootfsType,
 			ImageLayer: imageLayer,
 			UpperDir:   upperDir,
 			WorkDir:    workDir,
@@ -289,6 +309,7 @@ func createConfigOptions(ctx *cli.Context) (spec.ConfigOptions, error) {
 			StopContainer:   stopContainerHook,
 			Poststop:        poststopHook,
 		},
+		Annotations: annotations,
 	}, nil
 }
 
@@ -338,6 +359,18 @@ func parseMountFlag(mounts []string) ([]spec.MountOption, error) {
 	return mountOption, nil
 }
 
+func parseAnnotationFlag(values []string) (map[string]string, error) {
+	annotations := map[string]string{}
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid annotation format: %q", v)
+		}
+		annotations[key] = value
+	}
+	return annotations, nil
+}
+
 func parseCommandFlag(s string) ([]string, error) {
 	args, err := shlex.Split(s)
 	if err != nil {
@@ -11,7 +11,13 @@ func commandState() *cli.Command {
 		Name:      "state",
 		Usage:     "query state a container",
 		ArgsUsage: "<container-id>",
-		Action:    runState,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "raw",
+				Usage: "print state.json as stored, without refreshing or migrating it",
+			},
+		},
+		Action: runState,
 	}
 }
 
@@ -20,6 +26,17 @@ func runState(ctx *cli.Context) error {
 	containerId := ctx.Args().Get(0)
 
 	containerStatusHandler := status.NewStatusHandler()
+
+	// raw: the stored bytes as they are
+	if ctx.Bool("raw") {
+		statusInfo, err := containerStatusHandler.ReadRawStatusFile(containerId)
+		if err != nil {
+			return err
+		}
+		fmt.Print(statusInfo)
+		return nil
+	}
+
 	statusInfo, err := containerStatusHandler.ReadStatusFile(containerId)
 	if err != nil {
 		return err
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"droplet/internal/container"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+func commandWait() *cli.Command {
+	return &cli.Command{
+		Name:      "wait",
+		Usage:     "block until a container stops and print its exit code",
+		ArgsUsage: "<container-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "condition",
+				Usage: "state to wait for [stopped|running|removed]",
+				Value: string(container.WaitConditionStopped),
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "give up after this duration (e.g. 30s, 0 waits forever)",
+			},
+		},
+		Action: runWait,
+	}
+}
+
+func runWait(ctx *cli.Context) error {
+	// retrieve container id
+	containerId := ctx.Args().Get(0)
+	if containerId == "" {
+		return fmt.Errorf("container id is required")
+	}
+
+	condition, err := container.ParseWaitCondition(ctx.String("condition"))
+	if err != nil {
+		return err
+	}
+
+	containerWait := container.NewContainerWait()
+	return containerWait.Execute(container.WaitOption{
+		ContainerId: containerId,
+		Condition:   condition,
+		Timeout:     ctx.Duration("timeout"),
+	})
+}
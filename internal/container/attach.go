@@ -3,13 +3,16 @@ package container
 import (
 	"droplet/internal/utils"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"golang.org/x/term"
 )
@@ -18,14 +21,62 @@ func NewContainerAttach() *ContainerAttach {
 	return &ContainerAttach{}
 }
 
-const (
-	frameData   = 0x00
-	frameResize = 0x01
-)
+// DefaultDetachKeys is the key sequence that detaches from a container
+// without stopping it.
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// errDetached is returned by pumpStdinFramed when the detach key sequence
+// is typed.
+var errDetached = errors.New("detached")
 
 type ContainerAttach struct{}
 
+// clientCapabilities is the capability set requested by attach.
+const clientCapabilities = capSignal | capCloseStdin | capExitStatus | capStderr
+
+// proxiedSignals are forwarded to the container process when the shim
+// supports it.
+var proxiedSignals = []os.Signal{
+	syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM,
+	syscall.SIGUSR1, syscall.SIGUSR2,
+}
+
+// shimPeer is the outcome of the handshake. ready is closed once the first
+// message of the shim has been read; an unversioned shim leaves hello zero.
+type shimPeer struct {
+	ready chan struct{}
+	hello hello
+}
+
+func (p *shimPeer) supports(capability uint32) bool {
+	return p.hello.capabilities&capability != 0
+}
+
+// wait waits for the first message of the shim and reports whether it
+// arrived. The shim usually answers the handshake at once, so an unanswered
+// handshake is treated as an unversioned shim after a second.
+func (p *shimPeer) wait() bool {
+	select {
+	case <-p.ready:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+// terminal reports whether the container process runs on a pty, which is
+// always the case behind an unversioned shim. It must only be called once
+// wait returned true.
+func (p *shimPeer) terminal() bool {
+	return !p.supports(capStderr)
+}
+
 func (c *ContainerAttach) Execute(opt AttachOption) error {
+	detachKeys, err := parseDetachKeys(opt.DetachKeys)
+	if err != nil {
+		return err
+	}
+
 	sockPath := utils.SockPath(opt.ContainerId)
 	conn, err := net.Dial("unix", sockPath)
 	if err != nil {
@@ -33,8 +84,44 @@ func (c *ContainerAttach) Execute(opt AttachOption) error {
 	}
 	defer conn.Close()
 
-	// TTY: raw mode
-	isTTY := term.IsTerminal(int(os.Stdin.Fd()))
+	// the handshake and the replay request go first: the shim holds back
+	// live output until it has written the requested history
+	if err := writeFrame(conn, frameHello, hello{version: protocolVersion, capabilities: clientCapabilities}.encode()); err != nil {
+		return err
+	}
+	if err := c.sendReplay(conn, opt); err != nil {
+		return err
+	}
+	peer := &shimPeer{ready: make(chan struct{})}
+
+	// read-only viewers keep the terminal cooked, so ctrl-c ends the
+	// attach locally instead of being sent to the container
+	if opt.ReadOnly {
+		if err := writeFrame(conn, frameReadOnly, nil); err != nil {
+			return err
+		}
+		status, exited, err := c.copyOutput(os.Stdout, os.Stderr, conn, peer)
+		return attachResult(status, exited, err)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		status int
+		exited bool
+	)
+	errCh := make(chan error, 2)
+	wg.Add(1)
+
+	// socket -> stdout, stderr
+	go func() {
+		defer wg.Done()
+		var e error
+		status, exited, e = c.copyOutput(os.Stdout, os.Stderr, conn, peer)
+		errCh <- e
+	}()
+
+	// TTY: raw mode, only when the container process has a pty as well
+	isTTY := term.IsTerminal(int(os.Stdin.Fd())) && (!peer.wait() || peer.terminal())
 	if isTTY {
 		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
 		if err != nil {
@@ -44,28 +131,24 @@ func (c *ContainerAttach) Execute(opt AttachOption) error {
 	}
 
 	// start resize watcher
-	stopResize := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
 	if isTTY {
 		_ = c.sendResize(conn)
-		go c.watchWinch(conn, stopResize)
-		defer close(stopResize)
+		go c.watchWinch(conn, stop)
+	}
+	if opt.SigProxy {
+		go c.forwardSignals(conn, peer, stop)
 	}
-
-	var wg sync.WaitGroup
-	errCh := make(chan error, 2)
-	wg.Add(2)
-
-	// socket -> stdout (raw data is sent from shim)
-	go func() {
-		defer wg.Done()
-		_, e := io.Copy(os.Stdout, conn)
-		errCh <- e
-	}()
 
 	// stdin -> socket (send frame data)
+	// stdin is not waited for: a read may block until the next key press
 	go func() {
-		defer wg.Done()
-		e := c.pumpStdinFramed(conn, os.Stdin)
+		e := c.pumpStdinFramed(conn, os.Stdin, detachKeys)
+		if e == io.EOF && c.closeStdin(conn, peer) {
+			// keep receiving output until the container process exits
+			return
+		}
 		errCh <- e
 	}()
 
@@ -73,27 +156,240 @@ func (c *ContainerAttach) Execute(opt AttachOption) error {
 	_ = conn.Close()
 	wg.Wait()
 
-	if e == io.EOF {
+	// the deferred restore puts the terminal back; the container keeps
+	// running after a detach
+	if errors.Is(e, errDetached) {
+		return nil
+	}
+	return attachResult(status, exited, e)
+}
+
+// attachResult maps the end of an attach session to the command result.
+// The exit status pushed by the shim wins over the connection error.
+func attachResult(status int, exited bool, err error) error {
+	if exited {
+		if status != 0 {
+			return &ExitStatusError{Status: status}
+		}
+		return nil
+	}
+	if err == nil || err == io.EOF || errors.Is(err, net.ErrClosed) {
 		return nil
 	}
-	return e
+	return err
+}
+
+// copyOutput copies the output of the shim to stdout, or to stderr for the
+// stderr stream of a process without a terminal, until the connection ends
+// or the shim reports the exit of the container process. A versioned shim
+// opens with a frameHello; anything else is raw output of an unversioned
+// shim.
+func (c *ContainerAttach) copyOutput(w, stderr io.Writer, r io.Reader, peer *shimPeer) (int, bool, error) {
+	hdr := make([]byte, 5)
+	n, err := io.ReadFull(r, hdr)
+	isHello := err == nil && hdr[0] == frameHello && binary.BigEndian.Uint32(hdr[1:5]) == 6
+	if !isHello {
+		close(peer.ready)
+		if n > 0 {
+			if _, werr := w.Write(hdr[:n]); werr != nil {
+				return 0, false, werr
+			}
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		_, err = io.Copy(w, r)
+		return 0, false, err
+	}
+
+	payload := make([]byte, 6)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		close(peer.ready)
+		return 0, false, err
+	}
+	peer.hello, _ = decodeHello(payload)
+	close(peer.ready)
+
+	for {
+		typ, payload, err := readFrame(r)
+		if err != nil {
+			return 0, false, err
+		}
+		switch typ {
+		case frameData:
+			if _, err := w.Write(payload); err != nil {
+				return 0, false, err
+			}
+		case frameStderr:
+			if _, err := stderr.Write(payload); err != nil {
+				return 0, false, err
+			}
+		case frameExit:
+			if len(payload) == 4 {
+				return int(int32(binary.BigEndian.Uint32(payload))), true, nil
+			}
+		}
+	}
+}
+
+// closeStdin half-closes the input when the shim supports it and reports
+// whether it did.
+func (c *ContainerAttach) closeStdin(conn net.Conn, peer *shimPeer) bool {
+	if !peer.wait() {
+		return false
+	}
+	if !peer.supports(capCloseStdin) {
+		return false
+	}
+	return writeFrame(conn, frameCloseStdin, nil) == nil
+}
+
+// forwardSignals forwards the signals received by attach to the container
+// process. Signals are only intercepted once the shim is known to support
+// forwarding, so they keep their default behavior otherwise.
+func (c *ContainerAttach) forwardSignals(conn net.Conn, peer *shimPeer, stop <-chan struct{}) {
+	select {
+	case <-peer.ready:
+	case <-stop:
+		return
+	}
+	if !peer.supports(capSignal) {
+		return
+	}
+
+	ch := make(chan os.Signal, 8)
+	signal.Notify(ch, proxiedSignals...)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-stop:
+			return
+		case sig := <-ch:
+			if s, ok := sig.(syscall.Signal); ok {
+				_ = writeFrame(conn, frameSignal, encodeUint32(uint32(s)))
+			}
+		}
+	}
 }
 
-func (c *ContainerAttach) pumpStdinFramed(conn net.Conn, r io.Reader) error {
+// pumpStdinFramed forwards r to w as data frames until r fails or the
+// detach key sequence is read. Bytes that start the sequence are held back
+// and sent as soon as the sequence is broken, so a partial match still
+// reaches the container. On a mismatch the match falls back to the longest
+// held back suffix that is still a prefix of the sequence, so sequences
+// with a repeated prefix such as "a,a,b" also match "aaab".
+func (c *ContainerAttach) pumpStdinFramed(w io.Writer, r io.Reader, detachKeys []byte) error {
 	buf := make([]byte, 32*1024)
+	fallback := detachKeysFallback(detachKeys)
+	matched := 0 // number of detach key bytes seen so far
 	for {
 		n, err := r.Read(buf)
 		if n > 0 {
-			if werr := c.writeFrame(conn, frameData, buf[:n]); werr != nil {
-				return werr
+			out := make([]byte, 0, matched+n)
+			detached := false
+			for _, b := range buf[:n] {
+				if len(detachKeys) == 0 {
+					out = append(out, b)
+					continue
+				}
+				for matched > 0 && b != detachKeys[matched] {
+					// the bytes before the fallback can no longer be part
+					// of a match
+					k := fallback[matched-1]
+					out = append(out, detachKeys[:matched-k]...)
+					matched = k
+				}
+				if b != detachKeys[matched] {
+					out = append(out, b)
+					continue
+				}
+				matched++
+				if matched == len(detachKeys) {
+					detached = true
+					break
+				}
+			}
+			if len(out) > 0 {
+				if werr := writeFrame(w, frameData, out); werr != nil {
+					return werr
+				}
+			}
+			if detached {
+				return errDetached
 			}
 		}
 		if err != nil {
+			if matched > 0 {
+				_ = writeFrame(w, frameData, detachKeys[:matched])
+			}
 			return err
 		}
 	}
 }
 
+// detachKeysFallback returns, for each prefix keys[:i+1], the length of
+// its longest proper suffix that is also a prefix of keys (the KMP failure
+// function).
+func detachKeysFallback(keys []byte) []int {
+	fallback := make([]int, len(keys))
+	k := 0
+	for i := 1; i < len(keys); i++ {
+		for k > 0 && keys[i] != keys[k] {
+			k = fallback[k-1]
+		}
+		if keys[i] == keys[k] {
+			k++
+		}
+		fallback[i] = k
+	}
+	return fallback
+}
+
+// parseDetachKeys parses a comma separated key sequence such as
+// "ctrl-p,ctrl-q". Each key is a single character or ctrl-<c>, where <c>
+// is a letter or one of @[\]^_. An empty string disables detaching.
+func parseDetachKeys(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var keys []byte
+	for _, key := range strings.Split(value, ",") {
+		if len(key) == 1 {
+			keys = append(keys, key[0])
+			continue
+		}
+		name, ok := strings.CutPrefix(strings.ToLower(key), "ctrl-")
+		if !ok || len(name) != 1 {
+			return nil, fmt.Errorf("invalid detach key: %q", key)
+		}
+		switch ch := name[0]; {
+		case ch >= 'a' && ch <= 'z':
+			keys = append(keys, ch-'a'+1)
+		case ch == '@':
+			keys = append(keys, 0)
+		case ch == '[' || ch == '\\' || ch == ']' || ch == '^' || ch == '_':
+			keys = append(keys, ch-'@')
+		default:
+			return nil, fmt.Errorf("invalid detach key: %q", key)
+		}
+	}
+	return keys, nil
+}
+
+// sendReplay requests the output history selected by opt. Replay 0 without
+// SinceStart requests no history and only starts the live output.
+func (c *ContainerAttach) sendReplay(conn net.Conn, opt AttachOption) error {
+	payload := make([]byte, 9)
+	if opt.SinceStart {
+		payload[0] = replaySince
+		binary.BigEndian.PutUint64(payload[1:9], 0)
+	} else {
+		payload[0] = replayLast
+		binary.BigEndian.PutUint64(payload[1:9], uint64(max(opt.Replay, 0)))
+	}
+	return writeFrame(conn, frameReplay, payload)
+}
+
 func (c *ContainerAttach) watchWinch(conn net.Conn, stop <-chan struct{}) {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGWINCH)
@@ -121,19 +417,5 @@ func (c *ContainerAttach) sendResize(conn net.Conn) error {
 	payload := make([]byte, 4)
 	binary.BigEndian.PutUint16(payload[0:2], uint16(h)) // rows
 	binary.BigEndian.PutUint16(payload[2:4], uint16(w)) // cols
-	return c.writeFrame(conn, frameResize, payload)
-}
-
-func (c *ContainerAttach) writeFrame(w io.Writer, typ byte, payload []byte) error {
-	h := make([]byte, 1+4)
-	h[0] = typ
-	binary.BigEndian.PutUint32(h[1:5], uint32(len(payload)))
-	if _, err := w.Write(h); err != nil {
-		return err
-	}
-	if len(payload) > 0 {
-		_, err := w.Write(payload)
-		return err
-	}
-	return nil
+	return writeFrame(conn, frameResize, payload)
 }
@@ -0,0 +1,223 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dataFrames decodes the payloads of the data frames written to b.
+func dataFrames(t *testing.T, b *bytes.Buffer) []byte {
+	t.Helper()
+	var out []byte
+	for b.Len() > 0 {
+		hdr := b.Next(5)
+		n := binary.BigEndian.Uint32(hdr[1:5])
+		payload := b.Next(int(n))
+		if hdr[0] == frameData {
+			out = append(out, payload...)
+		}
+	}
+	return out
+}
+
+func TestParseDetachKeys_Default(t *testing.T) {
+	// == act ==
+	keys, err := parseDetachKeys(DefaultDetachKeys)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x10, 0x11}, keys)
+}
+
+func TestParseDetachKeys_Variants(t *testing.T) {
+	// == act ==
+	keys, err := parseDetachKeys("ctrl-@,ctrl-],x,CTRL-A")
+	empty, emptyErr := parseDetachKeys("")
+	_, badErr := parseDetachKeys("ctrl-1")
+	_, longErr := parseDetachKeys("shift-a")
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x00, 0x1d, 'x', 0x01}, keys)
+	assert.Nil(t, emptyErr)
+	assert.Nil(t, empty)
+	assert.NotNil(t, badErr)
+	assert.NotNil(t, longErr)
+}
+
+func TestPumpStdinFramed_Detach(t *testing.T) {
+	// == arrange ==
+	c := NewContainerAttach()
+	var w bytes.Buffer
+	r := bytes.NewReader([]byte("ls\r\x10\x11ignored"))
+
+	// == act ==
+	err := c.pumpStdinFramed(&w, r, []byte{0x10, 0x11})
+
+	// == assert ==
+	assert.ErrorIs(t, err, errDetached)
+	assert.Equal(t, []byte("ls\r"), dataFrames(t, &w))
+}
+
+func TestPumpStdinFramed_DetachAcrossReads(t *testing.T) {
+	// == arrange ==
+	c := NewContainerAttach()
+	var w bytes.Buffer
+	r := iotest.OneByteReader(bytes.NewReader([]byte("a\x10\x11b")))
+
+	// == act ==
+	err := c.pumpStdinFramed(&w, r, []byte{0x10, 0x11})
+
+	// == assert ==
+	assert.ErrorIs(t, err, errDetached)
+	assert.Equal(t, []byte("a"), dataFrames(t, &w))
+}
+
+func TestPumpStdinFramed_PartialMatchForwarded(t *testing.T) {
+	// == arrange ==
+	c := NewContainerAttach()
+	var w bytes.Buffer
+	r := bytes.NewReader([]byte("\x10a\x10\x10b\x10"))
+
+	// == act ==
+	err := c.pumpStdinFramed(&w, r, []byte{0x10, 0x11})
+
+	// == assert ==
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []byte("\x10a\x10\x10b\x10"), dataFrames(t, &w))
+}
+
+func TestPumpStdinFramed_RepeatedPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []byte
+		input    string
+		wantErr  error
+		wantData string
+	}{
+		{"a,a,b after a", []byte("aab"), "aaab", errDetached, "a"},
+		{"a,a,b after text", []byte("aab"), "xaaaab", errDetached, "xaa"},
+		{"a,b,a,c", []byte("abac"), "ababac", errDetached, "ab"},
+		{"a,a,b broken", []byte("aab"), "aaxab", io.EOF, "aaxab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// == arrange ==
+			c := NewContainerAttach()
+			var w bytes.Buffer
+			r := iotest.OneByteReader(bytes.NewReader([]byte(tt.input)))
+
+			// == act ==
+			err := c.pumpStdinFramed(&w, r, tt.keys)
+
+			// == assert ==
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantData, string(dataFrames(t, &w)))
+		})
+	}
+}
+
+func TestPumpStdinFramed_Disabled(t *testing.T) {
+	// == arrange ==
+	c := NewContainerAttach()
+	var w bytes.Buffer
+	r := bytes.NewReader([]byte("\x10\x11"))
+
+	// == act ==
+	err := c.pumpStdinFramed(&w, r, nil)
+
+	// == assert ==
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []byte("\x10\x11"), dataFrames(t, &w))
+}
+
+func TestCopyOutput_Unversioned(t *testing.T) {
+	// == arrange ==
+	c := NewContainerAttach()
+	peer := &shimPeer{ready: make(chan struct{})}
+	var out bytes.Buffer
+
+	// == act ==
+	status, exited, err := c.copyOutput(&out, io.Discard, bytes.NewReader([]byte("raw output")), peer)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.False(t, exited)
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "raw output", out.String())
+	assert.False(t, peer.supports(capSignal))
+}
+
+func TestCopyOutput_ShortUnversioned(t *testing.T) {
+	// == arrange ==
+	c := NewContainerAttach()
+	peer := &shimPeer{ready: make(chan struct{})}
+	var out bytes.Buffer
+
+	// == act ==
+	_, exited, err := c.copyOutput(&out, io.Discard, bytes.NewReader([]byte("ok")), peer)
+
+	// == assert ==
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.False(t, exited)
+	assert.Equal(t, "ok", out.String())
+}
+
+func TestCopyOutput_VersionedWithExit(t *testing.T) {
+	// == arrange ==
+	c := NewContainerAttach()
+	peer := &shimPeer{ready: make(chan struct{})}
+	var in, out bytes.Buffer
+	in.Write(frame(frameHello, hello{version: protocolVersion, capabilities: shimCapabilities}.encode()))
+	in.Write(frame(frameData, []byte("hello")))
+	in.Write(frame(frameExit, encodeUint32(137)))
+	in.Write(frame(frameData, []byte("ignored")))
+
+	// == act ==
+	status, exited, err := c.copyOutput(&out, io.Discard, &in, peer)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.True(t, exited)
+	assert.Equal(t, 137, status)
+	assert.Equal(t, "hello", out.String())
+	assert.True(t, peer.supports(capCloseStdin))
+}
+
+func TestCopyOutput_SeparateStderr(t *testing.T) {
+	// == arrange ==
+	c := NewContainerAttach()
+	peer := &shimPeer{ready: make(chan struct{})}
+	var in, out, errOut bytes.Buffer
+	in.Write(frame(frameHello, hello{version: protocolVersion, capabilities: shimCapabilities | capStderr}.encode()))
+	in.Write(frame(frameData, []byte("out")))
+	in.Write(frame(frameStderr, []byte("err")))
+	in.Write(frame(frameExit, encodeUint32(0)))
+
+	// == act ==
+	_, exited, err := c.copyOutput(&out, &errOut, &in, peer)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.True(t, exited)
+	assert.Equal(t, "out", out.String())
+	assert.Equal(t, "err", errOut.String())
+	assert.False(t, peer.terminal())
+}
+
+func TestAttachResult(t *testing.T) {
+	// == act ==
+	failed := attachResult(2, true, io.EOF)
+	succeeded := attachResult(0, true, nil)
+	closed := attachResult(0, false, io.EOF)
+
+	// == assert ==
+	assert.Equal(t, &ExitStatusError{Status: 2}, failed)
+	assert.Nil(t, succeeded)
+	assert.Nil(t, closed)
+}
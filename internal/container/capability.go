@@ -2,6 +2,8 @@ package container
 
 import (
 	"fmt"
+	"os"
+
 	"github.com/syndtr/gocapability/capability"
 )
 
@@ -28,7 +30,7 @@ func toCaps(names []string) []capability.Cap {
 		if v, ok := capNameMap[n]; ok {
 			res = append(res, v)
 		} else {
-			fmt.Errorf("unknown capability: %s\n", n)
+			fmt.Fprintf(os.Stderr, "unknown capability: %s\n", n)
 		}
 	}
 	return res
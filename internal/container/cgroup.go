@@ -4,8 +4,10 @@ import (
 	"droplet/internal/spec"
 	"droplet/internal/utils"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // newContainerCgroupController returns a new containerCgroupController
@@ -37,6 +39,11 @@ type containerCgroupController struct {
 // This method configures memory, CPU, and process membership
 // sequentially and returns an error if any step fails.
 func (c *containerCgroupController) prepare(containerId string, spec spec.Spec, pid int) error {
+	// 0. create container cgroup if not exists
+	if err := c.syscallHandler.MkdirAll(utils.CgroupPath(containerId), 0755); err != nil {
+		return err
+	}
+
 	// 1. set memory limit
 	if err := c.setMemoryLimit(containerId, spec.LinuxSpec.Resources.Memory); err != nil {
 		return err
@@ -60,6 +67,24 @@ func (c *containerCgroupController) prepare(containerId string, spec spec.Spec,
 	return nil
 }
 
+// cgroupOomKilled reports whether the OOM killer killed a process of the
+// container's cgroup, from the oom_kill counter of memory.events. A missing
+// cgroup reports false.
+func cgroupOomKilled(containerId string) bool {
+	data, err := os.ReadFile(filepath.Join(utils.CgroupPath(containerId), "memory.events"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if ok && key == "oom_kill" {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			return err == nil && n > 0
+		}
+	}
+	return false
+}
+
 // setMemoryLimit writes the memory limit value to memory.max
 // under the container's cgroup directory. The value is applied
 // according to the provided MemoryObject configuration.
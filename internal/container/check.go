@@ -0,0 +1,333 @@
+package container
+
+import (
+	"bufio"
+	"droplet/internal/utils"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// check status
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// CheckResult is a single item of the host environment report.
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// NewHostChecker constructs a HostChecker with the default
+// KernelSyscallHandler and AppArmor manager.
+func NewHostChecker() *HostChecker {
+	return &HostChecker{
+		syscallHandler:  utils.NewSyscallHandler(),
+		appArmorManager: NewAppArmorManager(),
+	}
+}
+
+// HostChecker verifies that the host provides everything droplet needs
+// (the `check` command), so that setup problems are reported up front
+// instead of failing in the middle of `create`.
+type HostChecker struct {
+	syscallHandler  utils.KernelSyscallHandler
+	appArmorManager *AppArmorManager
+}
+
+// CheckOption controls the host checks.
+type CheckOption struct {
+	BridgeInterface string
+}
+
+// Check runs all host checks and returns their results in order.
+//
+// The checks are:
+//  1. cgroup v2 mounted at /sys/fs/cgroup
+//  2. cpu/memory/pids controllers delegated to the raind cgroup
+//  3. overlayfs support
+//  4. user namespace sysctls
+//  5. AppArmor state and the raind-default profile
+//  6. seccomp syscall
+//  7. bridge interface
+//  8. nsenter/ip commands
+//  9. directory permissions under /etc/raind
+func (c *HostChecker) Check(opt CheckOption) []CheckResult {
+	var results []CheckResult
+	results = append(results, c.checkCgroupV2())
+	results = append(results, c.checkCgroupControllers())
+	results = append(results, c.checkOverlayfs())
+	results = append(results, c.checkUserNamespace())
+	results = append(results, c.checkAppArmor()...)
+	results = append(results, c.checkSeccomp())
+	results = append(results, c.checkBridge(opt.BridgeInterface))
+	results = append(results, c.checkCommand("nsenter"), c.checkCommand("ip"))
+	results = append(results, c.checkDirectories()...)
+	return results
+}
+
+func (c *HostChecker) checkCgroupV2() CheckResult {
+	res := CheckResult{Name: "cgroup_v2"}
+	var st unix.Statfs_t
+	if err := unix.Statfs("/sys/fs/cgroup", &st); err != nil {
+		res.Status = CheckFail
+		res.Detail = err.Error()
+		res.Hint = "mount cgroup2 at /sys/fs/cgroup"
+		return res
+	}
+	if st.Type != unix.CGROUP2_SUPER_MAGIC {
+		res.Status = CheckFail
+		res.Detail = "/sys/fs/cgroup is not cgroup2 (legacy or hybrid hierarchy)"
+		res.Hint = "boot with systemd.unified_cgroup_hierarchy=1"
+		return res
+	}
+	res.Status = CheckPass
+	res.Detail = "/sys/fs/cgroup is cgroup2"
+	return res
+}
+
+func (c *HostChecker) checkCgroupControllers() CheckResult {
+	res := CheckResult{Name: "cgroup_controllers"}
+	parent := filepath.Dir(utils.CgroupPath("_"))
+	b, err := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	if err != nil {
+		res.Status = CheckFail
+		res.Detail = err.Error()
+		res.Hint = "run scripts/setup/setup_cgroup.sh"
+		return res
+	}
+	enabled := strings.Fields(string(b))
+	var missing []string
+	for _, ctrl := range []string{"cpu", "memory", "pids"} {
+		if !containsString(enabled, ctrl) {
+			missing = append(missing, ctrl)
+		}
+	}
+	if len(missing) > 0 {
+		res.Status = CheckFail
+		res.Detail = fmt.Sprintf("%s: missing controllers: %s", parent, strings.Join(missing, ","))
+		res.Hint = fmt.Sprintf("echo \"+%s\" > %s/cgroup.subtree_control", strings.Join(missing, " +"), parent)
+		return res
+	}
+	res.Status = CheckPass
+	res.Detail = fmt.Sprintf("%s: %s", parent, strings.Join(enabled, ","))
+	return res
+}
+
+func (c *HostChecker) checkOverlayfs() CheckResult {
+	res := CheckResult{Name: "overlayfs"}
+	ok, err := c.hasFilesystem("overlay")
+	if err != nil {
+		res.Status = CheckFail
+		res.Detail = err.Error()
+		return res
+	}
+	if !ok {
+		res.Status = CheckFail
+		res.Detail = "overlay is not listed in /proc/filesystems"
+		res.Hint = "modprobe overlay (or use rootfsType=bind)"
+		return res
+	}
+	res.Status = CheckPass
+	return res
+}
+
+func (c *HostChecker) checkUserNamespace() CheckResult {
+	res := CheckResult{Name: "user_namespace"}
+	maxUserNs, err := c.readSysctlInt("/proc/sys/user/max_user_namespaces")
+	if err != nil {
+		res.Status = CheckFail
+		res.Detail = err.Error()
+		res.Hint = "enable CONFIG_USER_NS in the kernel"
+		return res
+	}
+	if maxUserNs <= 0 {
+		res.Status = CheckFail
+		res.Detail = "user.max_user_namespaces=0"
+		res.Hint = "sysctl -w user.max_user_namespaces=15000"
+		return res
+	}
+	res.Status = CheckPass
+	res.Detail = fmt.Sprintf("user.max_user_namespaces=%d", maxUserNs)
+	// Debian/Ubuntu specific knob
+	if v, err := c.readSysctlInt("/proc/sys/kernel/unprivileged_userns_clone"); err == nil && v == 0 {
+		res.Status = CheckWarn
+		res.Detail += ", kernel.unprivileged_userns_clone=0"
+		res.Hint = "sysctl -w kernel.unprivileged_userns_clone=1"
+	}
+	return res
+}
+
+func (c *HostChecker) checkAppArmor() []CheckResult {
+	state := CheckResult{Name: "apparmor"}
+	if !c.appArmorManager.isAAEnabled() {
+		state.Status = CheckWarn
+		state.Detail = "AppArmor is not enabled; apparmorProfile will be ignored"
+		return []CheckResult{state}
+	}
+	state.Status = CheckPass
+	state.Detail = "AppArmor is enabled"
+
+	profile := CheckResult{Name: "apparmor_profile"}
+	b, err := os.ReadFile("/sys/kernel/security/apparmor/profiles")
+	if err != nil {
+		profile.Status = CheckFail
+		profile.Detail = err.Error()
+		profile.Hint = "mount securityfs at /sys/kernel/security"
+		return []CheckResult{state, profile}
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "raind-default ") {
+			profile.Status = CheckPass
+			profile.Detail = strings.TrimSpace(line)
+			return []CheckResult{state, profile}
+		}
+	}
+	profile.Status = CheckFail
+	profile.Detail = "raind-default profile is not loaded"
+	profile.Hint = "apparmor_parser -r <raind-default profile>"
+	return []CheckResult{state, profile}
+}
+
+func (c *HostChecker) checkSeccomp() CheckResult {
+	res := CheckResult{Name: "seccomp"}
+	// SECCOMP_GET_ACTION_AVAIL reports whether the kernel supports the
+	// seccomp(2) syscall and the ERRNO action used by the deny filter.
+	const seccompGetActionAvail = 2
+	action := uint32(SECCOMP_RET_ERRNO)
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP,
+		uintptr(seccompGetActionAvail),
+		uintptr(0),
+		uintptr(unsafe.Pointer(&action)),
+	)
+	if errno != 0 {
+		res.Status = CheckFail
+		res.Detail = fmt.Sprintf("seccomp(SECCOMP_GET_ACTION_AVAIL) failed: %v", errno)
+		res.Hint = "enable CONFIG_SECCOMP_FILTER in the kernel"
+		return res
+	}
+	res.Status = CheckPass
+	return res
+}
+
+func (c *HostChecker) checkBridge(name string) CheckResult {
+	res := CheckResult{Name: "bridge_interface"}
+	if _, err := c.syscallHandler.Stat(filepath.Join("/sys/class/net", name, "bridge")); err != nil {
+		res.Status = CheckFail
+		res.Detail = fmt.Sprintf("bridge %s not found", name)
+		res.Hint = "run scripts/setup/setup_network.sh"
+		return res
+	}
+	b, err := os.ReadFile(filepath.Join("/sys/class/net", name, "operstate"))
+	if err == nil && strings.TrimSpace(string(b)) == "down" {
+		res.Status = CheckWarn
+		res.Detail = fmt.Sprintf("bridge %s is down", name)
+		res.Hint = fmt.Sprintf("ip link set %s up", name)
+		return res
+	}
+	res.Status = CheckPass
+	res.Detail = name
+	return res
+}
+
+func (c *HostChecker) checkCommand(name string) CheckResult {
+	res := CheckResult{Name: "command_" + name}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		res.Status = CheckFail
+		res.Detail = fmt.Sprintf("%s not found in PATH", name)
+		res.Hint = "install util-linux (nsenter) and iproute2 (ip)"
+		return res
+	}
+	res.Status = CheckPass
+	res.Detail = path
+	return res
+}
+
+// checkDirectories verifies that the runtime directories exist and are
+// not writable by group/others, since their contents are trusted.
+func (c *HostChecker) checkDirectories() []CheckResult {
+	return []CheckResult{
+		c.checkDirectory("root_directory", utils.DefaultRootDir()),
+		c.checkDirectory("audit_log_directory", filepath.Dir(utils.AuditLog)),
+	}
+}
+
+// checkDirectory checks a single runtime directory. The name is stable;
+// the path is reported in the detail.
+func (c *HostChecker) checkDirectory(name string, dir string) CheckResult {
+	res := CheckResult{Name: name}
+	fi, err := c.syscallHandler.Stat(dir)
+	if err != nil {
+		res.Status = CheckFail
+		res.Detail = err.Error()
+		res.Hint = fmt.Sprintf("mkdir -p -m 0711 %s", dir)
+		return res
+	}
+	if !fi.IsDir() {
+		res.Status = CheckFail
+		res.Detail = fmt.Sprintf("%s: not a directory", dir)
+		return res
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Uid != 0 {
+		res.Status = CheckFail
+		res.Detail = fmt.Sprintf("%s: owned by uid %d", dir, st.Uid)
+		res.Hint = fmt.Sprintf("chown root:root %s", dir)
+		return res
+	}
+	if fi.Mode().Perm()&0o022 != 0 {
+		res.Status = CheckFail
+		res.Detail = fmt.Sprintf("%s: mode %s is group/world writable", dir, fi.Mode().Perm())
+		res.Hint = fmt.Sprintf("chmod go-w %s", dir)
+		return res
+	}
+	res.Status = CheckPass
+	res.Detail = fmt.Sprintf("%s: mode %s", dir, fi.Mode().Perm())
+	return res
+}
+
+func (c *HostChecker) hasFilesystem(fstype string) (bool, error) {
+	f, err := os.Open("/proc/filesystems")
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[len(fields)-1] == fstype {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (c *HostChecker) readSysctlInt(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
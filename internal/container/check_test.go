@@ -0,0 +1,171 @@
+package container
+
+import (
+	"droplet/internal/utils"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStatSyscall answers Stat for the paths in found and fails for the
+// others.
+type fakeStatSyscall struct {
+	utils.KernelSyscallHandler
+	found map[string]os.FileInfo
+}
+
+func (f *fakeStatSyscall) Stat(path string) (os.FileInfo, error) {
+	if fi, ok := f.found[path]; ok {
+		return fi, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func TestHostChecker_CheckNamesAreStable(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	c := NewHostChecker()
+
+	// == act ==
+	results := c.Check(CheckOption{BridgeInterface: "raind0"})
+
+	// == assert ==
+	valid := regexp.MustCompile(`^[a-z0-9_]+$`)
+	seen := map[string]bool{}
+	for _, r := range results {
+		assert.Regexp(t, valid, r.Name)
+		assert.False(t, seen[r.Name], "duplicate check name %s", r.Name)
+		seen[r.Name] = true
+	}
+	assert.True(t, seen["root_directory"])
+	assert.True(t, seen["audit_log_directory"])
+}
+
+func TestHostChecker_CheckDirectory(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	c := &HostChecker{syscallHandler: utils.NewSyscallHandler()}
+
+	tests := []struct {
+		name       string
+		setup      func(path string)
+		wantStatus string
+		wantDetail string
+	}{
+		{
+			name:       "pass",
+			setup:      func(path string) { assert.Nil(t, os.Mkdir(path, 0711)) },
+			wantStatus: CheckPass,
+			wantDetail: ": mode -rwx--x--x",
+		},
+		{
+			name:       "missing",
+			setup:      func(path string) {},
+			wantStatus: CheckFail,
+			wantDetail: ": no such file or directory",
+		},
+		{
+			name:       "not a directory",
+			setup:      func(path string) { assert.Nil(t, os.WriteFile(path, nil, 0600)) },
+			wantStatus: CheckFail,
+			wantDetail: ": not a directory",
+		},
+		{
+			name: "not owned by root",
+			setup: func(path string) {
+				assert.Nil(t, os.Mkdir(path, 0711))
+				assert.Nil(t, os.Chown(path, 1000, 1000))
+			},
+			wantStatus: CheckFail,
+			wantDetail: ": owned by uid 1000",
+		},
+		{
+			name: "group writable",
+			setup: func(path string) {
+				assert.Nil(t, os.Mkdir(path, 0700))
+				assert.Nil(t, os.Chmod(path, 0770))
+			},
+			wantStatus: CheckFail,
+			wantDetail: ": mode -rwxrwx--- is group/world writable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// == arrange ==
+			dir := filepath.Join(t.TempDir(), "container")
+			tt.setup(dir)
+
+			// == act ==
+			res := c.checkDirectory("root_directory", dir)
+
+			// == assert ==
+			assert.Equal(t, "root_directory", res.Name)
+			assert.Equal(t, tt.wantStatus, res.Status)
+			assert.Contains(t, res.Detail, dir)
+			assert.Contains(t, res.Detail, tt.wantDetail)
+		})
+	}
+}
+
+func TestHostChecker_CheckCommand(t *testing.T) {
+	// == arrange ==
+	bin := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(bin, "nsenter"), []byte("#!/bin/sh\n"), 0755))
+	t.Setenv("PATH", bin)
+	c := &HostChecker{}
+
+	// == act ==
+	found := c.checkCommand("nsenter")
+	missing := c.checkCommand("ip")
+
+	// == assert ==
+	assert.Equal(t, CheckResult{Name: "command_nsenter", Status: CheckPass, Detail: filepath.Join(bin, "nsenter")}, found)
+	assert.Equal(t, "command_ip", missing.Name)
+	assert.Equal(t, CheckFail, missing.Status)
+	assert.Equal(t, "ip not found in PATH", missing.Detail)
+}
+
+func TestHostChecker_CheckBridge(t *testing.T) {
+	// == arrange ==
+	fi, err := os.Stat(t.TempDir())
+	assert.Nil(t, err)
+	c := &HostChecker{syscallHandler: &fakeStatSyscall{
+		found: map[string]os.FileInfo{"/sys/class/net/droplet-test0/bridge": fi},
+	}}
+
+	// == act ==
+	found := c.checkBridge("droplet-test0")
+	missing := c.checkBridge("droplet-test1")
+
+	// == assert ==
+	assert.Equal(t, CheckResult{Name: "bridge_interface", Status: CheckPass, Detail: "droplet-test0"}, found)
+	assert.Equal(t, "bridge_interface", missing.Name)
+	assert.Equal(t, CheckFail, missing.Status)
+	assert.Equal(t, "bridge droplet-test1 not found", missing.Detail)
+	assert.Equal(t, "run scripts/setup/setup_network.sh", missing.Hint)
+}
+
+func TestHostChecker_ReadSysctlInt(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "max_user_namespaces")
+	invalid := filepath.Join(dir, "invalid")
+	assert.Nil(t, os.WriteFile(valid, []byte("15000\n"), 0644))
+	assert.Nil(t, os.WriteFile(invalid, []byte("on\n"), 0644))
+	c := &HostChecker{}
+
+	// == act ==
+	n, validErr := c.readSysctlInt(valid)
+	_, invalidErr := c.readSysctlInt(invalid)
+	_, missingErr := c.readSysctlInt(filepath.Join(dir, "missing"))
+
+	// == assert ==
+	assert.Nil(t, validErr)
+	assert.Equal(t, 15000, n)
+	assert.NotNil(t, invalidErr)
+	assert.NotNil(t, missingErr)
+}
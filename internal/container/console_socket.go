@@ -0,0 +1,70 @@
+package container
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"droplet/internal/utils"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// consolePty is a pseudo-terminal whose master is handed to the caller
+// over the --console-socket unix socket instead of being proxied by the shim.
+type consolePty struct {
+	ptmx *os.File
+	tty  *os.File
+}
+
+// openConsolePty allocates a new pseudo-terminal pair.
+func openConsolePty() (*consolePty, error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &consolePty{ptmx: ptmx, tty: tty}, nil
+}
+
+// attach connects the stdio of cmd to the pty slave and makes it the
+// controlling terminal of a new session.
+func (c *consolePty) attach(cmd utils.CommandExecutor, sysProcAttr *syscall.SysProcAttr) {
+	cmd.SetStdin(c.tty)
+	cmd.SetStdout(c.tty)
+	cmd.SetStderr(c.tty)
+	sysProcAttr.Setsid = true
+	sysProcAttr.Setctty = true
+	sysProcAttr.Ctty = 0
+}
+
+// sendTo sends the pty master to the unix socket at socketPath using
+// SCM_RIGHTS. The pty name is sent as the message payload, following the
+// runc console socket protocol. Both ends are closed locally afterwards.
+func (c *consolePty) sendTo(socketPath string) error {
+	defer c.close()
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("dial console socket: %w", err)
+	}
+	defer conn.Close()
+
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("console socket is not a unix socket: %s", socketPath)
+	}
+
+	oob := unix.UnixRights(int(c.ptmx.Fd()))
+	if _, _, err := uc.WriteMsgUnix([]byte(c.ptmx.Name()), oob, nil); err != nil {
+		return fmt.Errorf("send console fd: %w", err)
+	}
+	return nil
+}
+
+// close closes both ends of the pty held by this process.
+func (c *consolePty) close() {
+	_ = c.tty.Close()
+	_ = c.ptmx.Close()
+}
@@ -0,0 +1,96 @@
+package container
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// shortTempDir returns a temporary directory with a path short enough for
+// a unix socket.
+func shortTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "droplet")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func TestConsolePty_SendTo(t *testing.T) {
+	// == arrange ==
+	socketPath := filepath.Join(shortTempDir(t), "console.sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	assert.Nil(t, err)
+	defer ln.Close()
+	console, err := openConsolePty()
+	assert.Nil(t, err)
+	name := console.ptmx.Name()
+	ptmxStat, err := console.ptmx.Stat()
+	assert.Nil(t, err)
+
+	type received struct {
+		payload string
+		fds     []int
+		err     error
+	}
+	ch := make(chan received, 1)
+	go func() {
+		conn, err := ln.AcceptUnix()
+		if err != nil {
+			ch <- received{err: err}
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 256)
+		oob := make([]byte, unix.CmsgSpace(4))
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			ch <- received{err: err}
+			return
+		}
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(msgs) != 1 {
+			ch <- received{err: err}
+			return
+		}
+		fds, err := unix.ParseUnixRights(&msgs[0])
+		ch <- received{payload: string(buf[:n]), fds: fds, err: err}
+	}()
+
+	// == act ==
+	err = console.sendTo(socketPath)
+	got := <-ch
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Nil(t, got.err)
+	assert.Equal(t, name, got.payload)
+	assert.Len(t, got.fds, 1)
+	// the received descriptor is the pty master
+	master := os.NewFile(uintptr(got.fds[0]), "ptmx")
+	defer master.Close()
+	masterStat, err := master.Stat()
+	assert.Nil(t, err)
+	assert.True(t, os.SameFile(ptmxStat, masterStat))
+	// the local ends are closed
+	_, err = console.ptmx.Stat()
+	assert.NotNil(t, err)
+}
+
+func TestConsolePty_SendToMissingSocket(t *testing.T) {
+	// == arrange ==
+	console, err := openConsolePty()
+	assert.Nil(t, err)
+
+	// == act ==
+	err = console.sendTo(filepath.Join(shortTempDir(t), "missing.sock"))
+
+	// == assert ==
+	assert.ErrorContains(t, err, "dial console socket")
+	_, err = console.tty.Stat()
+	assert.NotNil(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"droplet/internal/hook"
@@ -28,6 +29,7 @@ func NewContainerCreator() *ContainerCreator {
 		containerCgroupPreparer:  newContainerCgroupController(),
 		containerStatusManager:   status.NewStatusHandler(),
 		containerHookController:  hook.NewHookController(),
+		containerTeardownHandler: newContainerTeardown(),
 	}
 }
 
@@ -46,15 +48,21 @@ func newContainerInitExecutor() *containerInitExecutor {
 //
 // The flow currently consists of:
 //
-//  1. Loading the OCI spec (config.json)
+//  1. Loading the OCI spec (config.json) from the bundle, pinning its hash
+//     and merging hooks from the hooks directory
 //  2. Creating the initial state.json (status=creating, pid=0)
 //  3. Running createRuntime hooks
 //  4. Creating the FIFO used for init synchronization
-//  5. Launching the init process via the init subcommand
+//  5. Launching the init process through the shim, or directly when the
+//     caller provides a console socket
 //  6. Configuring cgroups for the init process
 //  7. Configuring network for the init process
 //  8. Updating state.json (status=created, pid=init pid)
-//  9. Running createContainer hooks
+//  9. Writing the --pid-file if requested
+//  10. Running createContainer hooks
+//
+// If a createRuntime or createContainer hook fails, the container is torn
+// down before the error is returned, as required by the OCI runtime spec.
 //
 // Each step is delegated to an interface to allow testing and substitution.
 type ContainerCreator struct {
@@ -65,6 +73,7 @@ type ContainerCreator struct {
 	containerCgroupPreparer  containerCgroupPreparer
 	containerStatusManager   status.ContainerStatusManager
 	containerHookController  hook.ContainerHookController
+	containerTeardownHandler containerTeardownHandler
 }
 
 // Create executes the container creation pipeline for the given container ID.
@@ -81,10 +90,12 @@ type ContainerCreator struct {
 // its collaborators. If any step fails, the error is returned immediately.
 func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 	var (
-		spec  spec.Spec
-		event = "create"
-		stage string
-		pid   int
+		spec   spec.Spec
+		event  = "create"
+		stage  string
+		pid    int
+		merged []hook.MergedHook
+		bundle string
 	)
 
 	// audit log
@@ -95,18 +106,52 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 		}
 		_ = logs.RecordAuditLog(logs.AuditRecord{
 			ContainerId: opt.ContainerId,
+			Bundle:      bundle,
 			Event:       event,
 			Stage:       stage,
 			Pid:         pid,
 			Spec:        &spec,
+			MergedHooks: auditMergedHooks(merged),
 			Result:      result,
 			Error:       err,
 		})
 	}()
 
-	// 1. load config.json
+	// validate the process options before anything is created
+	stage = "prepare_init_option"
+	initOpt, err := newInitProcessOption(opt.TtyFlag, opt.PreserveFds, opt.NoPivot, opt.NoNewKeyring, opt.ConsoleSocket)
+	if err != nil {
+		return err
+	}
+
+	// 1. load config.json from bundle, pin its hash and merge hooks.d
+	stage = "prepare_container_dir"
+	err = c.prepareContainerDir(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	stage = "lock"
+	lock, err := lockContainer(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	stage = "check_exists"
+	err = checkContainerNotExists(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	bundle, err = resolveBundle(opt.ContainerId, opt.Bundle)
+	if err != nil {
+		return err
+	}
 	stage = "load_spec"
-	spec, err = c.specSecureLoad(opt.ContainerId)
+	spec, err = loadAndPinSpec(c.specLoader, opt.ContainerId, bundle)
+	if err != nil {
+		return err
+	}
+	stage = "merge_hooks_dir"
+	merged, err = mergeHooksDir(opt.ContainerId, opt.HooksDir, &spec)
 	if err != nil {
 		return err
 	}
@@ -120,7 +165,7 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 		0,
 		status.CREATING,
 		spec.Root.Path,
-		utils.ContainerDir(opt.ContainerId),
+		bundle,
 		spec.Annotations,
 	)
 	if err != nil {
@@ -134,7 +179,7 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 		spec.Hooks.CreateRuntime,
 	)
 	if err != nil {
-		return err
+		return abortWithTeardown(c.containerTeardownHandler, opt.ContainerId, spec, err)
 	}
 
 	// 4. create fifo
@@ -150,16 +195,28 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 		initPid int
 		shimPid int
 	)
-	if opt.TtyFlag {
+	if initOpt.consoleSocket != "" {
+		// the caller owns the pty master; no shim is started
+		stage = "execute_init"
+		pid, err = c.processExecutor.executeInit(opt.ContainerId, spec, fifo, initOpt)
+		if err != nil {
+			return err
+		}
+		initPid = pid
+	} else {
+		// the shim holds the stdio of init: a pty with --tty, pipes
+		// otherwise
+		initOpt.noTty = !opt.TtyFlag
+
 		// cleanup old files before execute shim
 		stage = "cleanup_shim_file"
-		err = c.cleanupShimFile(opt.ContainerId)
+		err = cleanupShimFile(opt.ContainerId)
 		if err != nil {
 			return err
 		}
 
 		stage = "execute_shim"
-		pid, err = c.processExecutor.executeShim(opt.ContainerId, spec, fifo)
+		pid, err = c.processExecutor.executeShim(opt.ContainerId, spec, fifo, initOpt)
 		if err != nil {
 			return err
 		}
@@ -167,18 +224,11 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 
 		// wait for pidfile from shim
 		stage = "wait_init_pid"
-		initPid, err = c.waitInitPid(opt.ContainerId, 3*time.Second, 20*time.Millisecond)
+		initPid, err = waitInitPid(opt.ContainerId, 3*time.Second, 20*time.Millisecond)
 		if err != nil {
 			return err
 		}
 		pid = initPid
-	} else {
-		stage = "execute_init"
-		pid, err = c.processExecutor.executeInit(opt.ContainerId, spec, fifo)
-		if err != nil {
-			return err
-		}
-		initPid = pid
 	}
 
 	// 6. cgroup setup
@@ -209,69 +259,38 @@ func (c *ContainerCreator) Create(opt CreateOption) (err error) {
 		return err
 	}
 
-	// 9. HOOK: createContainer
+	// 9. write pid file (--pid-file)
+	if opt.PidFile != "" {
+		stage = "write_pid_file"
+		err = utils.WritePidFile(opt.PidFile, initPid)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 10. HOOK: createContainer
 	stage = "hook_create_container"
 	err = c.containerHookController.RunCreateContainerHooks(
 		opt.ContainerId,
 		spec.Hooks.CreateContainer,
 	)
 	if err != nil {
-		return err
+		return abortWithTeardown(c.containerTeardownHandler, opt.ContainerId, spec, err)
 	}
 	return nil
 }
 
-func (c *ContainerCreator) specSecureLoad(containerId string) (spec.Spec, error) {
-	fileHashPath := utils.ConfigFileHashPath(containerId)
-
-	// 1. calculate current config.json file hash
-	beforeLoadedHash, err := utils.Sha256File(utils.ConfigFilePath(containerId))
-	if err != nil {
-		return spec.Spec{}, err
-	}
-
-	// 2. write to file
-	if err := utils.WriteJsonToFile(
-		fileHashPath,
-		spec.SpecHash{
-			Sha256: beforeLoadedHash,
-		},
-	); err != nil {
-		return spec.Spec{}, err
-	}
-
-	// 3. load config.json
-	specFile, err := c.specLoader.loadFile(containerId)
-	if err != nil {
-		return spec.Spec{}, err
-	}
-
-	// 4. re-calculate config.json file hash
-	afterLoadedHash, err := utils.Sha256File(utils.ConfigFilePath(containerId))
-	if err != nil {
-		return spec.Spec{}, err
-	}
-
-	// 5. load file sha256 from file
-	var specFileHash spec.SpecHash
-	if err := utils.ReadJsonFile(
-		fileHashPath,
-		&specFileHash,
-	); err != nil {
-		return spec.Spec{}, err
-	}
-
-	// 6. assert
-	// protect hash value tampering
-	if beforeLoadedHash != specFileHash.Sha256 {
-		return spec.Spec{}, fmt.Errorf("config.json hash validation failed: expect=%s, got=%s", beforeLoadedHash, specFileHash.Sha256)
+// prepareContainerDir creates the container state directory and its log
+// directory. Bundles produced by other tools do not ship these directories,
+// so they are created on demand.
+func (c *ContainerCreator) prepareContainerDir(containerId string) error {
+	if err := os.MkdirAll(utils.ContainerDir(containerId), 0o711); err != nil {
+		return err
 	}
-	// protect config.json tampering
-	if specFileHash.Sha256 != afterLoadedHash {
-		return spec.Spec{}, fmt.Errorf("config.json hash validation failed: expect=%s, got=%s", specFileHash.Sha256, afterLoadedHash)
+	if err := os.MkdirAll(utils.LogDir(containerId), 0o750); err != nil {
+		return err
 	}
-
-	return specFile, nil
+	return nil
 }
 
 // processExecutor defines the behavior for spawning the container init process.
@@ -279,8 +298,8 @@ func (c *ContainerCreator) specSecureLoad(containerId string) (spec.Spec, error)
 // It is an interface so that the behavior can be mocked in tests and
 // replaced by alternative implementations if needed.
 type processExecutor interface {
-	executeInit(containerId string, spec spec.Spec, fifo string) (int, error)
-	executeShim(containerId string, spec spec.Spec, fifo string) (int, error)
+	executeInit(containerId string, spec spec.Spec, fifo string, opt initProcessOption) (int, error)
+	executeShim(containerId string, spec spec.Spec, fifo string, opt initProcessOption) (int, error)
 }
 
 // containerInitExecutor is the default implementation of processExecutor.
@@ -298,43 +317,81 @@ type containerInitExecutor struct {
 // with the appropriate namespace and process attributes applied. The FIFO
 // path is passed as an argument so that the init process can synchronize
 // with the runtime before proceeding.
-func (c *containerInitExecutor) executeInit(containerId string, spec spec.Spec, fifo string) (int, error) {
+//
+// If opt.consoleSocket is set, the init stdio is connected to a new pty
+// whose master is sent to the console socket. Otherwise stdout/stderr are
+// written to the init log file.
+func (c *containerInitExecutor) executeInit(containerId string, spec spec.Spec, fifo string, opt initProcessOption) (int, error) {
 	// retrieve entrypoint from spec
 	entrypoint := spec.Process.Args
 
 	// prepare init subcommand
-	initArgs := append([]string{"init", containerId, fifo}, entrypoint...)
+	initArgs := buildInitArgs("init", containerId, fifo, entrypoint, opt)
 	cmd := c.commandFactory.Command(os.Args[0], initArgs...)
-	// set stdout/stderr to log files
-	logPath := utils.InitLogPath(containerId)
-	f, err := c.syscallHandler.OpenFile(logPath, os.O_CREATE|os.O_WRONLY, 0640)
-	if err != nil {
-		return -1, err
-	}
-	cmd.SetStdout(f)
-	cmd.SetStderr(f)
+	cmd.SetExtraFiles(opt.extraFiles())
 
 	// apply SysProcAttr
 	nsConfig := buildNamespaceConfig(spec)
 	procAttr := buildProcAttrForRootContainer(nsConfig)
 	sysProcAttr := buildSysProcAttr(procAttr)
+
+	var console *consolePty
+	if opt.consoleSocket != "" {
+		// set stdio to pty
+		p, err := openConsolePty()
+		if err != nil {
+			return -1, err
+		}
+		console = p
+		console.attach(cmd, sysProcAttr)
+	} else {
+		// set stdout/stderr to log files
+		logPath := utils.InitLogPath(containerId)
+		f, err := c.syscallHandler.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return -1, err
+		}
+		cmd.SetStdout(f)
+		cmd.SetStderr(f)
+	}
 	cmd.SetSysProcAttr(sysProcAttr)
 
 	// execute init subcommand
 	if err := cmd.Start(); err != nil {
+		if console != nil {
+			console.close()
+		}
 		return -1, err
 	}
 
+	// hand over pty master to the caller
+	if console != nil {
+		if err := console.sendTo(opt.consoleSocket); err != nil {
+			killStartedInit(cmd)
+			return -1, err
+		}
+	}
+
 	return cmd.Pid(), nil
 }
 
-func (c *containerInitExecutor) executeShim(containerId string, spec spec.Spec, fifo string) (int, error) {
+// killStartedInit kills and reaps an init process that was started but
+// cannot be handed over, e.g. because its console could not be sent. The
+// process is a child that was not waited for yet, so its pid cannot have
+// been reused.
+func killStartedInit(cmd utils.CommandExecutor) {
+	_ = syscall.Kill(cmd.Pid(), syscall.SIGKILL)
+	_ = cmd.Wait()
+}
+
+func (c *containerInitExecutor) executeShim(containerId string, spec spec.Spec, fifo string, opt initProcessOption) (int, error) {
 	// retrieve entrypoint from spec
 	entrypoint := spec.Process.Args
 
 	// prepare shim subcommand
-	shimArgs := append([]string{"shim", containerId, fifo}, entrypoint...)
+	shimArgs := buildInitArgs("shim", containerId, fifo, entrypoint, opt)
 	cmd := c.commandFactory.Command(os.Args[0], shimArgs...)
+	cmd.SetExtraFiles(opt.extraFiles())
 
 	// execute init subcommand
 	if err := cmd.Start(); err != nil {
@@ -344,14 +401,14 @@ func (c *containerInitExecutor) executeShim(containerId string, spec spec.Spec,
 	return cmd.Pid(), nil
 }
 
-func (c *ContainerCreator) waitInitPid(containerId string, timeout time.Duration, pollInterval time.Duration) (int, error) {
+func waitInitPid(containerId string, timeout time.Duration, pollInterval time.Duration) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	return c.waitInitPidContext(ctx, containerId, pollInterval)
+	return waitInitPidContext(ctx, containerId, pollInterval)
 }
 
 // WaitInitPidContext is the context-aware variant.
-func (c *ContainerCreator) waitInitPidContext(ctx context.Context, containerId string, pollInterval time.Duration) (int, error) {
+func waitInitPidContext(ctx context.Context, containerId string, pollInterval time.Duration) (int, error) {
 	if pollInterval <= 0 {
 		pollInterval = 20 * time.Millisecond
 	}
@@ -363,7 +420,7 @@ func (c *ContainerCreator) waitInitPidContext(ctx context.Context, containerId s
 	defer ticker.Stop()
 
 	// Try immediately once (fast path).
-	if pid, ok := c.tryReadPidFile(pidPath); ok {
+	if pid, ok := tryReadPidFile(pidPath); ok {
 		return pid, nil
 	}
 
@@ -373,7 +430,7 @@ func (c *ContainerCreator) waitInitPidContext(ctx context.Context, containerId s
 			// include last error context if desired; minimal version keeps it simple
 			return -1, fmt.Errorf("wait init pid timeout: %w", ctx.Err())
 		case <-ticker.C:
-			if pid, ok := c.tryReadPidFile(pidPath); ok {
+			if pid, ok := tryReadPidFile(pidPath); ok {
 				return pid, nil
 			}
 		}
@@ -383,7 +440,7 @@ func (c *ContainerCreator) waitInitPidContext(ctx context.Context, containerId s
 // tryReadPidFile reads pidfile and parses an int PID.
 // Returns (pid, true) only when fully valid.
 // Any transient failure returns (_, false).
-func (c *ContainerCreator) tryReadPidFile(path string) (int, bool) {
+func tryReadPidFile(path string) (int, bool) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return -1, false
@@ -406,7 +463,7 @@ func (c *ContainerCreator) tryReadPidFile(path string) (int, bool) {
 	return pid, true
 }
 
-func (c *ContainerCreator) cleanupShimFile(containerId string) error {
+func cleanupShimFile(containerId string) error {
 	// remove sockefile
 	_ = os.Remove(utils.SockPath(containerId))
 	// remove pid file
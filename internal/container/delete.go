@@ -7,6 +7,8 @@ import (
 	"droplet/internal/status"
 	"droplet/internal/utils"
 	"fmt"
+	"os"
+	"syscall"
 )
 
 // NewContainerDelete constructs a ContainerDelete with the default
@@ -50,9 +52,11 @@ type ContainerDelete struct {
 //  3. Run poststop hooks
 //  4. Remove the container state file (state.json)
 //  5. Remove the FIFO if the container status is created
+//  6. Discard the volatile rootfs (overlay-volatile only)
 //
 // If any step fails, the error is returned immediately and subsequent
-// steps are not executed.
+// steps are not executed. The exception is a poststop hook failure,
+// which is returned only after the container has been removed.
 func (c *ContainerDelete) Delete(opt DeleteOption) (err error) {
 	var (
 		spec  spec.Spec
@@ -78,6 +82,14 @@ func (c *ContainerDelete) Delete(opt DeleteOption) (err error) {
 		})
 	}()
 
+	// serialize with the other lifecycle commands
+	stage = "lock"
+	lock, err := lockContainer(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	// 1. check container status
 	stage = "get_status"
 	containerStatus, err := c.containerStatusManager.GetStatusFromId(opt.ContainerId)
@@ -108,14 +120,13 @@ func (c *ContainerDelete) Delete(opt DeleteOption) (err error) {
 	}
 
 	// 3. HOOK: poststop
+	//    a failing poststop hook must not leave an undeletable container,
+	//    so its error is returned after the container has been removed
 	stage = "hook_poststop"
-	err = c.containerHookController.RunPoststopHooks(
+	hookErr := c.containerHookController.RunPoststopHooks(
 		opt.ContainerId,
 		spec.Hooks.Poststop,
 	)
-	if err != nil {
-		return err
-	}
 
 	// 4. remove state.json
 	stage = "remove_state"
@@ -133,17 +144,54 @@ func (c *ContainerDelete) Delete(opt DeleteOption) (err error) {
 		}
 	}
 
+	// 6. discard volatile rootfs
+	stage = "remove_volatile_rootfs"
+	err = removeVolatileRootfs(c.syscallHandler, opt.ContainerId)
+	if err != nil {
+		return err
+	}
+
+	// 7. report poststop hook failure (io.raind.hooks.onFailure=abort)
+	if hookErr != nil {
+		stage = "hook_poststop"
+		return hookErr
+	}
+
+	return nil
+}
+
+// removeVolatileRootfs discards the tmpfs backed upper/work directories
+// used by the overlay-volatile rootfs type.
+//
+// Only that rootfs type creates utils.VolatileDir, so the directory is
+// removed whenever it exists; the image config annotation is not consulted,
+// as a container with an invalid one must still be removable.
+// The tmpfs normally disappears together with the container mount
+// namespace; the lazy unmount only covers the case where it leaked.
+func removeVolatileRootfs(syscallHandler utils.KernelSyscallHandler, containerId string) error {
+	volatileDir := utils.VolatileDir(containerId)
+	if _, err := os.Lstat(volatileDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	_ = syscallHandler.Unmount(volatileDir, syscall.MNT_DETACH)
+	if err := os.RemoveAll(volatileDir); err != nil {
+		return err
+	}
 	return nil
 }
 
 func (c *ContainerDelete) killInitProcess(containerId string) error {
-	containerPid, containerPidErr := c.containerStatusManager.GetPidFromId(containerId)
-	if containerPidErr != nil {
-		return containerPidErr
+	procIdentity, err := c.containerStatusManager.GetProcIdentityFromId(containerId)
+	if err != nil {
+		return err
 	}
 
 	// 1. send signal to pid
-	if err := c.syscallHandler.Kill(containerPid, signalMap["KILL"]); err != nil {
+	//    an init that is gone, or whose pid was reused, needs no kill
+	if err := procIdentity.Signal(signalMap["KILL"]); err != nil && err != syscall.ESRCH {
 		return err
 	}
 
@@ -117,7 +117,7 @@ func (c *ContainerExec) executeNsenter(containerPid int, opt ExecOption) error {
 	cmd := c.commandFactory.Command(commandStr[0], commandStr[1:]...)
 	// set stdout/stderr to log files
 	logPath := utils.ExecLogPath(opt.ContainerId)
-	f, err := c.syscallHandler.OpenFile(logPath, os.O_CREATE|os.O_WRONLY, 0640)
+	f, err := c.syscallHandler.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,179 @@
+package container
+
+import (
+	"droplet/internal/hook"
+	"droplet/internal/logs"
+	"droplet/internal/oci"
+	"droplet/internal/spec"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// supportedMountOptions lists the mount options understood by
+// mountFilesystem. Options not listed here are passed to the filesystem
+// as mount data.
+var supportedMountOptions = []string{
+	"bind",
+	"noatime",
+	"nodev",
+	"noexec",
+	"nosuid",
+	"rbind",
+	"relatime",
+	"ro",
+	"rprivate",
+	"rw",
+	"strictatime",
+}
+
+// supportedHooks lists the lifecycle hooks executed by the runtime, one
+// per Run*Hooks method of hook.ContainerHookController. prestart hooks of
+// config.json are not run.
+var supportedHooks = []string{
+	"createRuntime",
+	"createContainer",
+	"startContainer",
+	"poststart",
+	"stopContainer",
+	"poststop",
+}
+
+// supportedNamespaces lists the namespace types handled by
+// buildNamespaceConfig.
+var supportedNamespaces = []string{
+	"cgroup",
+	"ipc",
+	"mount",
+	"network",
+	"pid",
+	"uts",
+	"user",
+}
+
+// NewContainerFeatures constructs a ContainerFeatures with the default
+// AppArmor handler, which is used to report AppArmor availability.
+func NewContainerFeatures() *ContainerFeatures {
+	return &ContainerFeatures{
+		appArmorManager: NewAppArmorManager(),
+	}
+}
+
+// ContainerFeatures reports the OCI features supported by this build
+// (the `features` command).
+type ContainerFeatures struct {
+	appArmorManager *AppArmorManager
+}
+
+// Features builds the OCI features document.
+//
+// Static capabilities of the runtime (namespaces, capabilities, seccomp
+// actions, mount options, hooks) are reported as implemented; AppArmor
+// availability reflects the current host.
+func (c *ContainerFeatures) Features() spec.Features {
+	enabled := true
+	disabled := false
+	appArmorEnabled := c.appArmorManager.isAAEnabled()
+
+	// capabilities
+	caps := make([]string, 0, len(capNameMap))
+	for name := range capNameMap {
+		caps = append(caps, name)
+	}
+	slices.Sort(caps)
+
+	// seccomp archs (only the native arch is accepted by the filter)
+	var archs []string
+	if arch := c.seccompArch(runtime.GOARCH); arch != "" {
+		archs = append(archs, arch)
+	}
+
+	return spec.Features{
+		OciVersionMin: oci.OCIVersionMin,
+		OciVersionMax: oci.OCIVersion,
+		Hooks:         supportedHooks,
+		MountOptions:  supportedMountOptions,
+		Linux: &spec.LinuxFeatures{
+			Namespaces:   supportedNamespaces,
+			Capabilities: caps,
+			Cgroup: &spec.CgroupFeatures{
+				V1:          &disabled,
+				V2:          &enabled,
+				Systemd:     &disabled,
+				SystemdUser: &disabled,
+				Rdma:        &disabled,
+			},
+			Seccomp: &spec.SeccompFeatures{
+				Enabled: &enabled,
+				Actions: []string{
+					"SCMP_ACT_ALLOW",
+					"SCMP_ACT_ERRNO",
+				},
+				// argument filtering is not supported
+				Operators:      []string{},
+				Archs:          archs,
+				KnownFlags:     []string{},
+				SupportedFlags: []string{},
+			},
+			Apparmor: &spec.LsmFeatures{
+				Enabled: &appArmorEnabled,
+			},
+			Selinux: &spec.LsmFeatures{
+				Enabled: &disabled,
+			},
+			IntelRdt: &spec.LsmFeatures{
+				Enabled: &disabled,
+			},
+		},
+		Annotations: c.annotations(),
+	}
+}
+
+// annotations reports the droplet annotations read from config.json, with
+// their accepted values where they are a fixed set, and the informational
+// keys for the rootfs types and cgroup controllers.
+func (c *ContainerFeatures) annotations() map[string]string {
+	return map[string]string{
+		spec.AnnotationKeyVersion: oci.AnnotationVersion,
+		spec.AnnotationKeyNet:     "supported",
+		spec.AnnotationKeyImage:   "supported",
+		spec.AnnotationKeyImage + ".rootfsType": strings.Join([]string{
+			spec.RootfsTypeBind,
+			spec.RootfsTypeOverlay,
+			spec.RootfsTypeOverlayVolatile,
+		}, ","),
+		spec.AnnotationKeyHooksOnFailure: strings.Join([]string{
+			string(hook.FailureAbort),
+			string(hook.FailureWarn),
+			string(hook.FailureIgnore),
+		}, ","),
+		spec.AnnotationKeyHooksParallel: "supported",
+		spec.AnnotationKeyAttachInput: strings.Join([]string{
+			string(InputPolicyFirstWriter),
+			string(InputPolicyAll),
+			string(InputPolicyReadOnly),
+		}, ","),
+		spec.AnnotationKeyLogFormat: strings.Join([]string{
+			string(logs.ConsoleLogRaw),
+			string(logs.ConsoleLogJSON),
+			string(logs.ConsoleLogCRI),
+		}, ","),
+		spec.AnnotationKeyLogMaxSize:  "supported",
+		spec.AnnotationKeyLogMaxFiles: "supported",
+		"io.raind.cgroup.controllers": "cpu,memory,pids",
+	}
+}
+
+// seccompArch returns the OCI seccomp architecture name for goarch.
+func (c *ContainerFeatures) seccompArch(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "SCMP_ARCH_X86_64"
+	case "arm64":
+		return "SCMP_ARCH_AARCH64"
+	case "riscv64":
+		return "SCMP_ARCH_RISCV64"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,100 @@
+package container
+
+import (
+	"droplet/internal/hook"
+	"droplet/internal/oci"
+	"droplet/internal/spec"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeFeatures returns the features document as a caller reads it.
+func decodeFeatures(t *testing.T) spec.Features {
+	t.Helper()
+	data, err := json.Marshal(NewContainerFeatures().Features())
+	assert.Nil(t, err)
+	var features spec.Features
+	assert.Nil(t, json.Unmarshal(data, &features))
+	return features
+}
+
+func TestContainerFeatures_Versions(t *testing.T) {
+	// == act ==
+	features := decodeFeatures(t)
+
+	// == assert ==
+	assert.Equal(t, oci.OCIVersionMin, features.OciVersionMin)
+	assert.Equal(t, oci.OCIVersion, features.OciVersionMax)
+}
+
+func TestContainerFeatures_HooksMatchController(t *testing.T) {
+	// == arrange ==
+	// every Run<Phase>Hooks method of the controller runs a phase
+	var phases []string
+	controller := reflect.TypeOf((*hook.ContainerHookController)(nil)).Elem()
+	for i := 0; i < controller.NumMethod(); i++ {
+		name := controller.Method(i).Name
+		phase, ok := strings.CutSuffix(strings.TrimPrefix(name, "Run"), "Hooks")
+		if !ok {
+			continue
+		}
+		phases = append(phases, strings.ToLower(phase[:1])+phase[1:])
+	}
+
+	// == act ==
+	features := decodeFeatures(t)
+
+	// == assert ==
+	assert.ElementsMatch(t, phases, features.Hooks)
+	assert.NotContains(t, features.Hooks, "prestart")
+}
+
+func TestContainerFeatures_NamespacesMatchNamespaceConfig(t *testing.T) {
+	// == act ==
+	features := decodeFeatures(t)
+
+	// == assert ==
+	// every advertised namespace is applied, and every namespace that can
+	// be applied is advertised
+	for _, ns := range features.Linux.Namespaces {
+		nsConfig := buildNamespaceConfig(spec.Spec{LinuxSpec: spec.LinuxSpecObject{
+			Namespaces: []spec.NamespaceObject{{Type: ns}},
+		}})
+		assert.NotEqual(t, namespaceConfig{}, nsConfig, ns)
+	}
+	assert.Equal(t, reflect.TypeOf(namespaceConfig{}).NumField(), len(features.Linux.Namespaces))
+}
+
+func TestContainerFeatures_AnnotationsMatchAccessors(t *testing.T) {
+	// == arrange ==
+	// keys that describe the runtime rather than being read from config.json
+	informational := map[string]bool{
+		spec.AnnotationKeyImage + ".rootfsType": true,
+		"io.raind.cgroup.controllers":           true,
+	}
+
+	// == act ==
+	features := decodeFeatures(t)
+
+	// == assert ==
+	// each accessor of AnnotationObject reads an advertised key
+	annotations := spec.AnnotationObject{}
+	var advertised []string
+	for key := range features.Annotations {
+		if !informational[key] {
+			annotations[key] = key
+			advertised = append(advertised, key)
+		}
+	}
+	var read []string
+	value := reflect.ValueOf(annotations)
+	for i := 0; i < value.NumMethod(); i++ {
+		out := value.Method(i).Call(nil)
+		read = append(read, out[0].String())
+	}
+	assert.ElementsMatch(t, advertised, read)
+}
@@ -0,0 +1,616 @@
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// InputPolicy decides which attached clients may write to the input of the
+// container process.
+type InputPolicy string
+
+const (
+	// InputPolicyFirstWriter gives the input to the first client that sends
+	// data; the others are ignored until that client detaches.
+	InputPolicyFirstWriter InputPolicy = "first-writer"
+	// InputPolicyAll forwards the input of every client.
+	InputPolicyAll InputPolicy = "all"
+	// InputPolicyReadOnly ignores the input of every client.
+	InputPolicyReadOnly InputPolicy = "read-only"
+)
+
+const (
+	// hubClientQueue is the number of output chunks buffered per client.
+	// A client that falls this far behind is disconnected so that it never
+	// blocks the pump goroutine.
+	hubClientQueue = 256
+	// hubScrollbackSize is the size of the output history kept for replay.
+	hubScrollbackSize = 1024 * 1024
+	// hubReplayWait is how long output to a new client is held back while
+	// waiting for its first frame, which may be a replay request.
+	hubReplayWait = 200 * time.Millisecond
+	// hubExitDrain bounds how long the exit of the container process waits
+	// for the remaining output to reach the clients.
+	hubExitDrain = time.Second
+)
+
+// parseInputPolicy parses the io.raind.attach.input annotation.
+// An empty value selects InputPolicyFirstWriter.
+func parseInputPolicy(value string) (InputPolicy, error) {
+	switch p := InputPolicy(value); p {
+	case "":
+		return InputPolicyFirstWriter, nil
+	case InputPolicyFirstWriter, InputPolicyAll, InputPolicyReadOnly:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown attach input policy: %q", value)
+	}
+}
+
+// hubMessage is a queued message for a client: output (frameData, or
+// frameStderr for the stderr pipe of a process without a terminal) or the
+// exit status of the container process (frameExit).
+type hubMessage struct {
+	typ     byte
+	payload []byte
+}
+
+// hubClient is a single attached connection.
+type hubClient struct {
+	conn     net.Conn
+	readOnly bool
+	offset   uint64 // stream offset at which live output started
+
+	// set by the handshake before the client is released
+	framed       bool
+	capabilities uint32
+
+	out       chan hubMessage
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// live output is held back until ready is closed, so that a replay is
+	// written to the connection before anything queued in out
+	gateMu sync.Mutex
+	ready  chan struct{}
+}
+
+// release starts the delivery of live output. It waits for an in-flight
+// replay to finish.
+func (c *hubClient) release() {
+	c.gateMu.Lock()
+	defer c.gateMu.Unlock()
+	select {
+	case <-c.ready:
+	default:
+		close(c.ready)
+	}
+}
+
+func (c *hubClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
+
+// writeLoop drains the output queue into the connection once the client
+// is released.
+func (c *hubClient) writeLoop() {
+	select {
+	case <-c.ready:
+	case <-c.done:
+		return
+	}
+	for {
+		select {
+		case m := <-c.out:
+			if err := c.write(m); err != nil || m.typ == frameExit {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// write sends m framed to a versioned client and as raw output to an
+// unversioned one, which cannot receive control messages.
+func (c *hubClient) write(m hubMessage) error {
+	switch {
+	case c.framed:
+		switch {
+		case m.typ == frameExit && c.capabilities&capExitStatus == 0:
+			return nil
+		case m.typ == frameStderr && c.capabilities&capStderr == 0:
+			m.typ = frameData
+		}
+		return writeFrame(c.conn, m.typ, m.payload)
+	case m.typ == frameData || m.typ == frameStderr:
+		_, err := c.conn.Write(m.payload)
+		return err
+	default:
+		return nil
+	}
+}
+
+// hub multiplexes the stdio of a container process between the console
+// log and any number of attached clients. Output is broadcast to every
+// client, and input is filtered by the input policy.
+//
+// The process either runs on a pty, whose master is both the input and the
+// output of the hub, or on pipes, whose stdout and stderr are pumped as
+// separate streams.
+type hub struct {
+	input        *os.File  // pty master, or write end of the stdin pipe
+	terminal     bool      // input is a pty master
+	capabilities uint32    // announced in the handshake
+	console      io.Writer // console.log, for the pty output
+	logger       *log.Logger
+	policy       InputPolicy
+
+	pidMu sync.Mutex // guards pid and pidfd against exit
+	pid   int        // receives forwarded signals, 0 once it exited
+	pidfd int        // pidfd of pid, or -1
+
+	pumps sync.WaitGroup
+
+	mu         sync.Mutex
+	clients    map[*hubClient]struct{}
+	writer     *hubClient // current writer under InputPolicyFirstWriter
+	scrollback *scrollback
+
+	inputMu     sync.Mutex // serializes writes to input
+	inputClosed bool       // the stdin pipe was closed; guarded by inputMu
+}
+
+// newHub returns a hub for a process running on the pty of ptmx.
+func newHub(ptmx *os.File, console io.Writer, logger *log.Logger, policy InputPolicy, pid int) *hub {
+	h := newPipeHub(ptmx, logger, policy, pid)
+	h.terminal = true
+	h.console = console
+	h.capabilities = shimCapabilities
+	return h
+}
+
+// newPipeHub returns a hub for a process without a terminal. stdin is the
+// write end of its stdin pipe; the output pipes are added with
+// startStreamPump.
+func newPipeHub(stdin *os.File, logger *log.Logger, policy InputPolicy, pid int) *hub {
+	h := &hub{
+		input:        stdin,
+		capabilities: shimCapabilities | capStderr,
+		logger:       logger,
+		policy:       policy,
+		pid:          pid,
+		pidfd:        -1,
+		clients:      map[*hubClient]struct{}{},
+		scrollback:   newScrollback(hubScrollbackSize),
+	}
+	// the process is a child of the shim and not reaped yet, so the pidfd
+	// refers to it and forwarded signals never reach a reused pid
+	if pid > 0 {
+		if fd, err := unix.PidfdOpen(pid, 0); err == nil {
+			h.pidfd = fd
+		}
+	}
+	return h
+}
+
+func (h *hub) logf(format string, args ...any) {
+	if h.logger != nil {
+		h.logger.Printf(format, args...)
+	}
+}
+
+// attach registers a connection. Output produced from now on is queued for
+// it and delivered once the client sends its first frame or hubReplayWait
+// elapses.
+func (h *hub) attach(conn net.Conn) *hubClient {
+	c := &hubClient{
+		conn:  conn,
+		out:   make(chan hubMessage, hubClientQueue),
+		done:  make(chan struct{}),
+		ready: make(chan struct{}),
+	}
+	h.mu.Lock()
+	c.offset = h.scrollback.end
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+
+	go c.writeLoop()
+	time.AfterFunc(hubReplayWait, c.release)
+	return c
+}
+
+// replay writes the requested history to a client that has not been
+// released yet. The history ends where the client's live output starts, so
+// nothing is lost or duplicated. Requests after the release are ignored.
+// The history does not keep the streams apart, so it is replayed as
+// frameData.
+func (h *hub) replay(c *hubClient, payload []byte) error {
+	if len(payload) != 9 {
+		return nil
+	}
+	value := binary.BigEndian.Uint64(payload[1:9])
+
+	c.gateMu.Lock()
+	defer c.gateMu.Unlock()
+	select {
+	case <-c.ready:
+		return nil
+	default:
+	}
+
+	h.mu.Lock()
+	var from uint64
+	switch payload[0] {
+	case replayLast:
+		if value < c.offset {
+			from = c.offset - value
+		}
+	case replaySince:
+		from = value
+	default:
+		h.mu.Unlock()
+		return nil
+	}
+	data := h.scrollback.slice(from, c.offset)
+	h.mu.Unlock()
+
+	if len(data) == 0 {
+		return nil
+	}
+	return c.write(hubMessage{typ: frameData, payload: data})
+}
+
+// detach unregisters a client and releases the input if it held it.
+func (h *hub) detach(c *hubClient) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	if h.writer == c {
+		h.writer = nil
+	}
+	h.mu.Unlock()
+	c.close()
+}
+
+// setReadOnly marks a client as a viewer; its input and resize frames
+// are dropped from then on.
+func (h *hub) setReadOnly(c *hubClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.readOnly = true
+	if h.writer == c {
+		h.writer = nil
+	}
+}
+
+// acquireInput reports whether data sent by c may be written to the input.
+// Under InputPolicyFirstWriter the first client asking becomes the writer.
+func (h *hub) acquireInput(c *hubClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.readOnly {
+		return false
+	}
+	switch h.policy {
+	case InputPolicyAll:
+		return true
+	case InputPolicyFirstWriter:
+		if h.writer == nil {
+			h.writer = c
+		}
+		return h.writer == c
+	default:
+		return false
+	}
+}
+
+// canControl reports whether a resize or signal sent by c is applied.
+// Viewers never control the process, and while a writer holds the input only it
+// may.
+func (h *hub) canControl(c *hubClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.readOnly {
+		return false
+	}
+	switch h.policy {
+	case InputPolicyAll:
+		return true
+	case InputPolicyFirstWriter:
+		return h.writer == nil || h.writer == c
+	default:
+		return false
+	}
+}
+
+// broadcast records p in the scrollback and queues it as a message of type
+// typ for every client, disconnecting the ones whose queue is full.
+func (h *hub) broadcast(typ byte, p []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.scrollback.Write(p)
+	h.enqueue(hubMessage{typ: typ, payload: p})
+}
+
+// enqueue queues m for every client, disconnecting the ones whose queue is
+// full. h.mu must be held.
+func (h *hub) enqueue(m hubMessage) {
+	for c := range h.clients {
+		select {
+		case c.out <- m:
+		default:
+			h.logf("attach client too slow, disconnecting")
+			delete(h.clients, c)
+			if h.writer == c {
+				h.writer = nil
+			}
+			c.close()
+		}
+	}
+}
+
+// exit pushes the exit status of the container process to the clients
+// once the remaining output is delivered, and closes them. It returns
+// when every client is closed or hubExitDrain elapses.
+func (h *hub) exit(status int) {
+	h.releaseProcess()
+
+	deadline := time.After(hubExitDrain)
+	pumpsDone := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(pumpsDone)
+	}()
+	select {
+	case <-pumpsDone:
+	case <-deadline:
+	}
+
+	h.mu.Lock()
+	clients := make([]*hubClient, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.enqueue(hubMessage{typ: frameExit, payload: encodeUint32(uint32(status))})
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		select {
+		case <-c.done:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// releaseProcess closes the pidfd of the exited process, which has been
+// reaped by now, and stops forwarding signals to its pid.
+func (h *hub) releaseProcess() {
+	h.pidMu.Lock()
+	defer h.pidMu.Unlock()
+	if h.pidfd >= 0 {
+		_ = unix.Close(h.pidfd)
+		h.pidfd = -1
+	}
+	h.pid = 0
+}
+
+// startPump pumps the pty output of a terminal hub.
+func (h *hub) startPump() {
+	h.startStreamPump(h.input, frameData, h.console)
+}
+
+// startStreamPump copies r to console and broadcasts it as messages of type
+// typ until r fails.
+func (h *hub) startStreamPump(r io.Reader, typ byte, console io.Writer) {
+	h.pumps.Add(1)
+	go func() {
+		defer h.pumps.Done()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				if console != nil {
+					_, _ = console.Write(buf[:n])
+				}
+				// buf is reused, so every broadcast gets its own copy
+				chunk := make([]byte, n)
+				copy(chunk, buf[:n])
+				h.broadcast(typ, chunk)
+			}
+			if err != nil {
+				h.logf("output read end (frame 0x%02x): %v", typ, err)
+				return
+			}
+		}
+	}()
+}
+
+func (h *hub) acceptLoop(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			h.logf("accept error: %v", err)
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		h.logf("attach connected")
+
+		c := h.attach(conn)
+
+		// conn -> input (framed)
+		go func() {
+			_ = h.readFramesAndApply(conn, c)
+			h.detach(c)
+			h.logf("attach disconnected")
+		}()
+	}
+}
+
+// readFramesAndApply applies the frames sent by client c until r fails.
+func (h *hub) readFramesAndApply(r io.Reader, c *hubClient) error {
+	for {
+		typ, payload, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+		if typ == frameHello {
+			// the handshake precedes the replay request, so it keeps the
+			// replay window open
+			if err := h.hello(c, payload); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := h.apply(c, typ, payload); err != nil {
+			return err
+		}
+
+		// any other frame ends the replay window; resize frames sent after
+		// the replay request are therefore applied once the history is
+		// written
+		c.release()
+	}
+}
+
+func (h *hub) apply(c *hubClient, typ byte, payload []byte) error {
+	switch typ {
+	case frameData:
+		if len(payload) == 0 || !h.acquireInput(c) {
+			return nil
+		}
+		h.inputMu.Lock()
+		defer h.inputMu.Unlock()
+		if h.inputClosed {
+			return nil
+		}
+		_, err := h.input.Write(payload)
+		if errors.Is(err, syscall.EPIPE) {
+			// the process closed its stdin; the client stays attached
+			h.logf("stdin closed by the container process")
+			return nil
+		}
+		return err
+	case frameResize:
+		if len(payload) != 4 || !h.terminal || !h.canControl(c) {
+			return nil
+		}
+		rows := binary.BigEndian.Uint16(payload[0:2])
+		cols := binary.BigEndian.Uint16(payload[2:4])
+		_ = pty.Setsize(h.input, &pty.Winsize{Rows: rows, Cols: cols})
+	case frameReadOnly:
+		h.setReadOnly(c)
+	case frameReplay:
+		return h.replay(c, payload)
+	case frameSignal:
+		if len(payload) != 4 || !h.canControl(c) {
+			return nil
+		}
+		h.signal(syscall.Signal(binary.BigEndian.Uint32(payload)))
+	case frameCloseStdin:
+		if !h.acquireInput(c) {
+			return nil
+		}
+		h.closeStdin()
+	default:
+		// unknown frames are ignored; a versioned client only sends the
+		// frames covered by the negotiated capabilities
+		h.logf("unknown frame type: 0x%02x", typ)
+	}
+	return nil
+}
+
+// hello completes the handshake of a versioned client. From then on every
+// message to the client is framed. A handshake after the replay window is
+// ignored and the connection stays unversioned.
+func (h *hub) hello(c *hubClient, payload []byte) error {
+	peer, err := decodeHello(payload)
+	if err != nil {
+		return err
+	}
+
+	c.gateMu.Lock()
+	defer c.gateMu.Unlock()
+	select {
+	case <-c.ready:
+		return nil
+	default:
+	}
+
+	c.framed = true
+	c.capabilities = peer.capabilities & h.capabilities
+	reply := hello{version: protocolVersion, capabilities: h.capabilities}
+	return writeFrame(c.conn, frameHello, reply.encode())
+}
+
+// signal delivers sig to the container process.
+func (h *hub) signal(sig syscall.Signal) {
+	h.pidMu.Lock()
+	defer h.pidMu.Unlock()
+	if h.pid <= 0 || sig <= 0 || sig > 64 {
+		return
+	}
+	var err error
+	if h.pidfd >= 0 {
+		err = unix.PidfdSendSignal(h.pidfd, sig, nil, 0)
+	} else {
+		err = unix.Kill(h.pid, sig)
+	}
+	if err != nil {
+		h.logf("signal %d to pid %d failed: %v", sig, h.pid, err)
+	}
+}
+
+// closeStdin closes the stdin pipe of a process without a terminal. On a
+// pty it writes the EOF character instead, which only has an effect while
+// the terminal is in canonical mode, when the line discipline turns it
+// into an end of file for the reader.
+func (h *hub) closeStdin() {
+	if !h.terminal {
+		h.inputMu.Lock()
+		defer h.inputMu.Unlock()
+		if !h.inputClosed {
+			h.inputClosed = true
+			_ = h.input.Close()
+		}
+		return
+	}
+
+	rc, err := h.input.SyscallConn()
+	if err != nil {
+		return
+	}
+	var termios *unix.Termios
+	_ = rc.Control(func(fd uintptr) {
+		termios, err = unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	})
+	if err != nil {
+		return
+	}
+	if termios.Lflag&unix.ICANON == 0 {
+		h.logf("close stdin ignored: pty is not in canonical mode")
+		return
+	}
+
+	h.inputMu.Lock()
+	defer h.inputMu.Unlock()
+	_, _ = h.input.Write([]byte{termios.Cc[unix.VEOF]})
+}
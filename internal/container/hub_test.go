@@ -0,0 +1,478 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func frame(typ byte, payload []byte) []byte {
+	b := make([]byte, 5+len(payload))
+	b[0] = typ
+	binary.BigEndian.PutUint32(b[1:5], uint32(len(payload)))
+	copy(b[5:], payload)
+	return b
+}
+
+func readWithTimeout(t *testing.T, r io.Reader, n int) []byte {
+	t.Helper()
+	buf := make([]byte, n)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(r, buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("read timed out")
+	}
+	return buf
+}
+
+func TestParseInputPolicy(t *testing.T) {
+	// == act ==
+	empty, err1 := parseInputPolicy("")
+	all, err2 := parseInputPolicy("all")
+	_, err3 := parseInputPolicy("everyone")
+
+	// == assert ==
+	assert.Nil(t, err1)
+	assert.Equal(t, InputPolicyFirstWriter, empty)
+	assert.Nil(t, err2)
+	assert.Equal(t, InputPolicyAll, all)
+	assert.NotNil(t, err3)
+}
+
+func TestHub_BroadcastToAllClients(t *testing.T) {
+	// == arrange ==
+	src, sink, err := os.Pipe()
+	assert.Nil(t, err)
+	defer src.Close()
+	defer sink.Close()
+	h := newHub(src, nil, nil, InputPolicyFirstWriter, 0)
+	a, aPeer := net.Pipe()
+	b, bPeer := net.Pipe()
+	h.attach(a)
+	h.attach(b)
+	h.startPump()
+
+	// == act ==
+	_, err = sink.Write([]byte("hello"))
+	assert.Nil(t, err)
+
+	// == assert ==
+	assert.Equal(t, []byte("hello"), readWithTimeout(t, aPeer, 5))
+	assert.Equal(t, []byte("hello"), readWithTimeout(t, bPeer, 5))
+}
+
+func TestHub_SlowClientDisconnected(t *testing.T) {
+	// == arrange ==
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, 0)
+	slow, slowPeer := net.Pipe() // nobody reads slowPeer
+	defer slowPeer.Close()
+	c := h.attach(slow)
+
+	// == act ==
+	for i := 0; i < hubClientQueue+2; i++ {
+		h.broadcast(frameData, []byte("x"))
+	}
+
+	// == assert ==
+	h.mu.Lock()
+	_, attached := h.clients[c]
+	h.mu.Unlock()
+	assert.False(t, attached)
+	select {
+	case <-c.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("slow client not closed")
+	}
+}
+
+func TestHub_FirstWriterPolicy(t *testing.T) {
+	// == arrange ==
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, 0)
+	a, _ := net.Pipe()
+	b, _ := net.Pipe()
+	ca := h.attach(a)
+	cb := h.attach(b)
+
+	// == act ==
+	first := h.acquireInput(ca)
+	second := h.acquireInput(cb)
+	resizeB := h.canControl(cb)
+	h.detach(ca)
+	afterDetach := h.acquireInput(cb)
+
+	// == assert ==
+	assert.True(t, first)
+	assert.False(t, second)
+	assert.False(t, resizeB)
+	assert.True(t, afterDetach)
+}
+
+func TestHub_AllAndReadOnlyPolicy(t *testing.T) {
+	// == arrange ==
+	all := newHub(nil, nil, nil, InputPolicyAll, 0)
+	ro := newHub(nil, nil, nil, InputPolicyReadOnly, 0)
+	a, _ := net.Pipe()
+	b, _ := net.Pipe()
+	c, _ := net.Pipe()
+	ca := all.attach(a)
+	cb := all.attach(b)
+	cc := ro.attach(c)
+
+	// == act ==
+	all.setReadOnly(cb)
+
+	// == assert ==
+	assert.True(t, all.acquireInput(ca))
+	assert.False(t, all.acquireInput(cb))
+	assert.False(t, all.canControl(cb))
+	assert.False(t, ro.acquireInput(cc))
+	assert.False(t, ro.canControl(cc))
+}
+
+func TestHub_ReadFramesAndApply_DropsViewerInput(t *testing.T) {
+	// == arrange ==
+	src, sink, err := os.Pipe()
+	assert.Nil(t, err)
+	defer src.Close()
+	defer sink.Close()
+	h := newHub(sink, nil, nil, InputPolicyFirstWriter, 0)
+	a, _ := net.Pipe()
+	b, _ := net.Pipe()
+	ca := h.attach(a)
+	cb := h.attach(b)
+	var viewer, writer bytes.Buffer
+	viewer.Write(frame(frameReadOnly, nil))
+	viewer.Write(frame(frameData, []byte("viewer")))
+	writer.Write(frame(frameData, []byte("writer")))
+
+	// == act ==
+	errViewer := h.readFramesAndApply(&viewer, cb)
+	errWriter := h.readFramesAndApply(&writer, ca)
+
+	// == assert ==
+	assert.Equal(t, io.EOF, errViewer)
+	assert.Equal(t, io.EOF, errWriter)
+	assert.Equal(t, []byte("writer"), readWithTimeout(t, src, 6))
+}
+
+func TestHub_ReadFramesAndApply_FrameTooLarge(t *testing.T) {
+	// == arrange ==
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, 0)
+	a, _ := net.Pipe()
+	c := h.attach(a)
+	hdr := []byte{frameData, 0xff, 0xff, 0xff, 0xff}
+
+	// == act ==
+	err := h.readFramesAndApply(bytes.NewReader(hdr), c)
+
+	// == assert ==
+	assert.NotNil(t, err)
+}
+
+func replayPayload(mode byte, value uint64) []byte {
+	p := make([]byte, 9)
+	p[0] = mode
+	binary.BigEndian.PutUint64(p[1:9], value)
+	return p
+}
+
+func TestHub_ReplayBeforeLiveOutput(t *testing.T) {
+	// == arrange ==
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, 0)
+	h.broadcast(frameData, []byte("history-"))
+	conn, peer := net.Pipe()
+	c := h.attach(conn)
+	h.broadcast(frameData, []byte("live"))
+	frames := bytes.NewReader(frame(frameReplay, replayPayload(replayLast, 3)))
+
+	// == act ==
+	errCh := make(chan error, 1)
+	go func() { errCh <- h.readFramesAndApply(frames, c) }()
+
+	// == assert ==
+	assert.Equal(t, []byte("ry-live"), readWithTimeout(t, peer, 7))
+	assert.Equal(t, io.EOF, <-errCh)
+}
+
+func TestHub_ReplaySinceStart(t *testing.T) {
+	// == arrange ==
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, 0)
+	h.broadcast(frameData, []byte("one,"))
+	h.broadcast(frameData, []byte("two,"))
+	conn, peer := net.Pipe()
+	c := h.attach(conn)
+	frames := bytes.NewReader(frame(frameReplay, replayPayload(replaySince, 0)))
+
+	// == act ==
+	go func() { _ = h.readFramesAndApply(frames, c) }()
+
+	// == assert ==
+	assert.Equal(t, []byte("one,two,"), readWithTimeout(t, peer, 8))
+}
+
+func TestHub_ReplayIgnoredAfterRelease(t *testing.T) {
+	// == arrange ==
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, 0)
+	h.broadcast(frameData, []byte("history"))
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	c := h.attach(conn)
+	c.release()
+
+	// == act ==
+	err := h.replay(c, replayPayload(replaySince, 0))
+
+	// == assert ==
+	assert.Nil(t, err)
+}
+
+func TestHub_HelloFramesOutputAndExit(t *testing.T) {
+	// == arrange ==
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, 0)
+	conn, peer := net.Pipe()
+	c := h.attach(conn)
+	var frames bytes.Buffer
+	frames.Write(frame(frameHello, hello{version: protocolVersion, capabilities: capExitStatus}.encode()))
+	frames.Write(frame(frameReplay, replayPayload(replayLast, 0)))
+	go func() { _ = h.readFramesAndApply(&frames, c) }()
+
+	// == act ==
+	typ, payload, err := readFrame(peer)
+	h.broadcast(frameData, []byte("out"))
+	go h.exit(3)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, byte(frameHello), typ)
+	reply, err := decodeHello(payload)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(protocolVersion), reply.version)
+	assert.Equal(t, shimCapabilities, reply.capabilities)
+
+	typ, payload, err = readFrame(peer)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(frameData), typ)
+	assert.Equal(t, []byte("out"), payload)
+
+	typ, payload, err = readFrame(peer)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(frameExit), typ)
+	assert.Equal(t, encodeUint32(3), payload)
+}
+
+func TestHub_ExitClosesUnversionedClient(t *testing.T) {
+	// == arrange ==
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, 0)
+	conn, peer := net.Pipe()
+	c := h.attach(conn)
+	c.release()
+	h.broadcast(frameData, []byte("bye"))
+
+	// == act ==
+	go h.exit(0)
+
+	// == assert ==
+	assert.Equal(t, []byte("bye"), readWithTimeout(t, peer, 3))
+	_, err := peer.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestHub_SignalForwarded(t *testing.T) {
+	// == arrange ==
+	cmd := exec.Command("sleep", "30")
+	assert.Nil(t, cmd.Start())
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, cmd.Process.Pid)
+	conn, _ := net.Pipe()
+	c := h.attach(conn)
+	frames := bytes.NewReader(frame(frameSignal, encodeUint32(uint32(syscall.SIGTERM))))
+
+	// == act ==
+	_ = h.readFramesAndApply(frames, c)
+	err := cmd.Wait()
+
+	// == assert ==
+	assert.Equal(t, 128+int(syscall.SIGTERM), exitStatus(err))
+}
+
+func TestHub_ExitClosesPidfd(t *testing.T) {
+	// == arrange ==
+	cmd := exec.Command("sleep", "30")
+	assert.Nil(t, cmd.Start())
+	defer func() { _ = cmd.Process.Kill(); _ = cmd.Wait() }()
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, cmd.Process.Pid)
+	pidfd := h.pidfd
+	assert.GreaterOrEqual(t, pidfd, 0)
+
+	// == act ==
+	h.exit(0)
+	h.signal(syscall.SIGTERM)
+
+	// == assert ==
+	assert.Equal(t, -1, h.pidfd)
+	_, err := unix.FcntlInt(uintptr(pidfd), unix.F_GETFD, 0)
+	assert.Equal(t, unix.EBADF, err)
+	// signals are no longer forwarded to the pid of the exited process
+	assert.Nil(t, cmd.Process.Signal(syscall.Signal(0)))
+}
+
+func TestHub_SignalIgnoredForViewer(t *testing.T) {
+	// == arrange ==
+	cmd := exec.Command("sleep", "30")
+	assert.Nil(t, cmd.Start())
+	defer func() { _ = cmd.Process.Kill(); _ = cmd.Wait() }()
+	h := newHub(nil, nil, nil, InputPolicyFirstWriter, cmd.Process.Pid)
+	conn, _ := net.Pipe()
+	c := h.attach(conn)
+	var frames bytes.Buffer
+	frames.Write(frame(frameReadOnly, nil))
+	frames.Write(frame(frameSignal, encodeUint32(uint32(syscall.SIGTERM))))
+
+	// == act ==
+	_ = h.readFramesAndApply(&frames, c)
+
+	// == assert ==
+	assert.Nil(t, cmd.Process.Signal(syscall.Signal(0)))
+}
+
+func TestHub_CloseStdinSendsEOF(t *testing.T) {
+	// == arrange ==
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("pty not available: %v", err)
+	}
+	defer ptmx.Close()
+	defer tty.Close()
+	h := newHub(ptmx, nil, nil, InputPolicyFirstWriter, 0)
+	conn, _ := net.Pipe()
+	c := h.attach(conn)
+	var frames bytes.Buffer
+	frames.Write(frame(frameData, []byte("line\n")))
+	frames.Write(frame(frameCloseStdin, nil))
+
+	// == act ==
+	_ = h.readFramesAndApply(&frames, c)
+	line, err := io.ReadAll(tty)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("line\n"), line)
+}
+
+// FuzzReadFramesAndApply feeds arbitrary bytes to the shim side of the
+// protocol. It must neither panic nor hang.
+func FuzzReadFramesAndApply(f *testing.F) {
+	f.Add(frame(frameData, []byte("ls\n")))
+	f.Add(frame(frameResize, []byte{0, 24, 0, 80}))
+	f.Add(frame(frameHello, hello{version: protocolVersion, capabilities: shimCapabilities}.encode()))
+	f.Add(frame(frameReplay, replayPayload(replaySince, 0)))
+	f.Add(frame(frameSignal, encodeUint32(0)))
+	f.Add(frame(frameCloseStdin, nil))
+	f.Add([]byte{frameData, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{0x7f, 0, 0, 0, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		src, sink, err := os.Pipe()
+		if err != nil {
+			t.Skip(err)
+		}
+		defer src.Close()
+		defer sink.Close()
+		go func() { _, _ = io.Copy(io.Discard, src) }()
+
+		h := newHub(sink, nil, nil, InputPolicyAll, 0)
+		h.broadcast(frameData, []byte("history"))
+		conn, peer := net.Pipe()
+		defer peer.Close()
+		go func() { _, _ = io.Copy(io.Discard, peer) }()
+		c := h.attach(conn)
+		defer h.detach(c)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = h.readFramesAndApply(bytes.NewReader(data), c)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("readFramesAndApply did not return")
+		}
+	})
+}
+
+func TestPipeHub_StderrFramedSeparately(t *testing.T) {
+	// == arrange ==
+	stdoutR, stdoutW, err := os.Pipe()
+	assert.Nil(t, err)
+	stderrR, stderrW, err := os.Pipe()
+	assert.Nil(t, err)
+	defer stdoutW.Close()
+	defer stderrW.Close()
+	h := newPipeHub(nil, nil, InputPolicyFirstWriter, 0)
+	h.startStreamPump(stdoutR, frameData, nil)
+	h.startStreamPump(stderrR, frameStderr, nil)
+	streams, streamsPeer := net.Pipe()
+	legacy, legacyPeer := net.Pipe()
+	c := h.attach(streams)
+	h.attach(legacy).release()
+	var frames bytes.Buffer
+	frames.Write(frame(frameHello, hello{version: protocolVersion, capabilities: capStderr}.encode()))
+	frames.Write(frame(frameReplay, replayPayload(replayLast, 0)))
+	go func() { _ = h.readFramesAndApply(&frames, c) }()
+	typ, payload, err := readFrame(streamsPeer)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(frameHello), typ)
+	reply, _ := decodeHello(payload)
+
+	// == act ==
+	_, err = stderrW.Write([]byte("oops"))
+	assert.Nil(t, err)
+
+	// == assert ==
+	assert.Equal(t, shimCapabilities|capStderr, reply.capabilities)
+	typ, payload, err = readFrame(streamsPeer)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(frameStderr), typ)
+	assert.Equal(t, []byte("oops"), payload)
+	// an unversioned client gets both streams as raw output
+	assert.Equal(t, []byte("oops"), readWithTimeout(t, legacyPeer, 4))
+}
+
+func TestPipeHub_CloseStdinClosesPipe(t *testing.T) {
+	// == arrange ==
+	stdinR, stdinW, err := os.Pipe()
+	assert.Nil(t, err)
+	defer stdinR.Close()
+	h := newPipeHub(stdinW, nil, InputPolicyFirstWriter, 0)
+	conn, _ := net.Pipe()
+	c := h.attach(conn)
+
+	// == act ==
+	err1 := h.apply(c, frameData, []byte("input"))
+	err2 := h.apply(c, frameCloseStdin, nil)
+	err3 := h.apply(c, frameData, []byte("ignored"))
+	got, err4 := io.ReadAll(stdinR)
+
+	// == assert ==
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Nil(t, err3)
+	assert.Nil(t, err4)
+	assert.Equal(t, []byte("input"), got)
+}
@@ -4,6 +4,7 @@ import (
 	"droplet/internal/logs"
 	"droplet/internal/spec"
 	"droplet/internal/utils"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -113,7 +114,7 @@ func (c *ContainerInit) Execute(opt InitOption) (err error) {
 
 	// 3. prepare container environment
 	stage = "prepare"
-	err = c.containerEnvPreparer.prepare(opt.ContainerId, spec)
+	err = c.containerEnvPreparer.prepare(opt, spec)
 	if err != nil {
 		return err
 	}
@@ -133,10 +134,10 @@ func (c *ContainerInit) Execute(opt InitOption) (err error) {
 		return err
 	}
 	entrypoint[0] = arg0
-	// close all FD except 0,1,2
-	c.closeAllExcept012()
+	// close all FD except 0,1,2 and the preserved ones
+	c.closeAllExceptPreserved(opt.ListenFds + opt.PreserveFds)
 	// execve
-	err = c.syscallHandler.Exec(arg0, entrypoint, spec.Process.Env)
+	err = c.syscallHandler.Exec(arg0, entrypoint, c.buildExecEnv(spec.Process.Env, opt.ListenFds))
 	if err != nil {
 		return err
 	}
@@ -144,20 +145,43 @@ func (c *ContainerInit) Execute(opt InitOption) (err error) {
 	return nil
 }
 
-func (c *ContainerInit) closeAllExcept012() {
+// closeAllExceptPreserved closes every file descriptor except stdio and
+// the preserveFds descriptors starting at fd 3 (LISTEN_FDS and --preserve-fds).
+func (c *ContainerInit) closeAllExceptPreserved(preserveFds int) {
 	ents, err := os.ReadDir("/proc/self/fd")
 	if err != nil {
 		return
 	}
 	for _, e := range ents {
 		fd, err := strconv.Atoi(e.Name())
-		if err != nil || fd < 3 {
+		if err != nil || fd < 3+preserveFds {
 			continue
 		}
 		_ = syscall.Close(fd)
 	}
 }
 
+// buildExecEnv returns the entrypoint environment. When sockets are passed
+// through by systemd socket activation, LISTEN_FDS and LISTEN_PID are set
+// so that the entrypoint (which keeps this PID after execve) accepts them.
+func (c *ContainerInit) buildExecEnv(env []string, listenFds int) []string {
+	if listenFds <= 0 {
+		return env
+	}
+	execEnv := make([]string, 0, len(env)+2)
+	for _, e := range env {
+		if strings.HasPrefix(e, "LISTEN_FDS=") || strings.HasPrefix(e, "LISTEN_PID=") {
+			continue
+		}
+		execEnv = append(execEnv, e)
+	}
+	execEnv = append(execEnv,
+		"LISTEN_FDS="+strconv.Itoa(listenFds),
+		"LISTEN_PID="+strconv.Itoa(os.Getpid()),
+	)
+	return execEnv
+}
+
 func (c *ContainerInit) specSecureLoad(containerId string) (spec.Spec, error) {
 	fileHashPath := utils.ConfigFileHashPath(containerId)
 
@@ -171,7 +195,11 @@ func (c *ContainerInit) specSecureLoad(containerId string) (spec.Spec, error) {
 	}
 
 	// 2. calculate current config.json file hash
-	currentHash, err := utils.Sha256File(utils.ConfigFilePath(containerId))
+	configPath, err := c.specLoader.configPath(containerId)
+	if err != nil {
+		return spec.Spec{}, err
+	}
+	currentHash, err := utils.Sha256File(configPath)
 	if err != nil {
 		return spec.Spec{}, err
 	}
@@ -180,6 +208,9 @@ func (c *ContainerInit) specSecureLoad(containerId string) (spec.Spec, error) {
 	if specFileHash.Sha256 != currentHash {
 		return spec.Spec{}, fmt.Errorf("config.json hash validation failed: expect=%s, got=%s", specFileHash.Sha256, currentHash)
 	}
+	if err := verifyMergedHooks(containerId, specFileHash); err != nil {
+		return spec.Spec{}, err
+	}
 
 	// 4. load config.json
 	specFile, err := c.specLoader.loadFile(containerId)
@@ -232,7 +263,7 @@ func (c *ContainerInit) lookEntrypointPath(arg0 string, env []string) (string, e
 // hostname configuration, filesystem setup, and other initialization logic
 // that must occur before the container entrypoint is executed.
 type containerEnvPreparer interface {
-	prepare(containerId string, spec spec.Spec) error
+	prepare(opt InitOption, spec spec.Spec) error
 }
 
 // rootContainerEnvPreparer is the default envPreparer implementation used
@@ -252,23 +283,33 @@ type rootContainerEnvPreparer struct {
 // according to the provided OCI spec.
 //
 // The workflow is:
-//  1. Switch to uid=0 (root) inside the user namespace
+//  1. Switch to uid=0 (root) inside the user namespace and join a new
+//     session keyring (unless --no-new-keyring)
 //  2. Set the hostname to the container ID from the spec
-//  3. Set up the overlay filesystem based on rootfs and image annotations
+//  3. Set up the root filesystem (bind, overlay or overlay-volatile)
 //  4. Mount the configured filesystems
 //  5. Mount standard device files under the new root
 //  6. Create required symbolic links under the new root
-//  7. Perform pivot_root into the container root filesystem
-//  8. Configure Linux capabilities for the process
+//  7. Perform pivot_root (or move+chroot with --no-pivot) into the rootfs
+//  8. Remount the root read-only if root.readonly is set
+//  9. Configure Linux capabilities for the process
 //
 // If any step fails, the error is returned immediately and the remaining
 // steps are not executed.
-func (p *rootContainerEnvPreparer) prepare(containerId string, spec spec.Spec) (err error) {
+func (p *rootContainerEnvPreparer) prepare(opt InitOption, spec spec.Spec) (err error) {
+	containerId := opt.ContainerId
+
 	// 1. change uid=0(root) inside container
 	err = p.switchToUserNamespaceRoot()
 	if err != nil {
 		return err
 	}
+	if !opt.NoNewKeyring {
+		err = p.joinSessionKeyring(containerId)
+		if err != nil {
+			return err
+		}
+	}
 	// 2. set hostname
 	err = p.setHostnameToContainerId(spec.Hostname)
 	if err != nil {
@@ -279,8 +320,9 @@ func (p *rootContainerEnvPreparer) prepare(containerId string, spec spec.Spec) (
 	if err != nil {
 		return err
 	}
-	// 4. setup overlay
-	if err := p.setupOverlay(spec.Root.Path, spec.Annotations.Image); err != nil {
+	// 4. setup rootfs (bind / overlay / overlay-volatile)
+	err = p.setupRootfs(containerId, spec.Root.Path, spec.Annotations.Image())
+	if err != nil {
 		return err
 	}
 	// 5. mount filesystem
@@ -299,19 +341,32 @@ func (p *rootContainerEnvPreparer) prepare(containerId string, spec spec.Spec) (
 		return err
 	}
 	// 8. pivot_root
-	err = p.pivotRoot(spec.Root.Path)
+	if opt.NoPivot {
+		err = p.moveRoot(spec.Root.Path)
+	} else {
+		err = p.pivotRoot(spec.Root.Path)
+	}
 	if err != nil {
 		return err
 	}
-	// 9. set capability
+	// 9. remount root read-only if requested
+	if spec.Root.Readonly {
+		err = p.remountRootReadonly()
+		if err != nil {
+			return err
+		}
+	}
+	// 10. set capability
 	err = p.setCapability(spec.Process.Capabilities)
 	if err != nil {
 		return err
 	}
-	// 10. install seccomp (NO_NEW_PRIVS + filter)
-	err = p.seccompHandler.InstallDenyFilter(*spec.LinuxSpec.Seccomp)
-	if err != nil {
-		return err
+	// 11. install seccomp (NO_NEW_PRIVS + filter)
+	if spec.LinuxSpec.Seccomp != nil {
+		err = p.seccompHandler.InstallDenyFilter(*spec.LinuxSpec.Seccomp)
+		if err != nil {
+			return err
+		}
 	}
 	// 12. change current dir
 	err = p.syscallHandler.Chdir(spec.Process.Cwd)
@@ -341,6 +396,20 @@ func (p *rootContainerEnvPreparer) switchToUserNamespaceRoot() error {
 	return nil
 }
 
+// joinSessionKeyring joins a new session keyring named after the container,
+// so that keys are not shared with the host or other containers.
+//
+// Kernels without keyring support (ENOSYS) are tolerated.
+func (p *rootContainerEnvPreparer) joinSessionKeyring(containerId string) error {
+	if _, err := unix.KeyctlJoinSessionKeyring("_ses." + containerId); err != nil {
+		if errors.Is(err, unix.ENOSYS) {
+			return nil
+		}
+		return fmt.Errorf("join session keyring failed: %w", err)
+	}
+	return nil
+}
+
 // setHostnameToContainerId configures the hostname for the process inside
 // the UTS namespace.
 //
@@ -365,22 +434,58 @@ func (p *rootContainerEnvPreparer) setEnv(envlist []string) error {
 	return nil
 }
 
-// setupOverlay mounts the container root filesystem using overlayfs.
+// setupRootfs prepares the container root filesystem at the given rootfs path.
 //
-// imageAnnotation is a JSON string that is decoded into ImageConfigObject,
-// which contains lower (image layers), upper, and work directories.
-// The overlay filesystem is mounted at the given rootfs path.
-func (p *rootContainerEnvPreparer) setupOverlay(rootfs string, imageAnnotation string) error {
-	// convert string to json
-	var imageConfig spec.ImageConfigObject
-	if err := utils.StringToJson(imageAnnotation, &imageConfig); err != nil {
+// The rootfsType in the image annotation selects the strategy:
+//   - bind             : root.path is used as-is (bind-mounted onto itself)
+//   - overlay          : overlayfs with the configured upper/work directories
+//   - overlay-volatile : overlayfs with upper/work on a tmpfs under the
+//     container directory, discarded when the container is deleted
+//
+// A spec without the image annotation is treated as bind.
+func (p *rootContainerEnvPreparer) setupRootfs(containerId string, rootfs string, imageAnnotation string) error {
+	imageConfig, err := spec.ParseImageConfig(imageAnnotation)
+	if err != nil {
+		return err
+	}
+
+	switch imageConfig.RootfsType {
+	case spec.RootfsTypeOverlay:
+		return p.setupOverlay(rootfs, imageConfig)
+	case spec.RootfsTypeOverlayVolatile:
+		return p.setupVolatileOverlay(containerId, rootfs, imageConfig)
+	default:
+		return p.setupBindRootfs(rootfs)
+	}
+}
+
+// setupBindRootfs uses the rootfs directory as-is.
+//
+// pivot_root requires the new root to be a mount point, so the directory
+// is bind-mounted onto itself before mount propagation is made private.
+func (p *rootContainerEnvPreparer) setupBindRootfs(rootfs string) error {
+	// bind rootfs onto itself
+	if err := p.syscallHandler.Mount(rootfs, rootfs, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+
+	// re-mount for mount propagation
+	if err := p.syscallHandler.Mount("", rootfs, "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
 		return err
 	}
 
+	return nil
+}
+
+// setupOverlay mounts the container root filesystem using overlayfs.
+//
+// imageConfig contains lower (image layers), upper, and work directories.
+// The overlay filesystem is mounted at the given rootfs path.
+func (p *rootContainerEnvPreparer) setupOverlay(rootfs string, imageConfig spec.ImageConfigObject) error {
 	// mount parameter
 	mountSource := "overlay"
 	mountTarget := rootfs
-	mountFstype := imageConfig.RootfsType
+	mountFstype := "overlay"
 	mountFlags := uintptr(0)
 	// mount data contains following parameter
 	// - lowerdir : container image layers
@@ -404,6 +509,52 @@ func (p *rootContainerEnvPreparer) setupOverlay(rootfs string, imageAnnotation s
 	return nil
 }
 
+// setupVolatileOverlay mounts overlayfs with its upper and work directories
+// placed on a tmpfs, so that all writes are discarded with the container.
+//
+// The tmpfs is mounted at utils.VolatileDir(containerId); the upperDir and
+// workDir values in imageConfig are ignored.
+func (p *rootContainerEnvPreparer) setupVolatileOverlay(containerId string, rootfs string, imageConfig spec.ImageConfigObject) error {
+	volatileDir := utils.VolatileDir(containerId)
+
+	// 1. mount tmpfs for upper/work
+	if err := p.syscallHandler.MkdirAll(volatileDir, 0700); err != nil {
+		return err
+	}
+	if err := p.syscallHandler.Mount("tmpfs", volatileDir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0700"); err != nil {
+		return err
+	}
+	if err := p.syscallHandler.Mount("", volatileDir, "", syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+
+	// 2. create upper/work on tmpfs
+	upperDir := filepath.Join(volatileDir, "upper")
+	workDir := filepath.Join(volatileDir, "work")
+	if err := p.syscallHandler.Mkdir(upperDir, 0755); err != nil {
+		return err
+	}
+	if err := p.syscallHandler.Mkdir(workDir, 0700); err != nil {
+		return err
+	}
+
+	// 3. overlay
+	imageConfig.UpperDir = upperDir
+	imageConfig.WorkDir = workDir
+	return p.setupOverlay(rootfs, imageConfig)
+}
+
+// remountRootReadonly remounts the container root ("/") read-only.
+//
+// Together with the bind rootfs type this serves a read-only image without
+// overlay: root.readonly of the spec selects it, as with runc.
+//
+// This must be called after pivot_root so that mount points under the
+// rootfs can still be created while preparing the filesystem.
+func (p *rootContainerEnvPreparer) remountRootReadonly() error {
+	return p.syscallHandler.Mount("", "/", "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_REC, "")
+}
+
 // mountFilesystem mounts all filesystems required for the container runtime
 // as well as user-specified bind mounts.
 //
@@ -561,33 +712,24 @@ func (p *rootContainerEnvPreparer) mountFilesystem(containerId string, rootfs st
 				"size=67108864",
 			},
 		},
-		{
-			Destination: "/etc/resolv.conf",
-			Type:        "bind",
-			Source:      fmt.Sprintf("/etc/raind/container/%s/etc/resolv.conf", containerId),
-			Options: []string{
-				"rbind",
-				"rprivate",
-			},
-		},
-		{
-			Destination: "/etc/hostname",
-			Type:        "bind",
-			Source:      fmt.Sprintf("/etc/raind/container/%s/etc/hostname", containerId),
-			Options: []string{
-				"rbind",
-				"rprivate",
-			},
-		},
-		{
-			Destination: "/etc/hosts",
+	}
+
+	// container specific /etc files prepared by the high-level runtime.
+	// these are optional so that standard OCI bundles work unmodified.
+	for _, name := range []string{"resolv.conf", "hostname", "hosts"} {
+		source := filepath.Join(utils.ContainerDir(containerId), "etc", name)
+		if _, err := p.syscallHandler.Stat(source); err != nil {
+			continue
+		}
+		prerequiredMounts = append(prerequiredMounts, spec.MountObject{
+			Destination: "/etc/" + name,
 			Type:        "bind",
-			Source:      fmt.Sprintf("/etc/raind/container/%s/etc/hosts", containerId),
+			Source:      source,
 			Options: []string{
 				"rbind",
 				"rprivate",
 			},
-		},
+		})
 	}
 
 	// user mounts
@@ -856,6 +998,38 @@ func (p *rootContainerEnvPreparer) pivotRoot(rootfs string) error {
 	return nil
 }
 
+// moveRoot switches into the rootfs without pivot_root (--no-pivot).
+//
+// This is required when the host root is on a ramdisk, where pivot_root
+// is not permitted. The old root stays reachable from the mount namespace,
+// so this mode is less isolated than pivotRoot.
+//
+// The sequence is:
+//  1. chdir to the new root
+//  2. move the new root mount onto "/"
+//  3. chroot to "."
+//  4. chdir to "/"
+func (p *rootContainerEnvPreparer) moveRoot(rootfs string) error {
+	// 1. change directory to rootfs
+	if err := p.syscallHandler.Chdir(rootfs); err != nil {
+		return err
+	}
+	// 2. move mount
+	if err := p.syscallHandler.Mount(rootfs, "/", "", syscall.MS_MOVE, ""); err != nil {
+		return err
+	}
+	// 3. chroot
+	if err := p.syscallHandler.Chroot("."); err != nil {
+		return err
+	}
+	// 4. change directory to root
+	if err := p.syscallHandler.Chdir("/"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // setCapability configures Linux capabilities for the current (init) process
 // according to the provided OCI capability configuration.
 //
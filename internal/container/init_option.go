@@ -0,0 +1,110 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// initProcessOption carries the runc-compatible process options that are
+// applied when spawning the init process (directly or through the shim).
+//
+// listenFds, preserveFds, noPivot and noNewKeyring are forwarded to the
+// shim/init subcommands as hidden flags; noTty is only set for the shim;
+// consoleSocket is only used by the process that opens the pseudo-terminal.
+type initProcessOption struct {
+	listenFds     int
+	preserveFds   int
+	noPivot       bool
+	noNewKeyring  bool
+	noTty         bool
+	consoleSocket string
+}
+
+// newInitProcessOption builds an initProcessOption from the create/run
+// options.
+//
+// A console socket receives the pty master, so it requires a tty, as in
+// runc.
+//
+// If LISTEN_FDS is set in the environment (systemd socket activation), the
+// listed file descriptors are passed through to the container in addition
+// to the --preserve-fds ones, as runc does.
+func newInitProcessOption(tty bool, preserveFds int, noPivot bool, noNewKeyring bool, consoleSocket string) (initProcessOption, error) {
+	if consoleSocket != "" && !tty {
+		return initProcessOption{}, fmt.Errorf("console-socket requires --tty")
+	}
+	if preserveFds < 0 {
+		return initProcessOption{}, fmt.Errorf("invalid --preserve-fds: %d", preserveFds)
+	}
+
+	listenFds := 0
+	if v := os.Getenv("LISTEN_FDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return initProcessOption{}, fmt.Errorf("invalid LISTEN_FDS: %q", v)
+		}
+		listenFds = n
+	}
+
+	return initProcessOption{
+		listenFds:     listenFds,
+		preserveFds:   preserveFds,
+		noPivot:       noPivot,
+		noNewKeyring:  noNewKeyring,
+		consoleSocket: consoleSocket,
+	}, nil
+}
+
+// args returns the hidden flags forwarded to the shim/init subcommands.
+// The flags must precede the positional arguments.
+func (o initProcessOption) args() []string {
+	args := []string{}
+	if o.listenFds > 0 {
+		args = append(args, "--listen-fds", strconv.Itoa(o.listenFds))
+	}
+	if o.preserveFds > 0 {
+		args = append(args, "--preserve-fds", strconv.Itoa(o.preserveFds))
+	}
+	if o.noPivot {
+		args = append(args, "--no-pivot")
+	}
+	if o.noNewKeyring {
+		args = append(args, "--no-new-keyring")
+	}
+	if o.noTty {
+		args = append(args, "--no-tty")
+	}
+	return args
+}
+
+// inheritedFds returns the file descriptors passed to the child process:
+// the LISTEN_FDS ones followed by the --preserve-fds ones, starting at
+// fd 3. The child receives them at the same numbers.
+func (o initProcessOption) inheritedFds() []int {
+	n := o.listenFds + o.preserveFds
+	fds := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		fds = append(fds, 3+i)
+	}
+	return fds
+}
+
+// extraFiles returns the inherited file descriptors (starting at fd 3)
+// that must be passed to the child process.
+func (o initProcessOption) extraFiles() []*os.File {
+	fds := o.inheritedFds()
+	files := make([]*os.File, 0, len(fds))
+	for _, fd := range fds {
+		files = append(files, os.NewFile(uintptr(fd), "fd"+strconv.Itoa(fd)))
+	}
+	return files
+}
+
+// buildInitArgs builds the argument list for the init/shim subcommands.
+func buildInitArgs(subcommand string, containerId string, fifo string, entrypoint []string, opt initProcessOption) []string {
+	args := []string{subcommand}
+	args = append(args, opt.args()...)
+	args = append(args, containerId, fifo)
+	return append(args, entrypoint...)
+}
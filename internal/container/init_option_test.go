@@ -0,0 +1,114 @@
+package container
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInitProcessOption(t *testing.T) {
+	tests := []struct {
+		name          string
+		tty           bool
+		preserveFds   int
+		listenFds     string
+		consoleSocket string
+		want          initProcessOption
+		wantErr       string
+	}{
+		{
+			name:        "preserve and listen fds",
+			preserveFds: 2,
+			listenFds:   "1",
+			want:        initProcessOption{listenFds: 1, preserveFds: 2},
+		},
+		{
+			name:          "console socket with tty",
+			tty:           true,
+			consoleSocket: "/tmp/console.sock",
+			want:          initProcessOption{consoleSocket: "/tmp/console.sock"},
+		},
+		{
+			name:          "console socket without tty",
+			consoleSocket: "/tmp/console.sock",
+			wantErr:       "console-socket requires --tty",
+		},
+		{
+			name:        "negative preserve fds",
+			preserveFds: -1,
+			wantErr:     "invalid --preserve-fds: -1",
+		},
+		{
+			name:      "invalid LISTEN_FDS",
+			listenFds: "two",
+			wantErr:   `invalid LISTEN_FDS: "two"`,
+		},
+		{
+			name:      "negative LISTEN_FDS",
+			listenFds: "-1",
+			wantErr:   `invalid LISTEN_FDS: "-1"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// == arrange ==
+			t.Setenv("LISTEN_FDS", tt.listenFds)
+
+			// == act ==
+			got, err := newInitProcessOption(tt.tty, tt.preserveFds, false, false, tt.consoleSocket)
+
+			// == assert ==
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestInitProcessOption_ExtraFilesAndArgs(t *testing.T) {
+	// == arrange ==
+	opt := initProcessOption{listenFds: 1, preserveFds: 2, noPivot: true, noTty: true}
+
+	// == act ==
+	fds := opt.inheritedFds()
+	args := buildInitArgs("init", "c1", "/fifo", []string{"/bin/sh"}, opt)
+
+	// == assert ==
+	// the LISTEN_FDS descriptors come first, followed by --preserve-fds,
+	// numbered from fd 3 as in the child
+	assert.Equal(t, []int{3, 4, 5}, fds)
+	assert.Empty(t, initProcessOption{}.extraFiles())
+	assert.Equal(t, []string{
+		"init", "--listen-fds", "1", "--preserve-fds", "2", "--no-pivot", "--no-tty",
+		"c1", "/fifo", "/bin/sh",
+	}, args)
+}
+
+func TestBuildExecEnv(t *testing.T) {
+	c := &ContainerInit{}
+	env := []string{"PATH=/bin", "LISTEN_FDS=9", "LISTEN_PID=1", "HOME=/root"}
+
+	t.Run("without listen fds", func(t *testing.T) {
+		// == act ==
+		got := c.buildExecEnv(env, 0)
+
+		// == assert ==
+		assert.Equal(t, env, got)
+	})
+	t.Run("with listen fds", func(t *testing.T) {
+		// == act ==
+		got := c.buildExecEnv(env, 2)
+
+		// == assert ==
+		// the entrypoint keeps the pid of init across execve
+		assert.Equal(t, []string{
+			"PATH=/bin", "HOME=/root",
+			"LISTEN_FDS=2", "LISTEN_PID=" + strconv.Itoa(os.Getpid()),
+		}, got)
+	})
+}
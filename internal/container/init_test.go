@@ -0,0 +1,122 @@
+package container
+
+import (
+	"droplet/internal/utils"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mountCall is a Mount call recorded by fakeMountSyscall.
+type mountCall struct {
+	source, target, fstype string
+	flags                  uintptr
+	data                   string
+}
+
+// fakeMountSyscall records mounts and directory creation instead of
+// performing them.
+type fakeMountSyscall struct {
+	utils.KernelSyscallHandler
+	mounts []mountCall
+	dirs   []string
+}
+
+func (f *fakeMountSyscall) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	f.mounts = append(f.mounts, mountCall{source, target, fstype, flags, data})
+	return nil
+}
+func (f *fakeMountSyscall) Mkdir(path string, mode uint32) error {
+	f.dirs = append(f.dirs, path)
+	return nil
+}
+func (f *fakeMountSyscall) MkdirAll(path string, perm os.FileMode) error {
+	f.dirs = append(f.dirs, path)
+	return nil
+}
+
+func TestSetupRootfs(t *testing.T) {
+	t.Setenv("RAIND_ROOT_DIR", "/run/raind")
+	volatileDir := utils.VolatileDir("c1")
+	tests := []struct {
+		name       string
+		annotation string
+		wantMounts []mountCall
+		wantDirs   []string
+	}{
+		{
+			name:       "bind",
+			annotation: "",
+			wantMounts: []mountCall{
+				{"/rootfs", "/rootfs", "", syscall.MS_BIND | syscall.MS_REC, ""},
+				{"", "/rootfs", "", syscall.MS_PRIVATE | syscall.MS_REC, ""},
+			},
+		},
+		{
+			name:       "overlay",
+			annotation: `{"rootfsType":"overlay","imageLayer":["/l1","/l2"],"upperDir":"/c/diff","workDir":"/c/work"}`,
+			wantMounts: []mountCall{
+				{"overlay", "/rootfs", "overlay", 0, "lowerdir=/l1:/l2,upperdir=/c/diff,workdir=/c/work"},
+				{"", "/rootfs", "", syscall.MS_PRIVATE | syscall.MS_REC, ""},
+			},
+		},
+		{
+			name:       "overlay-volatile",
+			annotation: `{"rootfsType":"overlay-volatile","imageLayer":["/l1"],"upperDir":"/c/diff","workDir":"/c/work"}`,
+			wantMounts: []mountCall{
+				{"tmpfs", volatileDir, "tmpfs", syscall.MS_NOSUID | syscall.MS_NODEV, "mode=0700"},
+				{"", volatileDir, "", syscall.MS_PRIVATE, ""},
+				{"overlay", "/rootfs", "overlay", 0,
+					"lowerdir=/l1,upperdir=" + filepath.Join(volatileDir, "upper") + ",workdir=" + filepath.Join(volatileDir, "work")},
+				{"", "/rootfs", "", syscall.MS_PRIVATE | syscall.MS_REC, ""},
+			},
+			wantDirs: []string{volatileDir, filepath.Join(volatileDir, "upper"), filepath.Join(volatileDir, "work")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// == arrange ==
+			syscallHandler := &fakeMountSyscall{}
+			p := &rootContainerEnvPreparer{syscallHandler: syscallHandler}
+
+			// == act ==
+			err := p.setupRootfs("c1", "/rootfs", tt.annotation)
+
+			// == assert ==
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantMounts, syscallHandler.mounts)
+			assert.Equal(t, tt.wantDirs, syscallHandler.dirs)
+		})
+	}
+}
+
+func TestSetupRootfs_UnknownType(t *testing.T) {
+	// == arrange ==
+	syscallHandler := &fakeMountSyscall{}
+	p := &rootContainerEnvPreparer{syscallHandler: syscallHandler}
+
+	// == act ==
+	err := p.setupRootfs("c1", "/rootfs", `{"rootfsType":"zfs"}`)
+
+	// == assert ==
+	assert.NotNil(t, err)
+	assert.Empty(t, syscallHandler.mounts)
+}
+
+func TestRemountRootReadonly(t *testing.T) {
+	// == arrange ==
+	syscallHandler := &fakeMountSyscall{}
+	p := &rootContainerEnvPreparer{syscallHandler: syscallHandler}
+
+	// == act ==
+	err := p.remountRootReadonly()
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []mountCall{
+		{"", "/", "", syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY | syscall.MS_REC, ""},
+	}, syscallHandler.mounts)
+}
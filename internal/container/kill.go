@@ -9,8 +9,6 @@ import (
 	"droplet/internal/utils"
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -33,7 +31,8 @@ func NewContainerKill() *ContainerKill {
 //   - Verifying that the container is currently RUNNING
 //   - Resolving the container’s init process PID from state.json
 //   - Sending the requested signal to that process
-//   - Updating the container status to STOPPED
+//   - Waiting for the container to stop, and updating the container
+//     status to STOPPED when no shim is left to record the exit
 //
 // Low-level system interactions are delegated to collaborators to
 // keep the workflow testable and replaceable.
@@ -48,10 +47,14 @@ type ContainerKill struct {
 //
 // The workflow is:
 //  1. Check that the container is RUNNING
-//  2. Retrieve the init PID from state.json
-//  3. Send the configured signal to that PID
-//  4. Update the status file to STOPPED and clear the PID
+//  2. Retrieve the init and shim identities from state.json
+//  3. Send the configured signal to the init process
+//  4. If the init process exits, wait until the shim records the exit;
+//     without a running shim, update the status file to STOPPED and clear
+//     the PIDs
+//  5. Run the stopContainer hooks once the container is stopped
 //
+// A signal that does not stop the init process leaves the state as it is.
 // If any step fails, the method stops and returns the error.
 func (c *ContainerKill) Kill(opt KillOption) (err error) {
 	var (
@@ -80,6 +83,14 @@ func (c *ContainerKill) Kill(opt KillOption) (err error) {
 		})
 	}()
 
+	// serialize with the other lifecycle commands
+	stage = "lock"
+	lock, err := lockContainer(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	// 1. load config.json
 	stage = "load_spec"
 	spec, err = c.specLoader.loadFile(opt.ContainerId)
@@ -100,74 +111,106 @@ func (c *ContainerKill) Kill(opt KillOption) (err error) {
 		return fmt.Errorf("container: %s not running.", opt.ContainerId)
 	}
 
-	// 3. retrieve pid and shimpid from state.json
+	// 3. retrieve init and shim identities from state.json
 	stage = "get_pid"
-	containerPid, err := c.containerStatusManager.GetPidFromId(opt.ContainerId)
+	procIdentity, err := c.containerStatusManager.GetProcIdentityFromId(opt.ContainerId)
 	if err != nil {
 		return err
 	}
+	containerPid := procIdentity.Pid
+	pid = containerPid
 	stage = "get_shim_pid"
-	shimPid, err := c.containerStatusManager.GetShimPidFromId(opt.ContainerId)
+	shimIdentity, err := c.containerStatusManager.GetShimIdentityFromId(opt.ContainerId)
 	if err != nil {
 		return err
 	}
 
 	// 4. send signal to pid
+	//    the identity recorded at create is verified, so a reused pid is
+	//    never signaled; a state written by an older version has none and
+	//    the current process is pinned instead
 	stage = "send_signal"
-	procStartTime, err := c.readProcStartTime(containerPid)
-	if err != nil {
-		return err
-	}
-	procIdentity := ProcIdentity{
-		Pid:       containerPid,
-		StartTime: procStartTime,
+	if !procIdentity.Verifiable() {
+		procIdentity, err = utils.NewProcIdentity(containerPid)
+		if err != nil {
+			return err
+		}
 	}
-	err = c.syscallHandler.Kill(containerPid, signalMap[opt.Signal])
+	err = procIdentity.Signal(signalMap[opt.Signal])
 	signal = append(signal, opt.Signal)
 	if err != nil {
 		return err
 	}
-	// if signal is SIGTERM, graceful stop with SIGKILL
-	if opt.Signal == "TERM" {
+	switch opt.Signal {
+	case "TERM":
+		// if signal is SIGTERM, graceful stop with SIGKILL
 		stage = "wait_exit_grace"
-		err = c.waitProcessExit(procIdentity, 3*time.Second)
+		err = waitProcessExit(procIdentity, 3*time.Second)
 		if err != nil {
 			// timeout: send SIGKILL
 			stage = "send_sigkill"
-			_ = c.syscallHandler.Kill(containerPid, signalMap["KILL"])
+			_ = procIdentity.Signal(signalMap["KILL"])
 			signal = append(signal, "KILL")
 
 			stage = "wait_exit_kill"
-			err = c.waitProcessExit(procIdentity, 5*time.Second)
+			err = waitProcessExit(procIdentity, 5*time.Second)
 			if err != nil {
 				return fmt.Errorf("failed to stop container pid=%d: %w", containerPid, err)
 			}
 		}
+	case "KILL":
+		stage = "wait_exit_kill"
+		err = waitProcessExit(procIdentity, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to stop container pid=%d: %w", containerPid, err)
+		}
 	}
-
-	// if shim pid > 0, the container created with interactive mode
-	// clean up files for shim
-	stage = "cleanup_shim"
-	if shimPid > 0 {
-		_ = c.cleanupShim(opt.ContainerId)
+	if procIdentity.Alive() {
+		// the signal did not stop the container
+		return nil
 	}
 
-	// 4. update status file
+	// 5. wait for the shim to record the exit
 	//      status = stopped
 	//      pid = 0
 	//		shimPid = 0
+	//    the shim also removes tty.sock
+	stage = "wait_exit_record"
+	err = c.waitShimExit(opt.ContainerId, shimIdentity, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	// 6. update status file
+	//    without a shim, or with a shim that exited before recording the
+	//    exit, nobody else marks the container stopped
 	stage = "update_state"
-	err = c.containerStatusManager.UpdateStatus(
-		opt.ContainerId,
-		status.STOPPED,
-		0,
-		0,
-	)
+	containerStatus, err = c.containerStatusManager.GetStatusFromId(opt.ContainerId)
 	if err != nil {
 		return err
 	}
+	if containerStatus != status.STOPPED {
+		err = c.containerStatusManager.UpdateStatus(
+			opt.ContainerId,
+			status.STOPPED,
+			0,
+			0,
+		)
+		if err != nil {
+			return err
+		}
+	}
 
-	// 5. HOOK: stopContainer
+	// if shim pid > 0, the container ran under a shim that is gone now
+	// clean up what it left behind
+	stage = "cleanup_shim"
+	if shimIdentity.Pid > 0 {
+		_ = c.cleanupShim(opt.ContainerId)
+	}
+
+	// 7. HOOK: stopContainer
+	//    the container is already stopped at this point; failures are
+	//    warnings unless io.raind.hooks.onFailure requests abort
 	stage = "hook_stopContainer"
 	err = c.containerHookController.RunStopContainerHooks(
 		opt.ContainerId,
@@ -182,91 +225,44 @@ func (c *ContainerKill) Kill(opt KillOption) (err error) {
 
 func (c *ContainerKill) cleanupShim(containerId string) error {
 	// remove tty.sock
-	if err := c.syscallHandler.Remove(utils.SockPath(containerId)); err != nil {
+	if err := c.syscallHandler.Remove(utils.SockPath(containerId)); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	// remove init.pid
-	if err := c.syscallHandler.Remove(utils.InitPidFilePath(containerId)); err != nil {
+	if err := c.syscallHandler.Remove(utils.InitPidFilePath(containerId)); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
 }
 
-func (c *ContainerKill) waitProcessExit(procIdentity ProcIdentity, timeout time.Duration) error {
+// waitShimExit waits until the shim has recorded the exit of the
+// container, or is gone. A container without a shim returns at once.
+func (c *ContainerKill) waitShimExit(containerId string, shimIdentity utils.ProcIdentity, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
-	for {
-		// retrieve proc starttime
-		currentStart, err := c.readProcStartTime(procIdentity.Pid)
+	for shimIdentity.Alive() {
+		containerStatus, err := c.containerStatusManager.GetStatusFromId(containerId)
 		if err != nil {
-			if os.IsNotExist(err) {
-				// exit
-				return nil
-			}
-		}
-		if currentStart != procIdentity.StartTime {
-			// re-used proc, exit
-			return nil
+			return err
 		}
-		// exit when /proc/<pid> is removed
-		if _, err := os.Stat(fmt.Sprintf("/proc/%d", procIdentity.Pid)); os.IsNotExist(err) {
+		if containerStatus == status.STOPPED {
 			return nil
 		}
-
 		if time.Now().After(deadline) {
-			return context.DeadlineExceeded
+			return fmt.Errorf("shim pid=%d did not record the exit: %w", shimIdentity.Pid, context.DeadlineExceeded)
 		}
 		time.Sleep(50 * time.Millisecond)
 	}
+	return nil
 }
 
-type ProcIdentity struct {
-	Pid       int
-	StartTime uint64
-}
-
-func (c *ContainerKill) readProcStartTime(pid int) (uint64, error) {
-	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
-	if err != nil {
-		return 0, err
-	}
-
-	// stat format
-	//  no  value     field
-	// ---+---------+-----------
-	//  1   12345     pid
-	//  2   (bash)    command
-	//  3   S         state
-	//  4   652001    ppid
-	//  5   652095    pgrp
-	//  6   652095    session
-	//  7   34819     tty_nr
-	//  8   679797    tpgid
-	//  9   4194304   flags
-	//  10  220000    minflt
-	//  11  1319082   cminflt
-	//  12  0         majflt
-	//  13  342       cmajflt
-	//  14  175       utime
-	//  15  162       stime
-	//  16  2688      cutime
-	//  17  1141      cstime
-	//  18  20        priority
-	//  19  0         nice
-	//  20  1         num_threads
-	//  21  0         itrealvalue
-	//  22  48825543  **starttime**
-	//  23  6381568   vsize
-	//  24  1280      rss
-	//       :
-	s := string(b)
-	idx := strings.LastIndex(s, ")")
-	if idx < 0 {
-		return 0, fmt.Errorf("invalid stat format")
-	}
-	fields := strings.Fields(s[idx+1:])
-	startTime, err := strconv.ParseUint(fields[19], 10, 64)
-	if err != nil {
-		return 0, err
+// waitProcessExit waits until the process is gone or its pid is reused.
+func waitProcessExit(procIdentity utils.ProcIdentity, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for procIdentity.Alive() {
+		if time.Now().After(deadline) {
+			return context.DeadlineExceeded
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
-	return startTime, nil
+	return nil
 }
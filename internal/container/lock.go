@@ -0,0 +1,35 @@
+package container
+
+import (
+	"droplet/internal/utils"
+	"fmt"
+	"os"
+)
+
+// lockContainer takes the lifecycle lock of a container, which serializes
+// create, start, kill, delete and the setup phase of run across processes.
+// The lock is released with Unlock, or when the process exits.
+func lockContainer(containerId string) (*utils.FileLock, error) {
+	lock, err := utils.LockFile(utils.ContainerLockPath(containerId))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("container %s does not exist", containerId)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock container %s: %w", containerId, err)
+	}
+	return lock, nil
+}
+
+// checkContainerNotExists fails if a container with the ID already has a
+// state.json. It is called under the lifecycle lock, before create or run
+// writes anything for the container.
+func checkContainerNotExists(containerId string) error {
+	_, err := os.Lstat(utils.ContainerStatePath(containerId))
+	if err == nil {
+		return fmt.Errorf("container %s already exists", containerId)
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
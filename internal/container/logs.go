@@ -0,0 +1,374 @@
+package container
+
+import (
+	"bytes"
+	"droplet/internal/logs"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// NewContainerLogs constructs a ContainerLogs that prints to the standard
+// output and error.
+func NewContainerLogs() *ContainerLogs {
+	return &ContainerLogs{
+		specLoader:             newFileSpecLoader(),
+		containerStatusManager: status.NewStatusHandler(),
+		stdout:                 os.Stdout,
+		stderr:                 os.Stderr,
+		pollInterval:           250 * time.Millisecond,
+	}
+}
+
+// ContainerLogs prints the output of a container, or of its exec
+// sessions, from the log files written by the shim (console.log,
+// exec_console.log) or, for processes started without a tty, by the
+// runtime (init.log, exec.log).
+type ContainerLogs struct {
+	specLoader             specLoader
+	containerStatusManager status.ContainerStatusManager
+	stdout                 io.Writer
+	stderr                 io.Writer
+	pollInterval           time.Duration
+}
+
+// Execute prints the log selected by opt.
+//
+// The workflow is:
+//  1. Resolve the log file and its format
+//  2. Read the rotated files, oldest first, and the current file
+//  3. Apply --since and --tail and print the lines
+//  4. With --follow, keep reading new lines across rotations until the
+//     container stops
+func (c *ContainerLogs) Execute(opt LogsOption) error {
+	// 1. resolve log
+	path, format, err := c.resolveLog(opt)
+	if err != nil {
+		return err
+	}
+	if format == logs.ConsoleLogRaw && (opt.Timestamps || !opt.Since.IsZero()) {
+		return fmt.Errorf("--timestamps and --since require the json or cri log format")
+	}
+
+	printer := &logPrinter{stdout: c.stdout, stderr: c.stderr, timestamps: opt.Timestamps}
+	reader := newLogLineReader(format)
+	var tail []logLine
+	emit := func(line logLine) error {
+		if !opt.Since.IsZero() && line.time.Before(opt.Since) {
+			return nil
+		}
+		if opt.Tail < 0 {
+			return printer.print(line)
+		}
+		tail = append(tail, line)
+		if len(tail) > opt.Tail {
+			tail = tail[1:]
+		}
+		return nil
+	}
+
+	// 2. existing content
+	for _, p := range rotatedLogFiles(path) {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := reader.feed(data, emit); err != nil {
+			return err
+		}
+	}
+	cur, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var offset int64
+	if cur != nil {
+		defer func() { _ = cur.Close() }()
+		n, err := c.readFrom(cur, reader, emit)
+		if err != nil {
+			return err
+		}
+		offset = n
+	}
+
+	if !opt.Follow {
+		if err := reader.flush(emit); err != nil {
+			return err
+		}
+	}
+
+	// 3. print the tail
+	for _, line := range tail {
+		if err := printer.print(line); err != nil {
+			return err
+		}
+	}
+	if !opt.Follow {
+		return nil
+	}
+	emit = func(line logLine) error {
+		if !opt.Since.IsZero() && line.time.Before(opt.Since) {
+			return nil
+		}
+		return printer.print(line)
+	}
+
+	// 4. follow
+	for {
+		done := c.containerDone(opt.ContainerId)
+
+		if cur != nil {
+			if st, err := cur.Stat(); err == nil && st.Size() < offset {
+				// truncated in place
+				if _, err := cur.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				offset = 0
+			}
+			n, err := c.readFrom(cur, reader, emit)
+			if err != nil {
+				return err
+			}
+			offset += n
+		}
+
+		// the file was rotated or recreated: finish the old file and
+		// continue with the new one
+		if rotated(path, cur) {
+			if cur != nil {
+				// writes that raced with the rename
+				if _, err := c.readFrom(cur, reader, emit); err != nil {
+					return err
+				}
+				_ = cur.Close()
+				cur = nil
+			}
+			if f, err := os.Open(path); err == nil {
+				cur, offset = f, 0
+				continue
+			}
+		}
+
+		// a raw log is shown as it is written, so that an unterminated
+		// line such as a shell prompt appears without waiting for its end
+		if err := reader.flushRaw(emit); err != nil {
+			return err
+		}
+
+		if done {
+			return reader.flush(emit)
+		}
+		time.Sleep(c.pollInterval)
+	}
+}
+
+// resolveLog selects the console log written by the shim, or the plain log
+// of a process started without a tty when there is no console log.
+func (c *ContainerLogs) resolveLog(opt LogsOption) (string, logs.ConsoleLogFormat, error) {
+	spec, err := c.specLoader.loadFile(opt.ContainerId)
+	if err != nil {
+		return "", "", err
+	}
+	cfg, err := logs.ParseConsoleLogConfig(
+		spec.Annotations.LogFormat(),
+		spec.Annotations.LogMaxSize(),
+		spec.Annotations.LogMaxFiles(),
+	)
+	if err != nil {
+		// the shim falls back to raw as well
+		cfg.Format = logs.ConsoleLogRaw
+	}
+	// the shim records the format it chose, which without a tty also
+	// depends on how the container was created
+	var st status.StatusObject
+	if err := utils.ReadJsonFile(utils.ContainerStatePath(opt.ContainerId), &st); err == nil && st.LogFormat != "" && !opt.Exec {
+		cfg.Format = logs.ConsoleLogFormat(st.LogFormat)
+	}
+
+	consoleLog, plainLog := utils.ConsoleLogPath(opt.ContainerId), utils.InitLogPath(opt.ContainerId)
+	if opt.Exec {
+		consoleLog, plainLog = utils.ExecConsoleLogPath(opt.ContainerId), utils.ExecLogPath(opt.ContainerId)
+	}
+	if !logExists(consoleLog) && logExists(plainLog) {
+		return plainLog, logs.ConsoleLogRaw, nil
+	}
+	return consoleLog, cfg.Format, nil
+}
+
+// containerDone reports whether the container no longer produces output.
+func (c *ContainerLogs) containerDone(containerId string) bool {
+	st, err := c.containerStatusManager.GetStatusFromId(containerId)
+	return err != nil || st == status.STOPPED
+}
+
+// readFrom feeds everything that can currently be read from f.
+func (c *ContainerLogs) readFrom(f *os.File, reader *logLineReader, emit func(logLine) error) (int64, error) {
+	var total int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			total += int64(n)
+			if ferr := reader.feed(buf[:n], emit); ferr != nil {
+				return total, ferr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+func logExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// rotatedLogFiles returns the existing rotated files of path, oldest first.
+func rotatedLogFiles(path string) []string {
+	var files []string
+	for n := 1; logExists(logs.RotatedLogPath(path, n)); n++ {
+		files = append([]string{logs.RotatedLogPath(path, n)}, files...)
+	}
+	return files
+}
+
+// rotated reports whether path no longer refers to the open file.
+func rotated(path string, cur *os.File) bool {
+	st, err := os.Stat(path)
+	if cur == nil {
+		return err == nil
+	}
+	if err != nil {
+		return true
+	}
+	curSt, err := cur.Stat()
+	return err != nil || !os.SameFile(st, curSt)
+}
+
+// logLine is an output line assembled from one or more log entries.
+type logLine struct {
+	time   time.Time
+	stream string
+	data   string
+}
+
+// logLineReader splits log file content into entries and joins partial
+// entries into lines, per stream. Content may be fed in arbitrary chunks,
+// across rotated files.
+type logLineReader struct {
+	format  logs.ConsoleLogFormat
+	buf     []byte
+	pending map[string]*logLine
+	order   []string // streams with a pending line, in arrival order
+}
+
+func newLogLineReader(format logs.ConsoleLogFormat) *logLineReader {
+	return &logLineReader{format: format, pending: map[string]*logLine{}}
+}
+
+func (r *logLineReader) feed(data []byte, emit func(logLine) error) error {
+	r.buf = append(r.buf, data...)
+	for {
+		i := bytes.IndexByte(r.buf, '\n')
+		if i < 0 {
+			return nil
+		}
+		line := r.buf[:i+1]
+		r.buf = r.buf[i+1:]
+		if err := r.entry(line, emit); err != nil {
+			return err
+		}
+	}
+}
+
+// flush emits the content that is not terminated yet.
+func (r *logLineReader) flush(emit func(logLine) error) error {
+	// a raw log may end in the middle of a line; an unterminated json or
+	// cri entry is an incomplete write and is dropped
+	if len(r.buf) > 0 && r.format == logs.ConsoleLogRaw {
+		if err := r.entry(r.buf, emit); err != nil {
+			return err
+		}
+	}
+	r.buf = nil
+	for _, stream := range r.order {
+		if err := emit(*r.pending[stream]); err != nil {
+			return err
+		}
+	}
+	r.pending = map[string]*logLine{}
+	r.order = nil
+	return nil
+}
+
+// flushRaw emits the unterminated content of a raw log. The rest of the
+// line is emitted when it is fed. Other formats are left untouched, since
+// their unterminated content is an incomplete entry.
+func (r *logLineReader) flushRaw(emit func(logLine) error) error {
+	if r.format != logs.ConsoleLogRaw || len(r.buf) == 0 {
+		return nil
+	}
+	line := logLine{stream: logs.StreamStdout, data: string(r.buf)}
+	r.buf = nil
+	return emit(line)
+}
+
+func (r *logLineReader) entry(raw []byte, emit func(logLine) error) error {
+	entry, partial, err := logs.ParseConsoleLogLine(r.format, raw)
+	if err != nil {
+		// skip lines that cannot be parsed, e.g. a torn write
+		return nil
+	}
+
+	line, ok := r.pending[entry.Stream]
+	if ok {
+		line.data += entry.Log
+	} else {
+		line = &logLine{time: entry.Time, stream: entry.Stream, data: entry.Log}
+	}
+	if partial {
+		if !ok {
+			r.pending[entry.Stream] = line
+			r.order = append(r.order, entry.Stream)
+		}
+		return nil
+	}
+	if ok {
+		delete(r.pending, entry.Stream)
+		for i, s := range r.order {
+			if s == entry.Stream {
+				r.order = append(r.order[:i], r.order[i+1:]...)
+				break
+			}
+		}
+	}
+	return emit(*line)
+}
+
+// logPrinter writes lines to the stream they were recorded from.
+type logPrinter struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	timestamps bool
+}
+
+func (p *logPrinter) print(line logLine) error {
+	w := p.stdout
+	if line.stream == logs.StreamStderr {
+		w = p.stderr
+	}
+	if p.timestamps {
+		if _, err := io.WriteString(w, line.time.Format(time.RFC3339Nano)+" "); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, line.data)
+	return err
+}
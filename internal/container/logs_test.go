@@ -0,0 +1,247 @@
+package container
+
+import (
+	"bytes"
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLogsSpecLoader struct {
+	spec spec.Spec
+}
+
+func (f *fakeLogsSpecLoader) loadFile(containerId string) (spec.Spec, error) { return f.spec, nil }
+func (f *fakeLogsSpecLoader) loadBundle(bundle string) (spec.Spec, error)    { return f.spec, nil }
+func (f *fakeLogsSpecLoader) configPath(containerId string) (string, error) {
+	return "/bundle/config.json", nil
+}
+
+type fakeLogsStatusManager struct {
+	status.ContainerStatusManager
+	mu     sync.Mutex
+	status status.ContainerStatus
+}
+
+func (f *fakeLogsStatusManager) GetStatusFromId(containerId string) (status.ContainerStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status, nil
+}
+
+func (f *fakeLogsStatusManager) set(st status.ContainerStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = st
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newTestContainerLogs(t *testing.T, format string, st status.ContainerStatus) (*ContainerLogs, *syncBuffer, *syncBuffer, *fakeLogsStatusManager) {
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	assert.Nil(t, os.MkdirAll(utils.LogDir("c1"), 0755))
+	s := spec.Spec{Annotations: spec.AnnotationObject{spec.AnnotationKeyLogFormat: format}}
+	stdout, stderr := &syncBuffer{}, &syncBuffer{}
+	statusManager := &fakeLogsStatusManager{status: st}
+	return &ContainerLogs{
+		specLoader:             &fakeLogsSpecLoader{spec: s},
+		containerStatusManager: statusManager,
+		stdout:                 stdout,
+		stderr:                 stderr,
+		pollInterval:           10 * time.Millisecond,
+	}, stdout, stderr, statusManager
+}
+
+func TestContainerLogs_TailAcrossRotatedFiles(t *testing.T) {
+	// == arrange ==
+	c, stdout, _, _ := newTestContainerLogs(t, "cri", status.STOPPED)
+	path := utils.ConsoleLogPath("c1")
+	assert.Nil(t, os.WriteFile(path+".2", []byte("2026-01-01T00:00:01Z stdout F one\n"), 0640))
+	assert.Nil(t, os.WriteFile(path+".1", []byte("2026-01-01T00:00:02Z stdout F two\n2026-01-01T00:00:03Z stdout P thr\n"), 0640))
+	assert.Nil(t, os.WriteFile(path, []byte("2026-01-01T00:00:04Z stdout F ee\n"), 0640))
+
+	// == act ==
+	err := c.Execute(LogsOption{ContainerId: "c1", Tail: 2, Timestamps: true})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-01-01T00:00:02Z two\n2026-01-01T00:00:03Z three\n", stdout.String())
+}
+
+func TestContainerLogs_JSONStreamsAndSince(t *testing.T) {
+	// == arrange ==
+	c, stdout, stderr, _ := newTestContainerLogs(t, "json", status.STOPPED)
+	data := `{"time":"2026-01-01T00:00:01Z","stream":"stdout","log":"old\n"}` + "\n" +
+		`{"time":"2026-01-01T00:00:02Z","stream":"stdout","log":"new "}` + "\n" +
+		`{"time":"2026-01-01T00:00:02Z","stream":"stderr","log":"err\n"}` + "\n" +
+		`{"time":"2026-01-01T00:00:03Z","stream":"stdout","log":"line\n"}` + "\n"
+	assert.Nil(t, os.WriteFile(utils.ConsoleLogPath("c1"), []byte(data), 0640))
+
+	// == act ==
+	err := c.Execute(LogsOption{ContainerId: "c1", Tail: -1, Since: time.Date(2026, 1, 1, 0, 0, 2, 0, time.UTC)})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "new line\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+}
+
+func TestContainerLogs_RecordedFormat(t *testing.T) {
+	// == arrange ==
+	// no format annotation; the shim of a container without a tty
+	// recorded json
+	c, stdout, stderr, _ := newTestContainerLogs(t, "", status.STOPPED)
+	h := status.NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile("c1", 0, status.CREATED, "/rootfs", "/bundle", nil))
+	assert.Nil(t, h.RecordLogFormat("c1", "json"))
+	data := `{"time":"2026-01-01T00:00:01Z","stream":"stdout","log":"out\n"}` + "\n" +
+		`{"time":"2026-01-01T00:00:02Z","stream":"stderr","log":"err\n"}` + "\n"
+	assert.Nil(t, os.WriteFile(utils.ConsoleLogPath("c1"), []byte(data), 0640))
+
+	// == act ==
+	err := c.Execute(LogsOption{ContainerId: "c1", Tail: -1})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "out\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+}
+
+func TestConsoleSettings_DefaultFormat(t *testing.T) {
+	// == arrange ==
+	logger := log.New(io.Discard, "", 0)
+	unset := spec.Spec{}
+	raw := spec.Spec{Annotations: spec.AnnotationObject{spec.AnnotationKeyLogFormat: "raw"}}
+	invalid := spec.Spec{Annotations: spec.AnnotationObject{spec.AnnotationKeyLogFormat: "xml"}}
+
+	// == act ==
+	_, tty := consoleSettings(unset, false, logger)
+	_, pipes := consoleSettings(unset, true, logger)
+	_, pipesRaw := consoleSettings(raw, true, logger)
+	_, pipesInvalid := consoleSettings(invalid, true, logger)
+
+	// == assert ==
+	assert.Equal(t, logs.ConsoleLogRaw, tty.Format)
+	assert.Equal(t, logs.ConsoleLogJSON, pipes.Format)
+	assert.Equal(t, logs.ConsoleLogRaw, pipesRaw.Format)
+	assert.Equal(t, logs.ConsoleLogJSON, pipesInvalid.Format)
+}
+
+func TestContainerLogs_RawRejectsTimestamps(t *testing.T) {
+	// == arrange ==
+	c, _, _, _ := newTestContainerLogs(t, "", status.STOPPED)
+
+	// == act ==
+	err := c.Execute(LogsOption{ContainerId: "c1", Tail: -1, Timestamps: true})
+
+	// == assert ==
+	assert.NotNil(t, err)
+}
+
+func TestContainerLogs_PlainExecLog(t *testing.T) {
+	// == arrange ==
+	c, stdout, _, _ := newTestContainerLogs(t, "cri", status.STOPPED)
+	assert.Nil(t, os.WriteFile(utils.ExecLogPath("c1"), []byte("a\nb\nno newline"), 0640))
+
+	// == act ==
+	err := c.Execute(LogsOption{ContainerId: "c1", Tail: 2, Exec: true})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "b\nno newline", stdout.String())
+}
+
+func TestContainerLogs_FollowAcrossRotation(t *testing.T) {
+	// == arrange ==
+	c, stdout, _, statusManager := newTestContainerLogs(t, "", status.RUNNING)
+	path := utils.ConsoleLogPath("c1")
+	assert.Nil(t, os.WriteFile(path, []byte("first\n"), 0640))
+	errCh := make(chan error, 1)
+
+	// == act ==
+	go func() { errCh <- c.Execute(LogsOption{ContainerId: "c1", Tail: -1, Follow: true}) }()
+	waitForOutput(t, stdout, "first\n")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0640)
+	assert.Nil(t, err)
+	_, _ = f.WriteString("second\n")
+	_ = f.Close()
+	assert.Nil(t, os.Rename(path, filepath.Join(filepath.Dir(path), "console.log.1")))
+	assert.Nil(t, os.WriteFile(path, []byte("third\n"), 0640))
+	waitForOutput(t, stdout, "first\nsecond\nthird\n")
+	statusManager.set(status.STOPPED)
+
+	// == assert ==
+	select {
+	case err := <-errCh:
+		assert.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("follow did not end after the container stopped")
+	}
+	assert.Equal(t, "first\nsecond\nthird\n", stdout.String())
+}
+
+func TestContainerLogs_FollowRawUnterminatedLine(t *testing.T) {
+	// == arrange ==
+	c, stdout, _, statusManager := newTestContainerLogs(t, "", status.RUNNING)
+	path := utils.ConsoleLogPath("c1")
+	assert.Nil(t, os.WriteFile(path, []byte("first\n/ # "), 0640))
+	errCh := make(chan error, 1)
+
+	// == act ==
+	go func() { errCh <- c.Execute(LogsOption{ContainerId: "c1", Tail: 1, Follow: true}) }()
+	waitForOutput(t, stdout, "first\n/ # ")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0640)
+	assert.Nil(t, err)
+	_, _ = f.WriteString("ls")
+	waitForOutput(t, stdout, "first\n/ # ls")
+	_, _ = f.WriteString("\nbin\n")
+	_ = f.Close()
+	waitForOutput(t, stdout, "first\n/ # ls\nbin\n")
+	statusManager.set(status.STOPPED)
+
+	// == assert ==
+	select {
+	case err := <-errCh:
+		assert.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("follow did not end after the container stopped")
+	}
+	assert.Equal(t, "first\n/ # ls\nbin\n", stdout.String())
+}
+
+func waitForOutput(t *testing.T, b *syncBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for b.String() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("output = %q, want %q", b.String(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
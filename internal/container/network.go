@@ -37,11 +37,18 @@ type containerNetworkController struct {
 //  2. Create and attach a veth pair on the host side
 //  3. Enter the container network namespace and configure the interface
 //
+// If the network annotation is absent (e.g. a standard OCI bundle), network
+// setup is skipped and the namespace is left as created.
+//
 // Returns an error if any networking operation fails.
 func (c *containerNetworkController) prepare(containerId string, pid int, annotation spec.AnnotationObject) error {
+	if annotation.Net() == "" {
+		return nil
+	}
+
 	// 1. retrieve network config from annotation
 	var networkConfig spec.NetConfigObject
-	if err := utils.StringToJson(annotation.Net, &networkConfig); err != nil {
+	if err := utils.StringToJson(annotation.Net(), &networkConfig); err != nil {
 		return err
 	}
 
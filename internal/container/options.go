@@ -1,17 +1,42 @@
 package container
 
+import "time"
+
 // create options
 type CreateOption struct {
-	ContainerId  string
-	PrintPidFlag bool
-	TtyFlag      bool
+	ContainerId   string
+	Bundle        string
+	PrintPidFlag  bool
+	TtyFlag       bool
+	PidFile       string
+	ConsoleSocket string
+	PreserveFds   int
+	NoPivot       bool
+	NoNewKeyring  bool
+	HooksDir      string
 }
 
 // init options
 type InitOption struct {
-	ContainerId string
-	Fifo        string
-	Entrypoint  []string
+	ContainerId  string
+	Fifo         string
+	Entrypoint   []string
+	ListenFds    int
+	PreserveFds  int
+	NoPivot      bool
+	NoNewKeyring bool
+}
+
+// shim options
+type ShimOption struct {
+	ContainerId  string
+	Fifo         string
+	Entrypoint   []string
+	ListenFds    int
+	PreserveFds  int
+	NoPivot      bool
+	NoNewKeyring bool
+	NoTty        bool // run init on pipes instead of a pty
 }
 
 // start options
@@ -21,9 +46,16 @@ type StartOption struct {
 
 // run options
 type RunOption struct {
-	ContainerId  string
-	Tty          bool
-	PrintPidFlag bool
+	ContainerId   string
+	Bundle        string
+	Tty           bool
+	PrintPidFlag  bool
+	PidFile       string
+	ConsoleSocket string
+	PreserveFds   int
+	NoPivot       bool
+	NoNewKeyring  bool
+	HooksDir      string
 }
 
 // exec options
@@ -47,4 +79,31 @@ type DeleteOption struct {
 // attach options
 type AttachOption struct {
 	ContainerId string
+	ReadOnly    bool
+	Replay      int64 // bytes of history to replay
+	SinceStart  bool  // replay all history still held by the shim
+	DetachKeys  string
+	SigProxy    bool // forward received signals to the container process
+}
+
+// logs options
+type LogsOption struct {
+	ContainerId string
+	Follow      bool
+	Tail        int       // number of lines from the end, -1 for all
+	Since       time.Time // zero for all
+	Timestamps  bool
+	Exec        bool // the log of the exec sessions
+}
+
+// wait options
+type WaitOption struct {
+	ContainerId string
+	Condition   WaitCondition
+	Timeout     time.Duration // 0 waits forever
+}
+
+// prune options
+type PruneOption struct {
+	DryRun bool
 }
@@ -0,0 +1,155 @@
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// Shim control protocol.
+//
+// Every message is a frame: a 1 byte type, a 4 byte big-endian payload
+// length and the payload. Clients always send frames. The shim answers with
+// raw output unless the client opened with a frameHello, in which case
+// the shim replies with its own frameHello and frames everything it sends
+// from then on, so that control frames (frameExit) can be interleaved with
+// the output.
+const (
+	frameData       = 0x00 // input, and the output of a pty or of the stdout pipe
+	frameResize     = 0x01 // client: rows(2) cols(2)
+	frameReadOnly   = 0x02 // client: marks the connection as a viewer
+	frameReplay     = 0x03 // client: requests the output history, sent before any other frame but frameHello
+	frameHello      = 0x04 // both: version(2) capabilities(4), the first frame of a versioned connection
+	frameSignal     = 0x05 // client: signal number(4) to deliver to the container process
+	frameCloseStdin = 0x06 // client: no more input; the stdin pipe is closed, or EOF is written to the pty
+	frameExit       = 0x07 // shim: exit status(4) of the container process
+	frameStderr     = 0x08 // shim: output of the stderr pipe of a process without a terminal
+)
+
+// replay request modes (first byte of a frameReplay payload)
+const (
+	replayLast  = 0x00 // the last N bytes before the client attached
+	replaySince = 0x01 // everything since the given stream offset
+)
+
+// protocolVersion is the version announced in frameHello. Version 0 is the
+// unversioned protocol of clients that never send a frameHello.
+const protocolVersion = 1
+
+// capabilities announced in frameHello
+const (
+	capSignal     uint32 = 1 << 0 // frameSignal is accepted
+	capCloseStdin uint32 = 1 << 1 // frameCloseStdin is accepted
+	capExitStatus uint32 = 1 << 2 // frameExit is sent when the process exits
+	capStderr     uint32 = 1 << 3 // stderr is sent as frameStderr; announced by a shim whose process has no pty
+)
+
+// shimCapabilities is the capability set of every shim. A shim running the
+// process on pipes adds capStderr.
+const shimCapabilities = capSignal | capCloseStdin | capExitStatus
+
+// maxFrameSize bounds the payload of a single frame.
+const maxFrameSize = 8 * 1024 * 1024
+
+// writeFrame writes a frame with a single Write, so frames sent from
+// several goroutines over one connection never interleave.
+func writeFrame(w io.Writer, typ byte, payload []byte) error {
+	b := make([]byte, 5+len(payload))
+	b[0] = typ
+	binary.BigEndian.PutUint32(b[1:5], uint32(len(payload)))
+	copy(b[5:], payload)
+	_, err := w.Write(b)
+	return err
+}
+
+// readFrame reads the next frame from r.
+func readFrame(r io.Reader) (byte, []byte, error) {
+	h := make([]byte, 1+4)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return 0, nil, err
+	}
+	typ := h[0]
+	n := binary.BigEndian.Uint32(h[1:5])
+	if n > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame too large: %d", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return typ, payload, nil
+}
+
+type hello struct {
+	version      uint16
+	capabilities uint32
+}
+
+func (h hello) encode() []byte {
+	p := make([]byte, 6)
+	binary.BigEndian.PutUint16(p[0:2], h.version)
+	binary.BigEndian.PutUint32(p[2:6], h.capabilities)
+	return p
+}
+
+func decodeHello(p []byte) (hello, error) {
+	if len(p) != 6 {
+		return hello{}, fmt.Errorf("invalid hello frame: %d bytes", len(p))
+	}
+	return hello{
+		version:      binary.BigEndian.Uint16(p[0:2]),
+		capabilities: binary.BigEndian.Uint32(p[2:6]),
+	}, nil
+}
+
+func encodeUint32(v uint32) []byte {
+	p := make([]byte, 4)
+	binary.BigEndian.PutUint32(p, v)
+	return p
+}
+
+// exitStatus converts the result of waiting for a process into a shell
+// style exit status: the exit code, or 128+signal if it was killed.
+func exitStatus(waitErr error) int {
+	return waitStatusCode(waitStatusOf(waitErr))
+}
+
+// waitStatusOf extracts the wait status from the result of waiting for a
+// process. A nil error is a successful exit, and an error that carries no
+// status is reported as exit code 1.
+func waitStatusOf(waitErr error) syscall.WaitStatus {
+	if waitErr == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return ws
+		}
+	}
+	return syscall.WaitStatus(1 << 8)
+}
+
+// waitStatusCode converts a wait status into a shell style exit status.
+func waitStatusCode(ws syscall.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
+
+// ExitStatusError carries the exit status of a container process to the
+// command line, which exits with it.
+type ExitStatusError struct {
+	Status int
+}
+
+func (e *ExitStatusError) Error() string {
+	return fmt.Sprintf("container process exited with status %d", e.Status)
+}
@@ -0,0 +1,364 @@
+package container
+
+import (
+	"bytes"
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewContainerPrune constructs a ContainerPrune with the default
+// implementations of its dependencies.
+func NewContainerPrune() *ContainerPrune {
+	return &ContainerPrune{
+		commandFactory: utils.NewCommandFactory(),
+		syscallHandler: utils.NewSyscallHandler(),
+		cgroupRoot:     utils.CgroupRootDir(),
+		stdout:         os.Stdout,
+	}
+}
+
+// ContainerPrune removes what crashed or abandoned containers leave
+// behind: stale state files, FIFOs, sockets, pid and lock files, empty
+// cgroups and orphaned host veths.
+//
+// The container directory itself, its config.json and logs are kept, as
+// they may belong to the high-level runtime.
+type ContainerPrune struct {
+	commandFactory utils.CommandFactory
+	syscallHandler utils.KernelSyscallHandler
+	cgroupRoot     string
+	stdout         io.Writer
+}
+
+// pruneTarget is a container directory found in the state root.
+type pruneTarget struct {
+	containerId string
+	state       *status.StatusObject // nil if there is no readable state.json
+}
+
+// Execute prunes every container whose processes are gone.
+//
+// A stopped container whose exit was recorded is not stale: its state
+// still carries the exit status and it is removed by delete.
+//
+// The workflow is:
+//  1. Read the container directories of the state root
+//  2. For each container that no lifecycle command holds, whose init and
+//     shim processes are gone and that has no recorded exit:
+//     a. Delete its host veth if it is a veth on the configured bridge
+//     that no live container uses
+//     b. Remove its cgroup if no process is left in it
+//     c. Discard the volatile rootfs (overlay-volatile only)
+//     d. Remove state.json, exec.fifo, the sockets, init.pid and the
+//     lock files
+//  3. Remove the empty cgroups of containers that no longer exist
+//
+// Each removal is printed, and recorded in the audit log per container.
+// With DryRun nothing is removed and the removals are only printed.
+func (c *ContainerPrune) Execute(opt PruneOption) error {
+	// 1. read containers
+	targets, err := c.readTargets()
+	if err != nil {
+		return err
+	}
+	liveVeths := map[string]bool{}
+	for _, target := range targets {
+		if target.state != nil && pruneKeeps(*target.state) {
+			if name := hostVeth(target.state.Annotations).Interface.Name; name != "" {
+				liveVeths[name] = true
+			}
+		}
+	}
+
+	// 2. prune containers
+	var errs []error
+	for _, target := range targets {
+		if err := c.pruneContainer(target, liveVeths, opt); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.containerId, err))
+		}
+	}
+
+	// 3. cgroups without a container
+	if err := c.pruneOrphanCgroups(opt); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *ContainerPrune) readTargets() ([]pruneTarget, error) {
+	entries, err := os.ReadDir(utils.DefaultRootDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var targets []pruneTarget
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		target := pruneTarget{containerId: entry.Name()}
+		var st status.StatusObject
+		if err := utils.ReadJsonFile(utils.ContainerStatePath(entry.Name()), &st); err == nil {
+			target.state = &st
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// pruneRecorder prints and records the removals of a container, or only
+// prints them in a dry run.
+type pruneRecorder struct {
+	containerId string
+	dryRun      bool
+	stdout      io.Writer
+	removed     []string
+}
+
+func (r *pruneRecorder) remove(what string, fn func() error) error {
+	if r.dryRun {
+		fmt.Fprintf(r.stdout, "%s: would remove %s\n", r.containerId, what)
+		return nil
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	r.removed = append(r.removed, what)
+	fmt.Fprintf(r.stdout, "%s: removed %s\n", r.containerId, what)
+	return nil
+}
+
+// audit records the removals in the audit log. Dry runs and containers
+// without removals are not recorded.
+func (r *pruneRecorder) audit(stage string, err error) {
+	if r.dryRun || (len(r.removed) == 0 && err == nil) {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "fail"
+	}
+	_ = logs.RecordAuditLog(logs.AuditRecord{
+		ContainerId: r.containerId,
+		Event:       "prune",
+		Stage:       stage,
+		Removed:     r.removed,
+		Result:      result,
+		Error:       err,
+	})
+}
+
+// processesGone reports whether neither the init process nor the shim of
+// the container is running.
+func processesGone(st status.StatusObject) bool {
+	return !st.InitIdentity().Alive() && !st.ShimIdentity().Alive()
+}
+
+// pruneKeeps reports whether the container is left to the lifecycle
+// commands: its processes still run, or its exit was recorded and delete
+// removes it.
+func pruneKeeps(st status.StatusObject) bool {
+	return st.ExitCode != nil || !processesGone(st)
+}
+
+func (c *ContainerPrune) pruneContainer(target pruneTarget, liveVeths map[string]bool, opt PruneOption) (err error) {
+	containerId := target.containerId
+	recorder := &pruneRecorder{containerId: containerId, dryRun: opt.DryRun, stdout: c.stdout}
+	stage := "lock"
+	defer func() { recorder.audit(stage, err) }()
+
+	// a lifecycle command holding the container is still working on it
+	lockPath := utils.ContainerLockPath(containerId)
+	_, statErr := os.Lstat(lockPath)
+	lockExisted := statErr == nil
+	lock, err := utils.TryLockFile(lockPath)
+	if errors.Is(err, utils.ErrLocked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// the state may have changed before the lock was taken
+	stage = "check_processes"
+	var annotations spec.AnnotationObject
+	var st status.StatusObject
+	if err := utils.ReadJsonFile(utils.ContainerStatePath(containerId), &st); err == nil {
+		if pruneKeeps(st) {
+			if !lockExisted {
+				_ = removeIfExists(lockPath)
+			}
+			return nil
+		}
+		annotations = st.Annotations
+	}
+
+	// a. host veth
+	stage = "remove_veth"
+	if netConfig := hostVeth(annotations); netConfig.Interface.Name != "" && !liveVeths[netConfig.Interface.Name] {
+		name := netConfig.Interface.Name
+		if c.isOrphanVeth(name, netConfig.BridgeInterface) {
+			if err := recorder.remove("veth "+name, func() error { return c.deleteLink(name) }); err != nil {
+				return err
+			}
+		}
+	}
+
+	// b. cgroup
+	stage = "remove_cgroup"
+	if err := c.pruneCgroup(filepath.Join(c.cgroupRoot, containerId), recorder); err != nil {
+		return err
+	}
+
+	// c. volatile rootfs
+	stage = "remove_volatile_rootfs"
+	if _, err := os.Lstat(utils.VolatileDir(containerId)); err == nil {
+		if err := recorder.remove(utils.VolatileDir(containerId), func() error {
+			return removeVolatileRootfs(c.syscallHandler, containerId)
+		}); err != nil {
+			return err
+		}
+	}
+
+	// d. runtime files
+	stage = "remove_files"
+	files := []string{
+		utils.ContainerStatePath(containerId),
+		utils.FifoPath(containerId),
+		utils.SockPath(containerId),
+		utils.ExecSockPath(containerId),
+		utils.InitPidFilePath(containerId),
+		utils.ContainerStateLockPath(containerId),
+	}
+	for _, path := range files {
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		if err := recorder.remove(path, func() error { return removeIfExists(path) }); err != nil {
+			return err
+		}
+	}
+
+	// the lock file last; a command waiting for it retries on a new file
+	if !lockExisted {
+		// created by this prune
+		return removeIfExists(lockPath)
+	}
+	return recorder.remove(lockPath, func() error { return removeIfExists(lockPath) })
+}
+
+// pruneCgroup removes the cgroup at path if it exists and neither a
+// process nor a child cgroup is left in it.
+func (c *ContainerPrune) pruneCgroup(path string, recorder *pruneRecorder) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return nil
+		}
+	}
+	procs, err := os.ReadFile(filepath.Join(path, "cgroup.procs"))
+	if err != nil || len(bytes.TrimSpace(procs)) > 0 {
+		return nil
+	}
+	return recorder.remove(path, func() error {
+		if err := c.syscallHandler.Rmdir(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// pruneOrphanCgroups removes the empty cgroups of containers whose
+// directory no longer exists.
+func (c *ContainerPrune) pruneOrphanCgroups(opt PruneOption) error {
+	entries, err := os.ReadDir(c.cgroupRoot)
+	if err != nil {
+		return nil
+	}
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		containerId := entry.Name()
+		if _, err := os.Stat(utils.ContainerDir(containerId)); !os.IsNotExist(err) {
+			continue
+		}
+		recorder := &pruneRecorder{containerId: containerId, dryRun: opt.DryRun, stdout: c.stdout}
+		err := c.pruneCgroup(filepath.Join(c.cgroupRoot, containerId), recorder)
+		recorder.audit("remove_cgroup", err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", containerId, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hostVeth returns the network config of the io.raind.net.config
+// annotation; its interface name is the host side of the veth pair.
+func hostVeth(annotations spec.AnnotationObject) spec.NetConfigObject {
+	var netConfig spec.NetConfigObject
+	if annotations.Net() == "" {
+		return netConfig
+	}
+	if err := utils.StringToJson(annotations.Net(), &netConfig); err != nil {
+		return spec.NetConfigObject{}
+	}
+	return netConfig
+}
+
+// isOrphanVeth reports whether name is a veth attached to bridge. Any
+// other link of that name, e.g. a physical interface, is never touched.
+func (c *ContainerPrune) isOrphanVeth(name string, bridge string) bool {
+	var out bytes.Buffer
+	cmd := c.commandFactory.Command("ip", "-j", "-d", "link", "show", "dev", name)
+	cmd.SetStdout(&out)
+	cmd.SetStderr(io.Discard)
+	if err := cmd.Run(); err != nil {
+		return false
+	}
+	var links []struct {
+		Ifname   string `json:"ifname"`
+		Master   string `json:"master"`
+		LinkInfo struct {
+			InfoKind string `json:"info_kind"`
+		} `json:"linkinfo"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &links); err != nil || len(links) != 1 {
+		return false
+	}
+	link := links[0]
+	return link.Ifname == name && link.LinkInfo.InfoKind == "veth" && bridge != "" && link.Master == bridge
+}
+
+func (c *ContainerPrune) deleteLink(name string) error {
+	var stderr bytes.Buffer
+	cmd := c.commandFactory.Command("ip", "link", "del", "dev", name)
+	cmd.SetStderr(&stderr)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ip link del %s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
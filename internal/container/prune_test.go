@@ -0,0 +1,237 @@
+package container
+
+import (
+	"bytes"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLinkCommand answers "ip -j -d link show" with the configured links
+// and records the other commands.
+type fakeLinkCommand struct {
+	utils.CommandExecutor
+	factory *fakeLinkCommandFactory
+	args    []string
+	stdout  io.Writer
+}
+
+func (c *fakeLinkCommand) SetStdout(w io.Writer) { c.stdout = w }
+func (c *fakeLinkCommand) SetStderr(w io.Writer) {}
+
+func (c *fakeLinkCommand) Run() error {
+	if len(c.args) > 2 && c.args[0] == "-j" {
+		name := c.args[len(c.args)-1]
+		link, ok := c.factory.links[name]
+		if !ok {
+			return errors.New("device not found")
+		}
+		_, err := io.WriteString(c.stdout, link)
+		return err
+	}
+	c.factory.ran = append(c.factory.ran, strings.Join(c.args, " "))
+	return nil
+}
+
+type fakeLinkCommandFactory struct {
+	links map[string]string // ip -j -d link show output per link
+	ran   []string
+}
+
+func (f *fakeLinkCommandFactory) Command(name string, args ...string) utils.CommandExecutor {
+	return &fakeLinkCommand{factory: f, args: args}
+}
+
+// fakeRmdirSyscall removes cgroup directories, which unlike a real
+// cgroup still hold their control files.
+type fakeRmdirSyscall struct {
+	utils.KernelSyscallHandler
+}
+
+func (f *fakeRmdirSyscall) Rmdir(path string) error { return os.RemoveAll(path) }
+
+func (f *fakeRmdirSyscall) Unmount(target string, flags int) error { return syscall.EINVAL }
+
+func newTestContainerPrune(t *testing.T) (*ContainerPrune, *bytes.Buffer, *fakeLinkCommandFactory) {
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	stdout := &bytes.Buffer{}
+	factory := &fakeLinkCommandFactory{links: map[string]string{}}
+	return &ContainerPrune{
+		commandFactory: factory,
+		syscallHandler: &fakeRmdirSyscall{},
+		cgroupRoot:     t.TempDir(),
+		stdout:         stdout,
+	}, stdout, factory
+}
+
+// writeTestContainer creates a container directory with a state.json and
+// the given runtime files.
+func writeTestContainer(t *testing.T, containerId string, pid int, annotations spec.AnnotationObject, files ...string) {
+	t.Helper()
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir(containerId), 0755))
+	h := status.NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile(containerId, 0, status.CREATED, "/rootfs", "/bundle", annotations))
+	assert.Nil(t, h.UpdateStatus(containerId, status.RUNNING, pid, 0))
+	for _, f := range files {
+		assert.Nil(t, os.WriteFile(filepath.Join(utils.ContainerDir(containerId), f), nil, 0600))
+	}
+}
+
+func netAnnotation(name string) spec.AnnotationObject {
+	return spec.AnnotationObject{
+		spec.AnnotationKeyNet: `{"hostInterface":"eth0","bridgeInterface":"raind0","interface":{"name":"` + name + `"}}`,
+	}
+}
+
+const vethLink = `[{"ifname":"%s","master":"raind0","linkinfo":{"info_kind":"veth"}}]`
+
+func TestContainerPrune_RemovesStaleContainer(t *testing.T) {
+	// == arrange ==
+	c, stdout, factory := newTestContainerPrune(t)
+	writeTestContainer(t, "c1", 1<<22, netAnnotation("veth-c1"),
+		"exec.fifo", "tty.sock", "init.pid", "lock", "config.json")
+	factory.links["veth-c1"] = strings.Replace(vethLink, "%s", "veth-c1", 1)
+	cgroup := filepath.Join(c.cgroupRoot, "c1")
+	assert.Nil(t, os.MkdirAll(cgroup, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(cgroup, "cgroup.procs"), nil, 0644))
+
+	// == act ==
+	err := c.Execute(PruneOption{})
+
+	// == assert ==
+	assert.Nil(t, err)
+	for _, f := range []string{"state.json", "state.lock", "exec.fifo", "tty.sock", "init.pid", "lock"} {
+		_, err := os.Lstat(filepath.Join(utils.ContainerDir("c1"), f))
+		assert.True(t, os.IsNotExist(err), f)
+	}
+	_, err = os.Stat(filepath.Join(utils.ContainerDir("c1"), "config.json"))
+	assert.Nil(t, err)
+	_, err = os.Stat(cgroup)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, []string{"link del dev veth-c1"}, factory.ran)
+	assert.Contains(t, stdout.String(), "c1: removed veth veth-c1\n")
+	assert.Contains(t, stdout.String(), "c1: removed "+utils.FifoPath("c1")+"\n")
+}
+
+func TestContainerPrune_DryRun(t *testing.T) {
+	// == arrange ==
+	c, stdout, factory := newTestContainerPrune(t)
+	writeTestContainer(t, "c1", 1<<22, netAnnotation("veth-c1"), "exec.fifo")
+	factory.links["veth-c1"] = strings.Replace(vethLink, "%s", "veth-c1", 1)
+
+	// == act ==
+	err := c.Execute(PruneOption{DryRun: true})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Contains(t, stdout.String(), "c1: would remove veth veth-c1\n")
+	assert.Contains(t, stdout.String(), "c1: would remove "+utils.ContainerStatePath("c1")+"\n")
+	assert.Empty(t, factory.ran)
+	for _, f := range []string{"state.json", "exec.fifo"} {
+		_, err := os.Lstat(filepath.Join(utils.ContainerDir("c1"), f))
+		assert.Nil(t, err, f)
+	}
+	// the lock file taken by the dry run is not left behind
+	_, err = os.Lstat(utils.ContainerLockPath("c1"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestContainerPrune_KeepsLiveContainers(t *testing.T) {
+	// == arrange ==
+	c, stdout, factory := newTestContainerPrune(t)
+	writeTestContainer(t, "live", os.Getpid(), netAnnotation("veth-shared"), "exec.fifo")
+	// a stale container that recorded the same interface name
+	writeTestContainer(t, "stale", 1<<22, netAnnotation("veth-shared"))
+	factory.links["veth-shared"] = strings.Replace(vethLink, "%s", "veth-shared", 1)
+
+	// == act ==
+	err := c.Execute(PruneOption{})
+
+	// == assert ==
+	assert.Nil(t, err)
+	_, err = os.Lstat(utils.FifoPath("live"))
+	assert.Nil(t, err)
+	_, err = os.Lstat(utils.ContainerStatePath("live"))
+	assert.Nil(t, err)
+	_, err = os.Lstat(utils.ContainerStatePath("stale"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Empty(t, factory.ran)
+	assert.NotContains(t, stdout.String(), "live:")
+}
+
+func TestContainerPrune_KeepsStoppedContainerWithExit(t *testing.T) {
+	// == arrange ==
+	c, stdout, factory := newTestContainerPrune(t)
+	writeTestContainer(t, "c1", 1<<22, netAnnotation("veth-c1"), "exec.fifo")
+	factory.links["veth-c1"] = strings.Replace(vethLink, "%s", "veth-c1", 1)
+	h := status.NewStatusHandler()
+	assert.Nil(t, h.RecordExit("c1", status.ExitInfo{ExitCode: 3, FinishedAt: time.Now()}))
+
+	// == act ==
+	err := c.Execute(PruneOption{})
+
+	// == assert ==
+	assert.Nil(t, err)
+	st, err := h.ReadStatusFile("c1")
+	assert.Nil(t, err)
+	assert.Contains(t, st, `"exitCode": 3`)
+	_, err = os.Lstat(utils.FifoPath("c1"))
+	assert.Nil(t, err)
+	_, err = os.Lstat(utils.ContainerLockPath("c1"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Empty(t, factory.ran)
+	assert.Empty(t, stdout.String())
+}
+
+func TestContainerPrune_SkipsLockedAndNonVethLinks(t *testing.T) {
+	// == arrange ==
+	c, _, factory := newTestContainerPrune(t)
+	writeTestContainer(t, "busy", 1<<22, nil, "exec.fifo")
+	writeTestContainer(t, "c1", 1<<22, netAnnotation("eth0"))
+	factory.links["eth0"] = `[{"ifname":"eth0","linkinfo":{"info_kind":"vlan"}}]`
+	lock, err := utils.LockFile(utils.ContainerLockPath("busy"))
+	assert.Nil(t, err)
+	defer lock.Unlock()
+
+	// == act ==
+	err = c.Execute(PruneOption{})
+
+	// == assert ==
+	assert.Nil(t, err)
+	_, err = os.Lstat(utils.FifoPath("busy"))
+	assert.Nil(t, err)
+	assert.Empty(t, factory.ran)
+}
+
+func TestContainerPrune_OrphanCgroups(t *testing.T) {
+	// == arrange ==
+	c, stdout, _ := newTestContainerPrune(t)
+	empty := filepath.Join(c.cgroupRoot, "gone")
+	busy := filepath.Join(c.cgroupRoot, "gone-busy")
+	for _, dir := range []string{empty, busy} {
+		assert.Nil(t, os.MkdirAll(dir, 0755))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(empty, "cgroup.procs"), nil, 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(busy, "cgroup.procs"), []byte("123\n"), 0644))
+
+	// == act ==
+	err := c.Execute(PruneOption{})
+
+	// == assert ==
+	assert.Nil(t, err)
+	_, err = os.Stat(empty)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(busy)
+	assert.Nil(t, err)
+	assert.Equal(t, "gone: removed "+empty+"\n", stdout.String())
+}
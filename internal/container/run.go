@@ -2,10 +2,13 @@ package container
 
 import (
 	"droplet/internal/hook"
+	"droplet/internal/logs"
+	"droplet/internal/spec"
 	"droplet/internal/status"
 	"droplet/internal/utils"
 	"fmt"
 	"os"
+	"time"
 )
 
 // NewContainerRun constructs a ContainerRun using the default
@@ -21,11 +24,13 @@ func NewContainerRun() *ContainerRun {
 		specLoader:               newFileSpecLoader(),
 		fifoCreator:              newContainerFifoHandler(),
 		commandFactory:           utils.NewCommandFactory(),
+		processExecutor:          newContainerInitExecutor(),
 		containerStart:           NewContainerStart(),
 		containerCgroupPreparer:  newContainerCgroupController(),
 		containerNetworkPreparer: newContainerNetworkController(),
 		containerStatusManager:   status.NewStatusHandler(),
 		containerHookController:  hook.NewHookController(),
+		containerTeardownHandler: newContainerTeardown(),
 	}
 }
 
@@ -35,7 +40,8 @@ func NewContainerRun() *ContainerRun {
 //
 //  1. Load the OCI spec (config.json)
 //  2. Create the FIFO used for init synchronization
-//  3. Spawn the init subprocess of this runtime (via the `init` subcommand)
+//  3. Spawn the init subprocess of this runtime (via the `init` subcommand),
+//     or without a tty the shim that runs it (via the `shim` subcommand)
 //  4. Signal the init process to start by writing to the FIFO
 //  5. Attach to and wait for the container process to exit
 //
@@ -45,11 +51,13 @@ type ContainerRun struct {
 	specLoader               specLoader
 	fifoCreator              fifoCreator
 	commandFactory           utils.CommandFactory
+	processExecutor          processExecutor
 	containerStart           *ContainerStart
 	containerCgroupPreparer  containerCgroupPreparer
 	containerNetworkPreparer containerNetworkPreparer
 	containerStatusManager   status.ContainerStatusManager
 	containerHookController  hook.ContainerHookController
+	containerTeardownHandler containerTeardownHandler
 }
 
 // Run executes the container run pipeline for the provided container ID.
@@ -57,12 +65,77 @@ type ContainerRun struct {
 // The entrypoint specified in the OCI spec's process section is executed
 // inside the init process after synchronization via FIFO.
 //
-// On success, this method blocks until the container process exits and
-// returns the exit status of the process. Any failure during startup or
-// synchronization results in an error being returned.
-func (c *ContainerRun) Run(opt RunOption) error {
-	// 1. load config.json
-	spec, err := c.specLoader.loadFile(opt.ContainerId)
+// With --tty, on success, this method blocks until the container process
+// exits and returns the exit status of the process. Without a tty the
+// container runs under the shim, which logs its output and records its
+// exit, and this method returns once it is started. Any failure during
+// startup or synchronization results in an error being returned.
+func (c *ContainerRun) Run(opt RunOption) (err error) {
+	var (
+		spec   spec.Spec
+		event  = "run"
+		stage  string
+		pid    int
+		merged []hook.MergedHook
+		bundle string
+	)
+
+	// audit log
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "fail"
+		}
+		_ = logs.RecordAuditLog(logs.AuditRecord{
+			ContainerId: opt.ContainerId,
+			Bundle:      bundle,
+			Event:       event,
+			Stage:       stage,
+			Pid:         pid,
+			Spec:        &spec,
+			MergedHooks: auditMergedHooks(merged),
+			Result:      result,
+			Error:       err,
+		})
+	}()
+
+	// validate the process options before anything is created
+	stage = "prepare_init_option"
+	initOpt, err := newInitProcessOption(opt.Tty, opt.PreserveFds, opt.NoPivot, opt.NoNewKeyring, opt.ConsoleSocket)
+	if err != nil {
+		return err
+	}
+
+	// 1. load config.json from bundle, pin its hash and merge hooks.d
+	stage = "prepare_container_dir"
+	err = os.MkdirAll(utils.LogDir(opt.ContainerId), 0o750)
+	if err != nil {
+		return err
+	}
+	// the lock is held until the container is set up; start takes it
+	// again, and the wait must not block the other lifecycle commands
+	stage = "lock"
+	lock, err := lockContainer(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	stage = "check_exists"
+	err = checkContainerNotExists(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	bundle, err = resolveBundle(opt.ContainerId, opt.Bundle)
+	if err != nil {
+		return err
+	}
+	stage = "load_spec"
+	spec, err = loadAndPinSpec(c.specLoader, opt.ContainerId, bundle)
+	if err != nil {
+		return err
+	}
+	stage = "merge_hooks_dir"
+	merged, err = mergeHooksDir(opt.ContainerId, opt.HooksDir, &spec)
 	if err != nil {
 		return err
 	}
@@ -70,55 +143,121 @@ func (c *ContainerRun) Run(opt RunOption) error {
 	// 2. create state.json
 	//      status = creating
 	//      pid = 0
-	if err := c.containerStatusManager.CreateStatusFile(
+	stage = "create_state"
+	err = c.containerStatusManager.CreateStatusFile(
 		opt.ContainerId,
 		0,
 		status.CREATING,
 		spec.Root.Path,
-		utils.ContainerDir(opt.ContainerId),
+		bundle,
 		spec.Annotations,
-	); err != nil {
+	)
+	if err != nil {
 		return err
 	}
 
 	// 3. HOOK: createRuntime
-	if err := c.containerHookController.RunCreateRuntimeHooks(
+	stage = "hook_create_runtime"
+	err = c.containerHookController.RunCreateRuntimeHooks(
 		opt.ContainerId,
 		spec.Hooks.CreateRuntime,
-	); err != nil {
-		return err
+	)
+	if err != nil {
+		return abortWithTeardown(c.containerTeardownHandler, opt.ContainerId, spec, err)
 	}
 
 	// 4. create fifo
+	stage = "create_fifo"
 	fifo := utils.FifoPath(opt.ContainerId)
-	if err := c.fifoCreator.createFifo(fifo); err != nil {
+	err = c.fifoCreator.createFifo(fifo)
+	if err != nil {
 		return err
 	}
 
 	// 5. prepare init subcommand
-	entrypoint := spec.Process.Args
-	initArgs := append([]string{"init", opt.ContainerId, fifo}, entrypoint...)
-	cmd := c.commandFactory.Command(os.Args[0], initArgs...)
-	// set stdout/stderr/stdin
+	var (
+		cmd     utils.CommandExecutor
+		initPid int
+		shimPid int
+	)
 	if opt.Tty {
-		cmd.SetStdout(os.Stdout)
-		cmd.SetStderr(os.Stderr)
-		cmd.SetStdin(os.Stdin)
-	}
-	// TODO: non-interactive mode
-	// when started in non-interactive mode, set stdout/stderr to log files
+		entrypoint := spec.Process.Args
+		initArgs := buildInitArgs("init", opt.ContainerId, fifo, entrypoint, initOpt)
+		cmd = c.commandFactory.Command(os.Args[0], initArgs...)
+		cmd.SetExtraFiles(initOpt.extraFiles())
 
-	// apply SysProcAttr
-	nsConfig := buildNamespaceConfig(spec)
-	procAttr := buildProcAttrForRootContainer(nsConfig)
-	sysProcAttr := buildSysProcAttr(procAttr)
-	cmd.SetSysProcAttr(sysProcAttr)
+		// apply SysProcAttr
+		nsConfig := buildNamespaceConfig(spec)
+		procAttr := buildProcAttrForRootContainer(nsConfig)
+		sysProcAttr := buildSysProcAttr(procAttr)
 
-	// 6. start init process
-	if err := cmd.Start(); err != nil {
-		return err
+		// set stdout/stderr/stdin
+		var console *consolePty
+		if initOpt.consoleSocket != "" {
+			// the caller owns the pty master
+			stage = "open_console"
+			console, err = openConsolePty()
+			if err != nil {
+				return err
+			}
+			console.attach(cmd, sysProcAttr)
+		} else {
+			cmd.SetStdout(os.Stdout)
+			cmd.SetStderr(os.Stderr)
+			cmd.SetStdin(os.Stdin)
+		}
+		cmd.SetSysProcAttr(sysProcAttr)
+
+		// 6. start init process
+		stage = "execute_init"
+		err = cmd.Start()
+		if err != nil {
+			if console != nil {
+				console.close()
+			}
+			return err
+		}
+		initPid = cmd.Pid()
+
+		// hand over pty master to the caller
+		if console != nil {
+			stage = "send_console"
+			err = console.sendTo(initOpt.consoleSocket)
+			if err != nil {
+				killStartedInit(cmd)
+				return err
+			}
+		}
+	} else {
+		// 6. start the shim, which holds the stdio of init on pipes and
+		//    records its exit
+		initOpt.noTty = true
+		stage = "cleanup_shim_file"
+		err = cleanupShimFile(opt.ContainerId)
+		if err != nil {
+			return err
+		}
+		stage = "execute_shim"
+		shimPid, err = c.processExecutor.executeShim(opt.ContainerId, spec, fifo, initOpt)
+		if err != nil {
+			return err
+		}
+		stage = "wait_init_pid"
+		initPid, err = waitInitPid(opt.ContainerId, 3*time.Second, 20*time.Millisecond)
+		if err != nil {
+			return err
+		}
+	}
+	pid = initPid
+
+	// write pid file (--pid-file)
+	if opt.PidFile != "" {
+		stage = "write_pid_file"
+		err = utils.WritePidFile(opt.PidFile, initPid)
+		if err != nil {
+			return err
+		}
 	}
-	initPid := cmd.Pid()
 
 	// output when init process has been created
 	// if --print-pid is setted, print message with pid
@@ -130,86 +269,75 @@ func (c *ContainerRun) Run(opt RunOption) error {
 	}
 
 	// 7. cgroup setup
-	if err := c.containerCgroupPreparer.prepare(opt.ContainerId, spec, initPid); err != nil {
+	stage = "setup_cgroup"
+	err = c.containerCgroupPreparer.prepare(opt.ContainerId, spec, initPid)
+	if err != nil {
 		return err
 	}
 
 	// 8. network setup
-	if err := c.containerNetworkPreparer.prepare(opt.ContainerId, initPid, spec.Annotations); err != nil {
+	stage = "setup_network"
+	err = c.containerNetworkPreparer.prepare(opt.ContainerId, initPid, spec.Annotations)
+	if err != nil {
 		return err
 	}
 
 	// 9. update state.json
 	//      status = created
 	//      pid    = init pid
-	//		shimPid = 0
-	if err := c.containerStatusManager.UpdateStatus(
+	//		shimPid = shim pid, 0 with --tty
+	stage = "update_state"
+	err = c.containerStatusManager.UpdateStatus(
 		opt.ContainerId,
 		status.CREATED,
 		initPid,
-		0,
-	); err != nil {
+		shimPid,
+	)
+	if err != nil {
 		return err
 	}
 
 	// 10. HOOK: createContainer
-	if err := c.containerHookController.RunCreateContainerHooks(
+	stage = "hook_create_container"
+	err = c.containerHookController.RunCreateContainerHooks(
 		opt.ContainerId,
 		spec.Hooks.CreateContainer,
-	); err != nil {
-		return err
-	}
-
-	// 11. HOOK: startContainer
-	if err := c.containerHookController.RunStartContainerHooks(
-		opt.ContainerId,
-		spec.Hooks.StartContainer,
-	); err != nil {
-		return err
+	)
+	if err != nil {
+		return abortWithTeardown(c.containerTeardownHandler, opt.ContainerId, spec, err)
 	}
 
-	// 12. start container
-	if err := c.containerStart.Execute(
+	// 11. start container
+	//       startContainer and poststart hooks are run by the start phase
+	_ = lock.Unlock()
+	stage = "start"
+	err = c.containerStart.Execute(
 		StartOption{ContainerId: opt.ContainerId},
-	); err != nil {
-		return err
-	}
-
-	// 13. update state.json
-	//       status = running
-	if err := c.containerStatusManager.UpdateStatus(
-		opt.ContainerId,
-		status.RUNNING,
-		-1, // no update
-		-1, // no update
-	); err != nil {
-		return err
-	}
-
-	// 14. HOOK: poststart
-	if err := c.containerHookController.RunPoststartHooks(
-		opt.ContainerId,
-		spec.Hooks.Poststart,
-	); err != nil {
+	)
+	if err != nil {
 		return err
 	}
 
-	// 15. wait init process
+	// 12. wait init process
+	//       without a tty the shim waits for it and records the exit
 	if opt.Tty {
-		if err := cmd.Wait(); err != nil {
-			return err
-		}
+		stage = "wait_init"
+		waitErr := cmd.Wait()
 
-		// 16. update state.json
+		// 13. record the exit in state.json
 		//        status = stopped
-		if err := c.containerStatusManager.UpdateStatus(
+		stage = "record_exit"
+		err = c.containerStatusManager.RecordExit(
 			opt.ContainerId,
-			status.STOPPED,
-			0,
-			0,
-		); err != nil {
+			newExitInfo(opt.ContainerId, waitStatusOf(waitErr)),
+		)
+		if err != nil {
 			return err
 		}
+		if waitErr != nil {
+			stage = "wait_init"
+			return waitErr
+		}
 	}
 
 	return nil
@@ -0,0 +1,63 @@
+package container
+
+// scrollback is a bounded ring buffer over the pty output stream.
+// Positions are absolute offsets into the stream (bytes since the shim
+// started), so a client can ask for output since a given offset even after
+// the ring has wrapped.
+type scrollback struct {
+	buf []byte
+	end uint64 // offset just past the last byte written
+}
+
+func newScrollback(size int) *scrollback {
+	return &scrollback{buf: make([]byte, size)}
+}
+
+// start returns the oldest offset still held in the ring.
+func (s *scrollback) start() uint64 {
+	if s.end < uint64(len(s.buf)) {
+		return 0
+	}
+	return s.end - uint64(len(s.buf))
+}
+
+func (s *scrollback) Write(p []byte) {
+	size := len(s.buf)
+	if size == 0 {
+		return
+	}
+	// only the tail of an oversized write can survive
+	if len(p) > size {
+		s.end += uint64(len(p) - size)
+		p = p[len(p)-size:]
+	}
+	for len(p) > 0 {
+		pos := int(s.end % uint64(size))
+		n := copy(s.buf[pos:], p)
+		s.end += uint64(n)
+		p = p[n:]
+	}
+}
+
+// slice returns a copy of the bytes in [from, to), clamped to what the ring
+// still holds.
+func (s *scrollback) slice(from, to uint64) []byte {
+	if from < s.start() {
+		from = s.start()
+	}
+	if to > s.end {
+		to = s.end
+	}
+	if from >= to {
+		return nil
+	}
+	size := uint64(len(s.buf))
+	out := make([]byte, 0, to-from)
+	for from < to {
+		pos := from % size
+		n := min(to-from, size-pos)
+		out = append(out, s.buf[pos:pos+n]...)
+		from += n
+	}
+	return out
+}
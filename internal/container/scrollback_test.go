@@ -0,0 +1,62 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrollback_SliceBeforeWrap(t *testing.T) {
+	// == arrange ==
+	s := newScrollback(8)
+	s.Write([]byte("abcde"))
+
+	// == act ==
+	all := s.slice(0, s.end)
+	tail := s.slice(3, s.end)
+
+	// == assert ==
+	assert.Equal(t, []byte("abcde"), all)
+	assert.Equal(t, []byte("de"), tail)
+}
+
+func TestScrollback_SliceAfterWrap(t *testing.T) {
+	// == arrange ==
+	s := newScrollback(4)
+	s.Write([]byte("abc"))
+	s.Write([]byte("defg"))
+
+	// == act ==
+	all := s.slice(0, s.end)
+	mid := s.slice(4, 6)
+
+	// == assert ==
+	assert.Equal(t, uint64(7), s.end)
+	assert.Equal(t, uint64(3), s.start())
+	assert.Equal(t, []byte("defg"), all)
+	assert.Equal(t, []byte("ef"), mid)
+}
+
+func TestScrollback_OversizedWrite(t *testing.T) {
+	// == arrange ==
+	s := newScrollback(4)
+
+	// == act ==
+	s.Write([]byte("0123456789"))
+
+	// == assert ==
+	assert.Equal(t, uint64(10), s.end)
+	assert.Equal(t, []byte("6789"), s.slice(0, s.end))
+}
+
+func TestScrollback_EmptyRange(t *testing.T) {
+	// == arrange ==
+	s := newScrollback(4)
+	s.Write([]byte("ab"))
+
+	// == act ==
+	out := s.slice(2, 1)
+
+	// == assert ==
+	assert.Nil(t, out)
+}
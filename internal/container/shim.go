@@ -3,40 +3,41 @@ package container
 import (
 	"droplet/internal/logs"
 	"droplet/internal/spec"
+	"droplet/internal/status"
 	"droplet/internal/utils"
-	"encoding/binary"
-	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"os"
-	"path/filepath"
-	"strconv"
-	"sync"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
 )
 
 func NewContainerShim() *ContainerShim {
 	return &ContainerShim{
-		specLoader:     newFileSpecLoader(),
-		commandFactory: &utils.ExecCommandFactory{},
+		specLoader:             newFileSpecLoader(),
+		commandFactory:         &utils.ExecCommandFactory{},
+		containerStatusManager: status.NewStatusHandler(),
 	}
 }
 
 type ContainerShim struct {
-	specLoader     specLoader
-	commandFactory utils.CommandFactory
+	specLoader             specLoader
+	commandFactory         utils.CommandFactory
+	containerStatusManager status.ContainerStatusManager
 }
 
-func (c *ContainerShim) Execute(containerId string, fifo string, entrypoint []string) (err error) {
+func (c *ContainerShim) Execute(opt ShimOption) (err error) {
 	var (
-		spec  spec.Spec
-		event = "shim"
-		stage string
-		pid   int
+		spec        spec.Spec
+		event       = "shim"
+		stage       string
+		pid         int
+		containerId = opt.ContainerId
 	)
 
 	// audit log
@@ -63,9 +64,9 @@ func (c *ContainerShim) Execute(containerId string, fifo string, entrypoint []st
 		return err
 	}
 
-	// 2. pty
-	stage = "open_pty"
-	ptmx, tty, err := pty.Open()
+	// 2. stdio: a pty, or pipes when the container has no terminal
+	stage = "open_stdio"
+	stdio, err := openShimStdio(opt.NoTty)
 	if err != nil {
 		return err
 	}
@@ -80,36 +81,59 @@ func (c *ContainerShim) Execute(containerId string, fifo string, entrypoint []st
 
 	// open log
 	stage = "open_log"
-	shimLog, err := os.OpenFile(utils.ShimLogPath(containerId), os.O_CREATE|os.O_WRONLY, 0640)
+	shimLog, err := os.OpenFile(utils.ShimLogPath(containerId), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
 	if err != nil {
 		return err
 	}
 	defer shimLog.Close()
 	logger := log.New(shimLog, "shim: ", log.LstdFlags|log.Lmicroseconds)
-	consoleLog, err := os.OpenFile(utils.ConsoleLogPath(containerId), os.O_CREATE|os.O_WRONLY, 0640)
+	inputPolicy, logConfig := consoleSettings(spec, opt.NoTty, logger)
+	consoleLog, err := logs.OpenConsoleLog(utils.ConsoleLogPath(containerId), logConfig)
 	if err != nil {
 		return err
 	}
 	defer consoleLog.Close()
+	// logs reads console.log in the format chosen here
+	if err := c.containerStatusManager.RecordLogFormat(containerId, string(logConfig.Format)); err != nil {
+		logger.Printf("record log format failed: %v", err)
+	}
+	stopReopen := reopenOnSighup(consoleLog, logger)
+	defer stopReopen()
 
 	// 4. prepare init subcommand
 	stage = "prepare_init_command"
-	initArgs := append([]string{"init", containerId, fifo}, entrypoint...)
+	initOpt := initProcessOption{
+		listenFds:    opt.ListenFds,
+		preserveFds:  opt.PreserveFds,
+		noPivot:      opt.NoPivot,
+		noNewKeyring: opt.NoNewKeyring,
+	}
+	initArgs := buildInitArgs("init", containerId, opt.Fifo, opt.Entrypoint, initOpt)
 	cmd := c.commandFactory.Command(os.Args[0], initArgs...)
-	// set stdio to tty
-	cmd.SetStdin(tty)
-	cmd.SetStdout(tty)
-	cmd.SetStderr(tty)
+	cmd.SetExtraFiles(initOpt.extraFiles())
+	// set stdio
+	cmd.SetStdin(stdio.child[0])
+	cmd.SetStdout(stdio.child[1])
+	cmd.SetStderr(stdio.child[2])
 	// apply SysProcAttr
 	nsConfig := buildNamespaceConfig(spec)
 	procAttr := buildProcAttrForRootContainer(nsConfig)
 	sysProcAttr := buildSysProcAttr(procAttr)
 	sysProcAttr.Setsid = true
-	sysProcAttr.Setctty = true
-	sysProcAttr.Ctty = 0
+	if stdio.ptmx != nil {
+		sysProcAttr.Setctty = true
+		sysProcAttr.Ctty = 0
+	}
 	cmd.SetSysProcAttr(sysProcAttr)
 
 	// 5. execute init subcommand
+	// as a subreaper the shim also adopts the processes init leaves
+	// behind, so that it remains the only parent to wait for
+	stage = "set_subreaper"
+	err = unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+	if err != nil {
+		return err
+	}
 	stage = "exec_init"
 	err = cmd.Start()
 	if err != nil {
@@ -128,248 +152,232 @@ func (c *ContainerShim) Execute(containerId string, fifo string, entrypoint []st
 		return err
 	}
 
-	// 6. close tty
+	// 6. close the stdio of init
 	stage = "close_tty"
-	_ = tty.Close()
+	stdio.closeChild()
 
 	// 7. accept and proxy
 	stage = "data_accept"
-	h := newHub(ptmx, consoleLog, logger)
-	h.startPump()
-	go c.acceptLoop(ln, h, logger)
+	var h *hub
+	if stdio.ptmx != nil {
+		h = newHub(stdio.ptmx, consoleLog.Stream(logs.StreamStdout), logger, inputPolicy, initPid)
+		h.startPump()
+	} else {
+		h = newPipeHub(stdio.stdin, logger, inputPolicy, initPid)
+		h.startStreamPump(stdio.stdout, frameData, consoleLog.Stream(logs.StreamStdout))
+		h.startStreamPump(stdio.stderr, frameStderr, consoleLog.Stream(logs.StreamStderr))
+	}
+	go h.acceptLoop(ln)
 
 	// 8. wait init process
-	//err = cmd.Wait()
 	stage = "wait_init"
-	waitErr := cmd.Wait()
-	logger.Printf("init exited: %v", waitErr)
+	ws, err := reapUntil(initPid)
+	if err != nil {
+		logger.Printf("wait init failed: %v", err)
+		return err
+	}
+	initStatus := waitStatusCode(ws)
+	logger.Printf("init exited: status %d", initStatus)
+
+	// 9. record the exit in state.json
+	// the container may already be deleted, which is not an error
+	stage = "record_exit"
+	exit := newExitInfo(containerId, ws)
+	if err := c.containerStatusManager.RecordExit(containerId, exit); err != nil {
+		logger.Printf("record exit failed: %v", err)
+	}
 
 	_ = ln.Close()
 	_ = os.Remove(sockPath)
 
-	return waitErr
-}
+	// push the exit status to the attached clients
+	h.exit(initStatus)
 
-func (c *ContainerShim) specSecureLoad(containerId string) (spec.Spec, error) {
-	fileHashPath := utils.ConfigFileHashPath(containerId)
-
-	// 1. load hash string
-	var specFileHash spec.SpecHash
-	if err := utils.ReadJsonFile(
-		fileHashPath,
-		&specFileHash,
-	); err != nil {
-		return spec.Spec{}, err
-	}
-
-	// 2. calculate current config.json file hash
-	currentHash, err := utils.Sha256File(utils.ConfigFilePath(containerId))
-	if err != nil {
-		return spec.Spec{}, err
-	}
-
-	// 3. assert
-	if specFileHash.Sha256 != currentHash {
-		return spec.Spec{}, fmt.Errorf("config.json hash validation failed: expect=%s, got=%s", specFileHash.Sha256, currentHash)
-	}
-
-	// 4. load config.json
-	specFile, err := c.specLoader.loadFile(containerId)
-	if err != nil {
-		return spec.Spec{}, err
+	if initStatus != 0 {
+		return &ExitStatusError{Status: initStatus}
 	}
+	return nil
+}
 
-	return specFile, nil
+// shimStdio is the stdio of init. With a terminal init runs on a pty;
+// without one it gets a pipe per stream and the shim keeps the other ends.
+type shimStdio struct {
+	ptmx                  *os.File    // pty master, nil without a terminal
+	stdin, stdout, stderr *os.File    // shim ends of the pipes
+	child                 [3]*os.File // stdin, stdout and stderr of init
 }
 
-// WriteInitPid atomically writes initPid to pidfile.
-//
-// Atomicity strategy:
-//  1. create temp file in same dir
-//  2. write content, fsync temp file
-//  3. close
-//  4. rename temp -> final (POSIX atomic in same filesystem)
-//  5. fsync dir
-func (c *ContainerShim) writeInitPid(containerId string, initPid int) error {
-	if initPid <= 0 {
-		return fmt.Errorf("invalid init pid: %d", initPid)
+func openShimStdio(noTty bool) (*shimStdio, error) {
+	if !noTty {
+		ptmx, tty, err := pty.Open()
+		if err != nil {
+			return nil, err
+		}
+		return &shimStdio{ptmx: ptmx, child: [3]*os.File{tty, tty, tty}}, nil
 	}
 
-	pidPath := utils.InitPidFilePath(containerId)
-	dir := filepath.Dir(pidPath)
-
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("mkdir container dir: %w", err)
+	s := &shimStdio{}
+	var err error
+	if s.child[0], s.stdin, err = os.Pipe(); err != nil {
+		return nil, err
 	}
-
-	// Create temp file in same directory for atomic rename.
-	tmp, err := os.CreateTemp(dir, ".init.pid.*.tmp")
-	if err != nil {
-		return fmt.Errorf("create temp pidfile: %w", err)
+	if s.stdout, s.child[1], err = os.Pipe(); err != nil {
+		s.close()
+		return nil, err
 	}
-
-	tmpName := tmp.Name()
-	// cleanup on failure
-	defer func() {
-		_ = tmp.Close()
-		_ = os.Remove(tmpName)
-	}()
-
-	content := []byte(strconv.Itoa(initPid) + "\n")
-
-	if _, err := tmp.Write(content); err != nil {
-		return fmt.Errorf("write temp pidfile: %w", err)
+	if s.stderr, s.child[2], err = os.Pipe(); err != nil {
+		s.close()
+		return nil, err
 	}
+	return s, nil
+}
 
-	// Ensure file content is flushed to disk.
-	if err := tmp.Sync(); err != nil {
-		return fmt.Errorf("sync temp pidfile: %w", err)
-	}
-	if err := tmp.Close(); err != nil {
-		return fmt.Errorf("close temp pidfile: %w", err)
+// closeChild closes the ends handed to init, once it has inherited them.
+func (s *shimStdio) closeChild() {
+	for _, f := range s.child {
+		if f != nil {
+			_ = f.Close()
+		}
 	}
+}
 
-	// Atomic replace.
-	if err := os.Rename(tmpName, pidPath); err != nil {
-		return fmt.Errorf("rename pidfile: %w", err)
+func (s *shimStdio) close() {
+	s.closeChild()
+	for _, f := range []*os.File{s.ptmx, s.stdin, s.stdout, s.stderr} {
+		if f != nil {
+			_ = f.Close()
+		}
 	}
+}
 
-	// Best-effort fsync directory for crash consistency.
-	if d, err := os.Open(dir); err == nil {
-		_ = d.Sync()
-		_ = d.Close()
+// newExitInfo describes the exit of the init process of a container from
+// its wait status.
+func newExitInfo(containerId string, ws syscall.WaitStatus) status.ExitInfo {
+	exit := status.ExitInfo{
+		ExitCode:   waitStatusCode(ws),
+		FinishedAt: time.Now(),
+		OomKilled:  cgroupOomKilled(containerId),
 	}
-
-	return nil
+	if ws.Signaled() {
+		exit.ExitSignal = unix.SignalName(ws.Signal())
+	}
+	return exit
 }
 
-func (c *ContainerShim) readFramesAndApply(r io.Reader, ptmx *os.File) error {
-	h := make([]byte, 1+4)
+// reapUntil reaps the children of the shim until pid exits and returns its
+// wait status. Orphans adopted as subreaper are reaped along the way.
+func reapUntil(pid int) (syscall.WaitStatus, error) {
 	for {
-		if _, err := io.ReadFull(r, h); err != nil {
-			return err
+		var ws syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &ws, 0, nil)
+		if err == syscall.EINTR {
+			continue
 		}
-		typ := h[0]
-		n := binary.BigEndian.Uint32(h[1:5])
-
-		// safety limit (e.g. 8MB)
-		if n > 8*1024*1024 {
-			return fmt.Errorf("frame too large: %d", n)
+		if err != nil {
+			return 0, err
 		}
-
-		payload := make([]byte, n)
-		if n > 0 {
-			if _, err := io.ReadFull(r, payload); err != nil {
-				return err
-			}
+		if wpid == pid {
+			return ws, nil
 		}
+	}
+}
 
-		switch typ {
-		case frameData:
-			if len(payload) > 0 {
-				if _, err := ptmx.Write(payload); err != nil {
-					return err
-				}
-			}
-		case frameResize:
-			if len(payload) != 4 {
-				continue
-			}
-			rows := binary.BigEndian.Uint16(payload[0:2])
-			cols := binary.BigEndian.Uint16(payload[2:4])
-			_ = pty.Setsize(ptmx, &pty.Winsize{Rows: rows, Cols: cols})
-		default:
-			// unknown frame -> ignore
-		}
+// consoleSettings resolves the attach input policy and the console log
+// configuration from the spec annotations. Invalid values are logged and
+// replaced by the defaults, so that they never take the container down.
+//
+// Without a tty the log defaults to the json format, which keeps stdout
+// and stderr apart; the raw format would mix them.
+func consoleSettings(spec spec.Spec, noTty bool, logger *log.Logger) (InputPolicy, logs.ConsoleLogConfig) {
+	inputPolicy, err := parseInputPolicy(spec.Annotations.AttachInput())
+	if err != nil {
+		logger.Printf("%v, falling back to %s", err, InputPolicyFirstWriter)
+		inputPolicy = InputPolicyFirstWriter
+	}
+	logConfig, err := logs.ParseConsoleLogConfig(
+		spec.Annotations.LogFormat(),
+		spec.Annotations.LogMaxSize(),
+		spec.Annotations.LogMaxFiles(),
+	)
+	if err != nil {
+		logConfig, _ = logs.ParseConsoleLogConfig("", "", "")
 	}
+	if noTty && (err != nil || spec.Annotations.LogFormat() == "") {
+		logConfig.Format = logs.ConsoleLogJSON
+	}
+	if err != nil {
+		logger.Printf("%v, falling back to %s", err, logConfig.Format)
+	}
+	return inputPolicy, logConfig
 }
 
-func (c *ContainerShim) acceptLoop(ln net.Listener, h *hub, logger *log.Logger) {
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			if errors.Is(err, net.ErrClosed) {
+// reopenOnSighup reopens the console log whenever the shim receives SIGHUP,
+// so that it can be rotated by an external tool. The returned func stops it.
+func reopenOnSighup(consoleLog *logs.ConsoleLog, logger *log.Logger) func() {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := consoleLog.Reopen(); err != nil {
+					logger.Printf("console log reopen failed: %v", err)
+				} else {
+					logger.Printf("console log reopened")
+				}
+			case <-done:
 				return
 			}
-			if logger != nil {
-				logger.Printf("accept error: %v", err)
-			}
-			time.Sleep(50 * time.Millisecond)
-			continue
-		}
-		if logger != nil {
-			logger.Printf("attach connected")
 		}
-
-		h.attach(conn)
-
-		// conn -> ptmx (framed)
-		go func(cc net.Conn) {
-			_ = c.readFramesAndApply(cc, h.ptmx)
-			h.detach(cc)
-			_ = cc.Close()
-			if logger != nil {
-				logger.Printf("attach disconnected")
-			}
-		}(conn)
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
 	}
 }
 
-type hub struct {
-	ptmx *os.File
-
-	mu      sync.Mutex
-	conn    net.Conn // nil if detached
-	console *os.File // console.log
-	logger  *log.Logger
-}
+func (c *ContainerShim) specSecureLoad(containerId string) (spec.Spec, error) {
+	fileHashPath := utils.ConfigFileHashPath(containerId)
 
-func newHub(ptmx *os.File, console *os.File, logger *log.Logger) *hub {
-	return &hub{ptmx: ptmx, console: console, logger: logger}
-}
+	// 1. load hash string
+	var specFileHash spec.SpecHash
+	if err := utils.ReadJsonFile(
+		fileHashPath,
+		&specFileHash,
+	); err != nil {
+		return spec.Spec{}, err
+	}
 
-func (h *hub) attach(c net.Conn) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	// 2. calculate current config.json file hash
+	configPath, err := c.specLoader.configPath(containerId)
+	if err != nil {
+		return spec.Spec{}, err
+	}
+	currentHash, err := utils.Sha256File(configPath)
+	if err != nil {
+		return spec.Spec{}, err
+	}
 
-	// single attach only: close previous
-	if h.conn != nil {
-		_ = h.conn.Close()
+	// 3. assert
+	if specFileHash.Sha256 != currentHash {
+		return spec.Spec{}, fmt.Errorf("config.json hash validation failed: expect=%s, got=%s", specFileHash.Sha256, currentHash)
+	}
+	if err := verifyMergedHooks(containerId, specFileHash); err != nil {
+		return spec.Spec{}, err
 	}
-	h.conn = c
-}
 
-func (h *hub) detach(c net.Conn) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if h.conn == c {
-		h.conn = nil
+	// 4. load config.json
+	specFile, err := c.specLoader.loadFile(containerId)
+	if err != nil {
+		return spec.Spec{}, err
 	}
-}
 
-func (h *hub) startPump() {
-	go func() {
-		buf := make([]byte, 32*1024)
-		for {
-			n, err := h.ptmx.Read(buf)
-			if n > 0 {
-				if h.console != nil {
-					_, _ = h.console.Write(buf[:n])
-				}
+	return specFile, nil
+}
 
-				h.mu.Lock()
-				c := h.conn
-				h.mu.Unlock()
-				if c != nil {
-					_, _ = c.Write(buf[:n])
-				}
-			}
-			if err != nil {
-				if h.logger != nil {
-					h.logger.Printf("ptmx read end: %v", err)
-				}
-				return
-			}
-		}
-	}()
+// writeInitPid atomically writes initPid to the init pidfile, which is
+// polled by create to learn the init PID.
+func (c *ContainerShim) writeInitPid(containerId string, initPid int) error {
+	return utils.WritePidFile(utils.InitPidFilePath(containerId), initPid)
 }
@@ -1,16 +1,25 @@
 package container
 
 import (
+	"droplet/internal/hook"
+	"droplet/internal/logs"
 	"droplet/internal/spec"
+	"droplet/internal/status"
 	"droplet/internal/utils"
+	"fmt"
+	"os"
+	"path/filepath"
 )
 
 // specLoader loads an OCI runtime specification for a container.
 //
 // Implementations are responsible for retrieving and parsing the
-// container's config.json (OCI runtime spec) based on a container ID.
+// container's config.json (OCI runtime spec) based on a container ID
+// or an explicit bundle directory.
 type specLoader interface {
 	loadFile(containerId string) (spec.Spec, error)
+	loadBundle(bundle string) (spec.Spec, error)
+	configPath(containerId string) (string, error)
 }
 
 // newFileSpecLoader returns a fileSpecLoader, which loads container
@@ -18,21 +27,219 @@ type specLoader interface {
 //
 // This is the default implementation used by the runtime.
 func newFileSpecLoader() *fileSpecLoader {
-	return &fileSpecLoader{}
+	return &fileSpecLoader{
+		containerStatusManager: status.NewStatusHandler(),
+	}
 }
 
 // fileSpecLoader loads an OCI spec from a config.json file on disk.
 //
-// The loader resolves the config file path for a given container ID
-// and delegates spec parsing to spec.LoadConfigFile.
-type fileSpecLoader struct{}
+// The loader resolves the bundle directory for a given container ID
+// from state.json and delegates spec parsing to spec.LoadConfigFile.
+type fileSpecLoader struct {
+	containerStatusManager status.ContainerStatusManager
+}
 
 // loadFile loads and parses the OCI runtime specification for the
 // specified container ID.
 //
-// The configuration is read from the container's config.json file.
-// An error is returned if the file cannot be read or parsed.
+// The configuration is read from the config.json of the bundle recorded
+// in state.json, and the hooks merged from the hooks directory at create
+// time are appended. An error is returned if the file cannot be read or parsed.
 func (f *fileSpecLoader) loadFile(containerId string) (spec.Spec, error) {
-	path := utils.ConfigFilePath(containerId)
-	return spec.LoadConfigFile(path)
+	bundle, err := f.containerStatusManager.GetBundleFromId(containerId)
+	if err != nil {
+		return spec.Spec{}, err
+	}
+	specFile, err := f.loadBundle(bundle)
+	if err != nil {
+		return spec.Spec{}, err
+	}
+
+	var merged []hook.MergedHook
+	if err := utils.ReadJsonFile(utils.MergedHooksPath(containerId), &merged); err != nil {
+		if os.IsNotExist(err) {
+			return specFile, nil
+		}
+		return spec.Spec{}, err
+	}
+	hook.ApplyMergedHooks(&specFile, merged)
+	return specFile, nil
+}
+
+// loadBundle loads and parses config.json in the given bundle directory.
+//
+// A relative root.path is resolved against the bundle directory, as
+// required by the OCI runtime specification.
+func (f *fileSpecLoader) loadBundle(bundle string) (spec.Spec, error) {
+	specFile, err := spec.LoadConfigFile(utils.BundleConfigFilePath(bundle))
+	if err != nil {
+		return spec.Spec{}, err
+	}
+	if specFile.Root.Path != "" && !filepath.IsAbs(specFile.Root.Path) {
+		specFile.Root.Path = filepath.Join(bundle, specFile.Root.Path)
+	}
+	return specFile, nil
+}
+
+// configPath returns the path of the config.json that loadFile reads for
+// the specified container ID.
+func (f *fileSpecLoader) configPath(containerId string) (string, error) {
+	bundle, err := f.containerStatusManager.GetBundleFromId(containerId)
+	if err != nil {
+		return "", err
+	}
+	return utils.BundleConfigFilePath(bundle), nil
+}
+
+// resolveBundle returns the absolute bundle directory for a container.
+//
+// If bundle is empty, the container directory under the state root is used
+// so that containers prepared by the high-level runtime keep working.
+func resolveBundle(containerId string, bundle string) (string, error) {
+	if bundle == "" {
+		return utils.ContainerDir(containerId), nil
+	}
+	return filepath.Abs(bundle)
+}
+
+// loadAndPinSpec loads config.json from the bundle and pins its hash to
+// config_hash.json under the container directory.
+//
+// The pinned hash is verified by the shim and init processes before they
+// load the spec again, which protects against config.json being modified
+// between create and init.
+func loadAndPinSpec(loader specLoader, containerId string, bundle string) (spec.Spec, error) {
+	configPath := utils.BundleConfigFilePath(bundle)
+	fileHashPath := utils.ConfigFileHashPath(containerId)
+
+	// 1. calculate current config.json file hash
+	beforeLoadedHash, err := utils.Sha256File(configPath)
+	if err != nil {
+		return spec.Spec{}, err
+	}
+
+	// 2. write to file
+	if err := utils.WriteJsonToFile(
+		fileHashPath,
+		spec.SpecHash{
+			Sha256: beforeLoadedHash,
+		},
+	); err != nil {
+		return spec.Spec{}, err
+	}
+
+	// 3. load config.json
+	specFile, err := loader.loadBundle(bundle)
+	if err != nil {
+		return spec.Spec{}, err
+	}
+
+	// 4. re-calculate config.json file hash
+	afterLoadedHash, err := utils.Sha256File(configPath)
+	if err != nil {
+		return spec.Spec{}, err
+	}
+
+	// 5. load file sha256 from file
+	var specFileHash spec.SpecHash
+	if err := utils.ReadJsonFile(
+		fileHashPath,
+		&specFileHash,
+	); err != nil {
+		return spec.Spec{}, err
+	}
+
+	// 6. assert
+	// protect hash value tampering
+	if beforeLoadedHash != specFileHash.Sha256 {
+		return spec.Spec{}, fmt.Errorf("config.json hash validation failed: expect=%s, got=%s", beforeLoadedHash, specFileHash.Sha256)
+	}
+	// protect config.json tampering
+	if specFileHash.Sha256 != afterLoadedHash {
+		return spec.Spec{}, fmt.Errorf("config.json hash validation failed: expect=%s, got=%s", specFileHash.Sha256, afterLoadedHash)
+	}
+
+	return specFile, nil
+}
+
+// mergeHooksDir evaluates the hooks directory against the spec, appends
+// the matching hooks to it and persists them to hooks.json so that later
+// lifecycle commands (start, kill, delete) run the same hooks.
+//
+// hooks.json is replaced atomically and its hash is pinned next to the
+// config.json one, so that the shim and init verify it as well. It must be
+// called after loadAndPinSpec.
+func mergeHooksDir(containerId string, hooksDir string, s *spec.Spec) ([]hook.MergedHook, error) {
+	hooksPath := utils.MergedHooksPath(containerId)
+	_ = os.Remove(hooksPath)
+	if hooksDir == "" {
+		return nil, nil
+	}
+
+	merged, err := hook.MergeHooksDir(hooksDir, *s)
+	if err != nil {
+		return nil, err
+	}
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	if err := utils.WriteJsonFileAtomic(hooksPath, merged); err != nil {
+		return nil, err
+	}
+	if err := pinMergedHooks(containerId); err != nil {
+		return nil, err
+	}
+	hook.ApplyMergedHooks(s, merged)
+	return merged, nil
+}
+
+// pinMergedHooks adds the hash of hooks.json to config_hash.json.
+func pinMergedHooks(containerId string) error {
+	fileHashPath := utils.ConfigFileHashPath(containerId)
+	hooksHash, err := utils.Sha256File(utils.MergedHooksPath(containerId))
+	if err != nil {
+		return err
+	}
+	var specFileHash spec.SpecHash
+	if err := utils.ReadJsonFile(fileHashPath, &specFileHash); err != nil {
+		return err
+	}
+	specFileHash.HooksSha256 = hooksHash
+	return utils.WriteJsonFileAtomic(fileHashPath, specFileHash)
+}
+
+// verifyMergedHooks checks hooks.json against the hash pinned at create.
+// A container whose hooks were not merged must not have a hooks.json.
+func verifyMergedHooks(containerId string, specFileHash spec.SpecHash) error {
+	hooksPath := utils.MergedHooksPath(containerId)
+	if specFileHash.HooksSha256 == "" {
+		if _, err := os.Lstat(hooksPath); err == nil {
+			return fmt.Errorf("hooks.json hash validation failed: no hooks were merged at create")
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	currentHash, err := utils.Sha256File(hooksPath)
+	if err != nil {
+		return err
+	}
+	if specFileHash.HooksSha256 != currentHash {
+		return fmt.Errorf("hooks.json hash validation failed: expect=%s, got=%s", specFileHash.HooksSha256, currentHash)
+	}
+	return nil
+}
+
+// auditMergedHooks converts merged hooks to their audit log representation.
+func auditMergedHooks(merged []hook.MergedHook) []logs.MergedHook {
+	var list []logs.MergedHook
+	for _, m := range merged {
+		list = append(list, logs.MergedHook{
+			Source: m.Source,
+			Stage:  m.Stage,
+			Path:   m.Hook.Path,
+		})
+	}
+	return list
 }
@@ -0,0 +1,163 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSpecLoader_LoadBundleResolvesRelativeRoot(t *testing.T) {
+	tests := []struct {
+		name     string
+		rootPath string
+		want     func(bundle string) string
+	}{
+		{
+			name:     "relative",
+			rootPath: "rootfs",
+			want:     func(bundle string) string { return filepath.Join(bundle, "rootfs") },
+		},
+		{
+			name:     "absolute",
+			rootPath: "/var/lib/rootfs",
+			want:     func(bundle string) string { return "/var/lib/rootfs" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// == arrange ==
+			bundle := t.TempDir()
+			config := `{"ociVersion":"1.0.2","root":{"path":"` + tt.rootPath + `"}}`
+			assert.Nil(t, os.WriteFile(filepath.Join(bundle, "config.json"), []byte(config), 0644))
+
+			// == act ==
+			got, err := newFileSpecLoader().loadBundle(bundle)
+
+			// == assert ==
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want(bundle), got.Root.Path)
+		})
+	}
+}
+
+func TestFileSpecLoader_LoadFileUsesRecordedBundle(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	bundle := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(bundle, "config.json"), []byte(`{"root":{"path":"rootfs"}}`), 0644))
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("c1"), 0755))
+	assert.Nil(t, status.NewStatusHandler().CreateStatusFile("c1", 0, status.CREATING, "/rootfs", bundle, nil))
+	loader := newFileSpecLoader()
+
+	// == act ==
+	got, err := loader.loadFile("c1")
+	configPath, configErr := loader.configPath("c1")
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(bundle, "rootfs"), got.Root.Path)
+	assert.Nil(t, configErr)
+	assert.Equal(t, filepath.Join(bundle, "config.json"), configPath)
+}
+
+func TestFileSpecLoader_LoadFileWithoutState(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+
+	// == act ==
+	_, err := newFileSpecLoader().loadFile("c1")
+
+	// == assert ==
+	// without state.json there is no bundle to fall back on
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestResolveBundle(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", "/run/raind")
+	cwd, err := os.Getwd()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name   string
+		bundle string
+		want   string
+	}{
+		{name: "default", bundle: "", want: "/run/raind/c1"},
+		{name: "absolute", bundle: "/srv/bundle", want: "/srv/bundle"},
+		{name: "relative", bundle: "bundles/c1", want: filepath.Join(cwd, "bundles/c1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// == act ==
+			got, err := resolveBundle("c1", tt.bundle)
+
+			// == assert ==
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// pinTestSpec creates the directory of container c1 and pins the
+// config.json of a new bundle, as create does.
+func pinTestSpec(t *testing.T) spec.Spec {
+	t.Helper()
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("c1"), 0755))
+	bundle := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(bundle, "config.json"), []byte(`{"root":{"path":"rootfs"}}`), 0644))
+	s, err := loadAndPinSpec(newFileSpecLoader(), "c1", bundle)
+	assert.Nil(t, err)
+	return s
+}
+
+func readPinnedHash(t *testing.T) spec.SpecHash {
+	t.Helper()
+	var specFileHash spec.SpecHash
+	assert.Nil(t, utils.ReadJsonFile(utils.ConfigFileHashPath("c1"), &specFileHash))
+	return specFileHash
+}
+
+func TestMergeHooksDir_PinsHooks(t *testing.T) {
+	// == arrange ==
+	s := pinTestSpec(t)
+	hooksDir := t.TempDir()
+	hookConfig := `{"version":"1.0.0","hook":{"path":"/bin/net"},"when":{"always":true},"stages":["poststop"]}`
+	assert.Nil(t, os.WriteFile(filepath.Join(hooksDir, "10-net.json"), []byte(hookConfig), 0644))
+
+	// == act ==
+	merged, err := mergeHooksDir("c1", hooksDir, &s)
+	verifyErr := verifyMergedHooks("c1", readPinnedHash(t))
+	assert.Nil(t, os.WriteFile(utils.MergedHooksPath("c1"), []byte(`[]`), 0644))
+	tamperedErr := verifyMergedHooks("c1", readPinnedHash(t))
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(merged))
+	assert.Equal(t, "/bin/net", s.Hooks.Poststop[0].Path)
+	assert.NotEmpty(t, readPinnedHash(t).Sha256)
+	assert.Nil(t, verifyErr)
+	assert.ErrorContains(t, tamperedErr, "hooks.json hash validation failed")
+}
+
+func TestVerifyMergedHooks_UnmergedHooks(t *testing.T) {
+	// == arrange ==
+	s := pinTestSpec(t)
+	_, err := mergeHooksDir("c1", "", &s)
+	assert.Nil(t, err)
+
+	// == act ==
+	verifyErr := verifyMergedHooks("c1", readPinnedHash(t))
+	assert.Nil(t, os.WriteFile(utils.MergedHooksPath("c1"), []byte(`[]`), 0644))
+	injectedErr := verifyMergedHooks("c1", readPinnedHash(t))
+
+	// == assert ==
+	assert.Nil(t, verifyErr)
+	assert.ErrorContains(t, injectedErr, "no hooks were merged at create")
+}
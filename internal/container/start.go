@@ -14,10 +14,11 @@ import (
 // executing the container start phase.
 func NewContainerStart() *ContainerStart {
 	return &ContainerStart{
-		specLoader:              newFileSpecLoader(),
-		fifoHandler:             newContainerFifoHandler(),
-		containerStatusManager:  status.NewStatusHandler(),
-		containerHookController: hook.NewHookController(),
+		specLoader:               newFileSpecLoader(),
+		fifoHandler:              newContainerFifoHandler(),
+		containerStatusManager:   status.NewStatusHandler(),
+		containerHookController:  hook.NewHookController(),
+		containerTeardownHandler: newContainerTeardown(),
 	}
 }
 
@@ -33,8 +34,9 @@ type ContainerStart struct {
 		writeFifo(path string) error
 		removeFifo(path string) error
 	}
-	containerStatusManager  status.ContainerStatusManager
-	containerHookController hook.ContainerHookController
+	containerStatusManager   status.ContainerStatusManager
+	containerHookController  hook.ContainerHookController
+	containerTeardownHandler containerTeardownHandler
 }
 
 // Execute performs the container start sequence for the given container.
@@ -68,6 +70,14 @@ func (c *ContainerStart) Execute(opt StartOption) (err error) {
 		})
 	}()
 
+	// serialize with the other lifecycle commands
+	stage = "lock"
+	lock, err := lockContainer(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	// 1. check container status
 	//    if status is running, return error
 	stage = "check_status"
@@ -93,7 +103,7 @@ func (c *ContainerStart) Execute(opt StartOption) (err error) {
 		spec.Hooks.StartContainer,
 	)
 	if err != nil {
-		return err
+		return abortWithTeardown(c.containerTeardownHandler, opt.ContainerId, spec, err)
 	}
 
 	// 4. write fifo
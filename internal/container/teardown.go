@@ -0,0 +1,108 @@
+package container
+
+import (
+	"droplet/internal/hook"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// containerTeardownHandler removes a container whose create or start
+// phase has been aborted by a lifecycle hook.
+//
+// It is an interface so that the behavior can be mocked in tests.
+type containerTeardownHandler interface {
+	teardown(containerId string, spec spec.Spec) error
+}
+
+// newContainerTeardown constructs a containerTeardown with the default
+// implementations of its dependencies.
+func newContainerTeardown() *containerTeardown {
+	return &containerTeardown{
+		syscallHandler:          utils.NewSyscallHandler(),
+		containerStatusManager:  status.NewStatusHandler(),
+		containerHookController: hook.NewHookController(),
+	}
+}
+
+// containerTeardown is the default implementation of containerTeardownHandler.
+type containerTeardown struct {
+	syscallHandler          utils.KernelSyscallHandler
+	containerStatusManager  status.ContainerStatusManager
+	containerHookController hook.ContainerHookController
+}
+
+// teardown stops the container and removes its runtime files.
+//
+// The OCI runtime spec requires that a failing createRuntime,
+// createContainer or startContainer hook stops the container and
+// continues the lifecycle at delete. The workflow is:
+//
+//  1. Kill the init process (if it has been started) and wait for it and
+//     the shim to exit; a shim that does not exit on its own is killed
+//  2. Run poststop hooks (failures are reported, not returned)
+//  3. Remove the shim socket, init pid file and FIFO
+//  4. Discard the volatile rootfs (overlay-volatile only)
+//  5. Remove the container state file (state.json)
+func (t *containerTeardown) teardown(containerId string, spec spec.Spec) error {
+	// 1. kill init process and wait for the init and shim processes, so
+	//    that nothing runs, or records its exit, while the container is
+	//    torn down
+	procIdentity, err := t.containerStatusManager.GetProcIdentityFromId(containerId)
+	if err != nil {
+		return err
+	}
+	shimIdentity, err := t.containerStatusManager.GetShimIdentityFromId(containerId)
+	if err != nil {
+		return err
+	}
+	if procIdentity.Pid > 0 {
+		if err := procIdentity.Signal(signalMap["KILL"]); err != nil && err != syscall.ESRCH {
+			return err
+		}
+		if err := waitProcessExit(procIdentity, 5*time.Second); err != nil {
+			return fmt.Errorf("failed to stop container pid=%d: %w", procIdentity.Pid, err)
+		}
+	}
+	// the shim records the exit of init and exits
+	if shimIdentity.Pid > 0 && waitProcessExit(shimIdentity, 5*time.Second) != nil {
+		if err := shimIdentity.Signal(signalMap["KILL"]); err != nil && err != syscall.ESRCH {
+			return err
+		}
+		if err := waitProcessExit(shimIdentity, 5*time.Second); err != nil {
+			return fmt.Errorf("failed to stop shim pid=%d: %w", shimIdentity.Pid, err)
+		}
+	}
+
+	// 2. HOOK: poststop
+	if err := t.containerHookController.RunPoststopHooks(containerId, spec.Hooks.Poststop); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+
+	// 3. remove runtime files
+	_ = t.syscallHandler.Remove(utils.SockPath(containerId))
+	_ = t.syscallHandler.Remove(utils.InitPidFilePath(containerId))
+	_ = t.syscallHandler.Remove(utils.FifoPath(containerId))
+
+	// 4. discard volatile rootfs
+	if err := removeVolatileRootfs(t.syscallHandler, containerId); err != nil {
+		return err
+	}
+
+	// 5. remove state.json
+	return t.containerStatusManager.RemoveStatusFile(containerId)
+}
+
+// abortWithTeardown tears down the container after a lifecycle hook
+// failure and returns the hook error. A teardown failure is appended
+// to the error message, as the hook error is the root cause.
+func abortWithTeardown(handler containerTeardownHandler, containerId string, spec spec.Spec, cause error) error {
+	if err := handler.teardown(containerId, spec); err != nil {
+		return fmt.Errorf("%w (teardown failed: %v)", cause, err)
+	}
+	return cause
+}
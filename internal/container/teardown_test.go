@@ -0,0 +1,271 @@
+package container
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHookController fails the phases listed in errs and records the
+// phases it ran. onRun, if set, is called with each phase.
+type fakeHookController struct {
+	errs  map[string]error
+	ran   []string
+	onRun func(phase string)
+}
+
+func (f *fakeHookController) run(phase string) error {
+	f.ran = append(f.ran, phase)
+	if f.onRun != nil {
+		f.onRun(phase)
+	}
+	return f.errs[phase]
+}
+
+func (f *fakeHookController) RunCreateRuntimeHooks(containerId string, hookList []spec.HookObject) error {
+	return f.run("createRuntime")
+}
+func (f *fakeHookController) RunCreateContainerHooks(containerId string, hookList []spec.HookObject) error {
+	return f.run("createContainer")
+}
+func (f *fakeHookController) RunStartContainerHooks(containerId string, hookList []spec.HookObject) error {
+	return f.run("startContainer")
+}
+func (f *fakeHookController) RunPoststartHooks(containerId string, hookList []spec.HookObject) error {
+	return f.run("poststart")
+}
+func (f *fakeHookController) RunStopContainerHooks(containerId string, hookList []spec.HookObject) error {
+	return f.run("stopContainer")
+}
+func (f *fakeHookController) RunPoststopHooks(containerId string, hookList []spec.HookObject) error {
+	return f.run("poststop")
+}
+
+type fakeTeardownHandler struct {
+	torndown []string
+}
+
+func (f *fakeTeardownHandler) teardown(containerId string, spec spec.Spec) error {
+	f.torndown = append(f.torndown, containerId)
+	return nil
+}
+
+type fakeTeardownSpecLoader struct {
+	spec spec.Spec
+}
+
+func (f *fakeTeardownSpecLoader) loadFile(containerId string) (spec.Spec, error) {
+	return f.spec, nil
+}
+func (f *fakeTeardownSpecLoader) loadBundle(bundle string) (spec.Spec, error) {
+	return spec.Spec{}, nil
+}
+func (f *fakeTeardownSpecLoader) configPath(containerId string) (string, error) {
+	return "/bundle/config.json", nil
+}
+
+// fakeFifo stands in for the FIFO of create, start and delete.
+type fakeFifo struct{}
+
+func (f *fakeFifo) createFifo(path string) error { return nil }
+func (f *fakeFifo) writeFifo(path string) error  { return nil }
+func (f *fakeFifo) removeFifo(path string) error { return nil }
+
+// fakeInitExecutor reports this test process as init.
+type fakeInitExecutor struct {
+	started bool
+}
+
+func (f *fakeInitExecutor) executeInit(containerId string, spec spec.Spec, fifo string, opt initProcessOption) (int, error) {
+	f.started = true
+	return os.Getpid(), nil
+}
+func (f *fakeInitExecutor) executeShim(containerId string, spec spec.Spec, fifo string, opt initProcessOption) (int, error) {
+	return -1, errors.New("not supported")
+}
+
+type fakeCgroupPreparer struct{}
+
+func (f *fakeCgroupPreparer) prepare(containerId string, spec spec.Spec, pid int) error { return nil }
+
+type fakeNetworkPreparer struct{}
+
+func (f *fakeNetworkPreparer) prepare(containerId string, pid int, annotation spec.AnnotationObject) error {
+	return nil
+}
+
+func TestContainerCreate_HookFailureTearsDown(t *testing.T) {
+	for _, phase := range []string{"createRuntime", "createContainer"} {
+		t.Run(phase, func(t *testing.T) {
+			// == arrange ==
+			t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+			bundle := t.TempDir()
+			assert.Nil(t, os.WriteFile(filepath.Join(bundle, "config.json"), []byte("{}"), 0644))
+			hookErr := errors.New(phase + " hook failed")
+			hooks := &fakeHookController{errs: map[string]error{phase: hookErr}}
+			teardown := &fakeTeardownHandler{}
+			executor := &fakeInitExecutor{}
+			c := &ContainerCreator{
+				specLoader:               &fakeTeardownSpecLoader{},
+				fifoCreator:              &fakeFifo{},
+				processExecutor:          executor,
+				containerNetworkPreparer: &fakeNetworkPreparer{},
+				containerCgroupPreparer:  &fakeCgroupPreparer{},
+				containerStatusManager:   status.NewStatusHandler(),
+				containerHookController:  hooks,
+				containerTeardownHandler: teardown,
+			}
+
+			// == act ==
+			err := c.Create(CreateOption{
+				ContainerId:   "c1",
+				Bundle:        bundle,
+				TtyFlag:       true,
+				ConsoleSocket: filepath.Join(t.TempDir(), "console.sock"),
+			})
+
+			// == assert ==
+			assert.ErrorIs(t, err, hookErr)
+			assert.Equal(t, []string{"c1"}, teardown.torndown)
+			assert.Equal(t, phase, hooks.ran[len(hooks.ran)-1])
+			// init is only started after createRuntime
+			assert.Equal(t, phase == "createContainer", executor.started)
+		})
+	}
+}
+
+func TestContainerStart_HookFailureTearsDown(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("c1"), 0755))
+	h := status.NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile("c1", 0, status.CREATING, "/rootfs", "/bundle", nil))
+	assert.Nil(t, h.UpdateStatus("c1", status.CREATED, os.Getpid(), 0))
+	hookErr := errors.New("startContainer hook failed")
+	hooks := &fakeHookController{errs: map[string]error{"startContainer": hookErr}}
+	teardown := &fakeTeardownHandler{}
+	c := &ContainerStart{
+		specLoader:               &fakeTeardownSpecLoader{},
+		fifoHandler:              &fakeFifo{},
+		containerStatusManager:   h,
+		containerHookController:  hooks,
+		containerTeardownHandler: teardown,
+	}
+
+	// == act ==
+	err := c.Execute(StartOption{ContainerId: "c1"})
+
+	// == assert ==
+	assert.ErrorIs(t, err, hookErr)
+	assert.Equal(t, []string{"c1"}, teardown.torndown)
+	assert.Equal(t, []string{"startContainer"}, hooks.ran)
+	containerStatus, err := h.GetStatusFromId("c1")
+	assert.Nil(t, err)
+	assert.Equal(t, status.CREATED, containerStatus)
+}
+
+func TestContainerDelete_PoststopFailureRemovesState(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("c1"), 0755))
+	h := status.NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile("c1", 0, status.CREATING, "/rootfs", "/bundle", nil))
+	assert.Nil(t, h.UpdateStatus("c1", status.STOPPED, 0, 0))
+	hookErr := errors.New("poststop hook failed")
+	hooks := &fakeHookController{errs: map[string]error{"poststop": hookErr}}
+	c := &ContainerDelete{
+		specLoader:              &fakeTeardownSpecLoader{},
+		fifoHandler:             &fakeFifo{},
+		containerStatusManager:  h,
+		containerHookController: hooks,
+		syscallHandler:          &fakeRmdirSyscall{},
+	}
+
+	// == act ==
+	err := c.Delete(DeleteOption{ContainerId: "c1"})
+
+	// == assert ==
+	assert.ErrorIs(t, err, hookErr)
+	assert.Equal(t, []string{"poststop"}, hooks.ran)
+	_, err = os.Lstat(utils.ContainerStatePath("c1"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestContainerTeardown_WaitsForInitAndShim(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("c1"), 0755))
+	// init stays a zombie after the SIGKILL until it is reaped, and the
+	// shim exits on its own a little later
+	initCmd := exec.Command("sleep", "30")
+	assert.Nil(t, initCmd.Start())
+	shimCmd := exec.Command("sleep", "1")
+	assert.Nil(t, shimCmd.Start())
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = initCmd.Wait()
+	}()
+	go func() { _ = shimCmd.Wait() }()
+	h := status.NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile("c1", 0, status.CREATING, "/rootfs", "/bundle", nil))
+	assert.Nil(t, h.UpdateStatus("c1", status.CREATED, initCmd.Process.Pid, shimCmd.Process.Pid))
+	initIdentity, err := h.GetProcIdentityFromId("c1")
+	assert.Nil(t, err)
+	shimIdentity, err := h.GetShimIdentityFromId("c1")
+	assert.Nil(t, err)
+	var aliveAtPoststop []bool
+	hooks := &fakeHookController{onRun: func(phase string) {
+		aliveAtPoststop = []bool{initIdentity.Alive(), shimIdentity.Alive()}
+	}}
+	teardown := &containerTeardown{
+		syscallHandler:          utils.NewSyscallHandler(),
+		containerStatusManager:  h,
+		containerHookController: hooks,
+	}
+
+	// == act ==
+	err = teardown.teardown("c1", spec.Spec{})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"poststop"}, hooks.ran)
+	assert.Equal(t, []bool{false, false}, aliveAtPoststop)
+	_, err = os.Lstat(utils.ContainerStatePath("c1"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestContainerDelete_InvalidImageConfigRemovesVolatileRootfs(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	assert.Nil(t, os.MkdirAll(filepath.Join(utils.VolatileDir("c1"), "upper"), 0755))
+	h := status.NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile("c1", 0, status.CREATING, "/rootfs", "/bundle", nil))
+	assert.Nil(t, h.UpdateStatus("c1", status.STOPPED, 0, 0))
+	c := &ContainerDelete{
+		specLoader: &fakeTeardownSpecLoader{spec: spec.Spec{
+			Annotations: spec.AnnotationObject{spec.AnnotationKeyImage: `{"rootfsType":"unknown"}`},
+		}},
+		fifoHandler:             &fakeFifo{},
+		containerStatusManager:  h,
+		containerHookController: &fakeHookController{},
+		syscallHandler:          &fakeRmdirSyscall{},
+	}
+
+	// == act ==
+	err := c.Delete(DeleteOption{ContainerId: "c1"})
+
+	// == assert ==
+	assert.Nil(t, err)
+	_, err = os.Lstat(utils.VolatileDir("c1"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Lstat(utils.ContainerStatePath("c1"))
+	assert.True(t, os.IsNotExist(err))
+}
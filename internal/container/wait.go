@@ -0,0 +1,333 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"droplet/internal/status"
+	"droplet/internal/utils"
+
+	"golang.org/x/sys/unix"
+)
+
+// WaitCondition is the state of a container that wait blocks for.
+type WaitCondition string
+
+const (
+	// WaitConditionStopped waits for the container process to exit.
+	WaitConditionStopped WaitCondition = "stopped"
+	// WaitConditionRunning waits for the container to be started.
+	WaitConditionRunning WaitCondition = "running"
+	// WaitConditionRemoved waits for the container to be deleted.
+	WaitConditionRemoved WaitCondition = "removed"
+)
+
+// ParseWaitCondition parses the --condition of wait. An empty value
+// selects WaitConditionStopped.
+func ParseWaitCondition(value string) (WaitCondition, error) {
+	switch c := WaitCondition(value); c {
+	case "":
+		return WaitConditionStopped, nil
+	case WaitConditionStopped, WaitConditionRunning, WaitConditionRemoved:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unknown wait condition: %q", value)
+	}
+}
+
+// NewContainerWait constructs a ContainerWait that prints to the standard
+// output.
+func NewContainerWait() *ContainerWait {
+	return &ContainerWait{
+		containerStatusManager: status.NewStatusHandler(),
+		stdout:                 os.Stdout,
+		pollInterval:           250 * time.Millisecond,
+	}
+}
+
+// ContainerWait blocks until a container reaches a condition.
+//
+// state.json is watched with inotify. While waiting for the container to
+// stop, the init and shim processes are watched as well, with pidfds when
+// the kernel supports them and by polling otherwise, so that a container
+// whose exit is never recorded does not block the wait forever.
+//
+// The exit is recorded by the shim. Containers created with
+// --console-socket run without one, and `run --tty` records the exit
+// itself, so a wait on such a container ends with an error that names the
+// missing shim instead of an exit code once the container process is gone.
+type ContainerWait struct {
+	containerStatusManager status.ContainerStatusManager
+	stdout                 io.Writer
+	pollInterval           time.Duration // liveness polling without pidfds
+}
+
+// Execute waits for opt.Condition. For WaitConditionStopped, and for
+// WaitConditionRemoved once an exit was recorded, the exit code of the
+// container process is printed and a non-zero one is returned as an
+// ExitStatusError.
+//
+// The workflow is:
+//  1. Watch the container directory
+//  2. Read state.json and return once the condition holds
+//  3. Otherwise block until state.json changes, a watched process exits
+//     or the timeout elapses, and go back to 2
+func (c *ContainerWait) Execute(opt WaitOption) error {
+	var deadline time.Time
+	if opt.Timeout > 0 {
+		deadline = time.Now().Add(opt.Timeout)
+	}
+
+	// 1. watch
+	watcher, err := newStateWatcher(opt.ContainerId)
+	if err != nil {
+		return err
+	}
+	defer watcher.close()
+
+	var (
+		exitCode *int
+		shimless bool // the container process was seen running without a shim
+	)
+	for {
+		// 2. check the condition
+		st, err := readWaitState(opt.ContainerId)
+		switch {
+		case os.IsNotExist(err):
+			if opt.Condition == WaitConditionRemoved {
+				return c.printExit(exitCode)
+			}
+			return fmt.Errorf("container %s does not exist", opt.ContainerId)
+		case errors.As(err, new(*json.SyntaxError)):
+			// state.json is being rewritten; the write is reported by
+			// the watcher
+		case err != nil:
+			return err
+		default:
+			if st.ExitCode != nil {
+				exitCode = st.ExitCode
+			}
+			if st.Pid > 0 && st.ShimPid <= 0 {
+				shimless = true
+			}
+			done, err := c.satisfied(opt, st)
+			if err != nil || done {
+				return err
+			}
+		}
+
+		// 3. block
+		timeout := -1
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return fmt.Errorf("timed out waiting for container %s to be %s", opt.ContainerId, opt.Condition)
+			}
+			timeout = int(remaining.Milliseconds()) + 1
+		}
+		if err == nil && opt.Condition == WaitConditionStopped {
+			// not stopped yet, or stopped while the exit may still be
+			// recorded
+			watcher.watchProcess(st.InitIdentity())
+			watcher.watchProcess(st.ShimIdentity())
+			if watcher.exited(st.Pid) && watcher.exited(st.ShimPid) {
+				// nobody is left to record the exit
+				return c.stoppedWithoutExit(opt.ContainerId, shimless)
+			}
+			if watcher.polling() && (timeout < 0 || timeout > int(c.pollInterval.Milliseconds())) {
+				timeout = int(c.pollInterval.Milliseconds())
+			}
+		}
+		if err := watcher.wait(timeout); err != nil {
+			return err
+		}
+	}
+}
+
+// satisfied reports whether st meets the condition of opt, or an error if
+// it never can.
+func (c *ContainerWait) satisfied(opt WaitOption, st status.StatusObject) (bool, error) {
+	switch opt.Condition {
+	case WaitConditionRunning:
+		if st.Status == status.RUNNING.String() || !st.StartedAt.IsZero() {
+			return true, nil
+		}
+		if st.Status == status.STOPPED.String() {
+			return false, fmt.Errorf("container %s stopped without running", opt.ContainerId)
+		}
+		return false, nil
+	case WaitConditionRemoved:
+		return false, nil
+	default:
+		// a container stopped without an exit is reported once its init
+		// and shim are gone, as the shim may still record the exit
+		if st.Status != status.STOPPED.String() || st.ExitCode == nil {
+			return false, nil
+		}
+		return true, c.printExit(st.ExitCode)
+	}
+}
+
+// stoppedWithoutExit handles a container whose init and shim are gone but
+// whose state was not updated. The exit may have been recorded just before
+// the shim exited, or by `run --tty`; otherwise the state is recomputed.
+// shimless reports that the container ran without a shim.
+func (c *ContainerWait) stoppedWithoutExit(containerId string, shimless bool) error {
+	st, err := readWaitState(containerId)
+	if err == nil && st.ExitCode != nil {
+		return c.printExit(st.ExitCode)
+	}
+	_, _ = c.containerStatusManager.GetStatusFromId(containerId)
+	if shimless {
+		return fmt.Errorf("container %s stopped without an exit status: it has no shim to record the exit (create --console-socket or run --tty)", containerId)
+	}
+	return fmt.Errorf("container %s stopped without an exit status", containerId)
+}
+
+func (c *ContainerWait) printExit(exitCode *int) error {
+	if exitCode == nil {
+		return nil
+	}
+	if _, err := fmt.Fprintln(c.stdout, *exitCode); err != nil {
+		return err
+	}
+	if *exitCode != 0 {
+		return &ExitStatusError{Status: *exitCode}
+	}
+	return nil
+}
+
+// readWaitState reads state.json as it is, without recomputing the status,
+// so that a container is only seen as stopped once its exit is recorded.
+func readWaitState(containerId string) (status.StatusObject, error) {
+	var st status.StatusObject
+	err := utils.ReadJsonFile(utils.ContainerStatePath(containerId), &st)
+	return st, err
+}
+
+// stateWatcher waits for changes to the container directory and for the
+// exit of processes.
+type stateWatcher struct {
+	inotifyFd int
+	procs     map[int]*watchedProc
+}
+
+type watchedProc struct {
+	identity utils.ProcIdentity
+	pidfd    int  // -1 when pidfd_open is unavailable
+	gone     bool // exited; no longer polled
+}
+
+func newStateWatcher(containerId string) (*stateWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+	mask := uint32(unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_DELETE_SELF)
+	if _, err := unix.InotifyAddWatch(fd, utils.ContainerDir(containerId), mask); err != nil && !errors.Is(err, unix.ENOENT) {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("inotify watch: %w", err)
+	}
+	return &stateWatcher{inotifyFd: fd, procs: map[int]*watchedProc{}}, nil
+}
+
+func (w *stateWatcher) close() {
+	_ = unix.Close(w.inotifyFd)
+	for _, p := range w.procs {
+		if p.pidfd >= 0 {
+			_ = unix.Close(p.pidfd)
+		}
+	}
+}
+
+// watchProcess starts watching the process of identity. Pids that are not
+// positive are ignored, and a pid that now belongs to another process is
+// watched as gone.
+func (w *stateWatcher) watchProcess(identity utils.ProcIdentity) {
+	pid := identity.Pid
+	if pid <= 0 {
+		return
+	}
+	if _, ok := w.procs[pid]; ok {
+		return
+	}
+	fd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		fd = -1
+	}
+	p := &watchedProc{identity: identity, pidfd: fd}
+	// verified after the pidfd is opened, so the pidfd refers to the
+	// process that was checked
+	if !identity.Alive() {
+		p.gone = true
+	}
+	w.procs[pid] = p
+}
+
+// polling reports whether a running process is watched without a pidfd
+// and must be polled for.
+func (w *stateWatcher) polling() bool {
+	for _, p := range w.procs {
+		if !p.gone && p.pidfd < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// exited reports whether pid is gone. A pid that is not positive counts as
+// gone.
+func (w *stateWatcher) exited(pid int) bool {
+	if pid <= 0 {
+		return true
+	}
+	p, ok := w.procs[pid]
+	if !ok {
+		return errors.Is(unix.Kill(pid, 0), unix.ESRCH)
+	}
+	if p.gone {
+		return true
+	}
+	if p.pidfd < 0 {
+		p.gone = !p.identity.Alive()
+	} else {
+		// a pidfd becomes readable once the process exits
+		fds := []unix.PollFd{{Fd: int32(p.pidfd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, 0)
+		p.gone = err == nil && n > 0
+	}
+	return p.gone
+}
+
+// wait blocks until the directory changes, a watched process exits or
+// timeout milliseconds elapse (-1 for no timeout), and drains the pending
+// inotify events.
+func (w *stateWatcher) wait(timeout int) error {
+	fds := []unix.PollFd{{Fd: int32(w.inotifyFd), Events: unix.POLLIN}}
+	for _, p := range w.procs {
+		if !p.gone && p.pidfd >= 0 {
+			fds = append(fds, unix.PollFd{Fd: int32(p.pidfd), Events: unix.POLLIN})
+		}
+	}
+	for {
+		_, err := unix.Poll(fds, timeout)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		if _, err := unix.Read(w.inotifyFd, buf); err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package container
+
+import (
+	"bytes"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestContainerWait creates state.json for container c1 in the given
+// status, with a sleeping process as init.
+func newTestContainerWait(t *testing.T, st status.ContainerStatus) (*ContainerWait, *status.StatusHandler, *exec.Cmd, *bytes.Buffer) {
+	t.Helper()
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("c1"), 0755))
+	cmd := exec.Command("sleep", "30")
+	assert.Nil(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	h := status.NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile("c1", 0, status.CREATING, "/rootfs", "/bundle", spec.AnnotationObject{}))
+	assert.Nil(t, h.UpdateStatus("c1", st, cmd.Process.Pid, 0))
+	var stdout bytes.Buffer
+	return &ContainerWait{
+		containerStatusManager: h,
+		stdout:                 &stdout,
+		pollInterval:           10 * time.Millisecond,
+	}, h, cmd, &stdout
+}
+
+func TestParseWaitCondition(t *testing.T) {
+	// == act ==
+	empty, err1 := ParseWaitCondition("")
+	removed, err2 := ParseWaitCondition("removed")
+	_, err3 := ParseWaitCondition("paused")
+
+	// == assert ==
+	assert.Nil(t, err1)
+	assert.Equal(t, WaitConditionStopped, empty)
+	assert.Nil(t, err2)
+	assert.Equal(t, WaitConditionRemoved, removed)
+	assert.NotNil(t, err3)
+}
+
+func TestContainerWait_StoppedReturnsExitCode(t *testing.T) {
+	// == arrange ==
+	w, h, _, stdout := newTestContainerWait(t, status.RUNNING)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = h.RecordExit("c1", status.ExitInfo{ExitCode: 3, FinishedAt: time.Now()})
+	}()
+
+	// == act ==
+	err := w.Execute(WaitOption{ContainerId: "c1", Condition: WaitConditionStopped})
+
+	// == assert ==
+	assert.Equal(t, &ExitStatusError{Status: 3}, err)
+	assert.Equal(t, "3\n", stdout.String())
+}
+
+func TestContainerWait_InitGoneWithoutExit(t *testing.T) {
+	// == arrange ==
+	w, _, cmd, stdout := newTestContainerWait(t, status.RUNNING)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// reaped by the cleanup of newTestContainerWait
+		_ = cmd.Process.Kill()
+	}()
+
+	// == act ==
+	err := w.Execute(WaitOption{ContainerId: "c1", Condition: WaitConditionStopped, Timeout: 5 * time.Second})
+
+	// == assert ==
+	// the container ran without a shim, as with --console-socket
+	assert.ErrorContains(t, err, "without an exit status: it has no shim to record the exit")
+	assert.Equal(t, "", stdout.String())
+}
+
+func TestContainerWait_StoppedWhileShimRecordsExit(t *testing.T) {
+	// == arrange ==
+	w, h, cmd, stdout := newTestContainerWait(t, status.RUNNING)
+	// stopped without an exit while the shim, played by the sleeping
+	// process, still runs
+	assert.Nil(t, h.UpdateStatus("c1", status.STOPPED, 0, cmd.Process.Pid))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = h.RecordExit("c1", status.ExitInfo{ExitCode: 5, FinishedAt: time.Now()})
+	}()
+
+	// == act ==
+	err := w.Execute(WaitOption{ContainerId: "c1", Condition: WaitConditionStopped, Timeout: 5 * time.Second})
+
+	// == assert ==
+	assert.Equal(t, &ExitStatusError{Status: 5}, err)
+	assert.Equal(t, "5\n", stdout.String())
+}
+
+func TestContainerWait_Timeout(t *testing.T) {
+	// == arrange ==
+	w, _, _, _ := newTestContainerWait(t, status.RUNNING)
+
+	// == act ==
+	start := time.Now()
+	err := w.Execute(WaitOption{ContainerId: "c1", Condition: WaitConditionStopped, Timeout: 100 * time.Millisecond})
+
+	// == assert ==
+	assert.ErrorContains(t, err, "timed out")
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestContainerWait_Running(t *testing.T) {
+	// == arrange ==
+	w, h, _, _ := newTestContainerWait(t, status.CREATED)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = h.UpdateStatus("c1", status.RUNNING, -1, -1)
+	}()
+
+	// == act ==
+	err := w.Execute(WaitOption{ContainerId: "c1", Condition: WaitConditionRunning, Timeout: 5 * time.Second})
+
+	// == assert ==
+	assert.Nil(t, err)
+}
+
+func TestContainerWait_Removed(t *testing.T) {
+	// == arrange ==
+	w, h, _, stdout := newTestContainerWait(t, status.RUNNING)
+	assert.Nil(t, h.RecordExit("c1", status.ExitInfo{ExitCode: 0, FinishedAt: time.Now()}))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.RemoveAll(utils.ContainerDir("c1"))
+	}()
+
+	// == act ==
+	err := w.Execute(WaitOption{ContainerId: "c1", Condition: WaitConditionRemoved, Timeout: 5 * time.Second})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "0\n", stdout.String())
+}
@@ -0,0 +1,135 @@
+package hook
+
+import (
+	"droplet/internal/utils"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// namespaces joined by in-container hooks, keyed by /proc/<pid>/ns entry
+var containerNamespaces = []struct {
+	name string
+	flag int
+}{
+	{"user", unix.CLONE_NEWUSER},
+	{"mnt", unix.CLONE_NEWNS},
+	{"cgroup", unix.CLONE_NEWCGROUP},
+	{"ipc", unix.CLONE_NEWIPC},
+	{"uts", unix.CLONE_NEWUTS},
+	{"net", unix.CLONE_NEWNET},
+	{"pid", unix.CLONE_NEWPID},
+}
+
+// containerContextOpener opens the execution context of a running container
+// for in-container hooks.
+//
+// It is an interface so that the behavior can be mocked in tests.
+type containerContextOpener interface {
+	open(containerId string, pid int) (*containerContext, error)
+}
+
+// containerContext holds the handles needed to run a hook inside a
+// container: a pidfd of the init process (namespaces), the init root
+// directory and the container cgroup.
+type containerContext struct {
+	pidfd   *os.File
+	root    *os.File
+	cgroup  *os.File
+	nsFlags int
+}
+
+// newProcContainerContextOpener returns the default containerContextOpener.
+func newProcContainerContextOpener() *procContainerContextOpener {
+	return &procContainerContextOpener{}
+}
+
+// procContainerContextOpener opens the container context through
+// pidfd_open(2) and /proc/<pid>.
+type procContainerContextOpener struct{}
+
+// open returns the context of the container whose init process is pid.
+//
+// Only namespaces that differ from the runtime's own are joined, since
+// setns(2) rejects joining the user namespace the caller is already in.
+// The cgroup handle is nil if the container has no cgroup directory.
+func (o *procContainerContextOpener) open(containerId string, pid int) (*containerContext, error) {
+	if pid <= 0 {
+		return nil, fmt.Errorf("container %s has no init process", containerId)
+	}
+
+	ctx := &containerContext{}
+
+	// namespaces
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return nil, fmt.Errorf("pidfd_open(%d): %w", pid, err)
+	}
+	ctx.pidfd = os.NewFile(uintptr(pidfd), "pidfd")
+	for _, ns := range containerNamespaces {
+		self, err := os.Readlink("/proc/self/ns/" + ns.name)
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/%s", pid, ns.name))
+		if err != nil {
+			ctx.close()
+			return nil, err
+		}
+		if self != target {
+			ctx.nsFlags |= ns.flag
+		}
+	}
+
+	// root directory
+	rootfd, err := unix.Open(fmt.Sprintf("/proc/%d/root", pid), unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		ctx.close()
+		return nil, err
+	}
+	ctx.root = os.NewFile(uintptr(rootfd), "root")
+
+	// cgroup
+	cgroupfd, err := unix.Open(utils.CgroupPath(containerId), unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err == nil {
+		ctx.cgroup = os.NewFile(uintptr(cgroupfd), "cgroup")
+	} else if !os.IsNotExist(err) {
+		ctx.close()
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+// env returns the environment variables read by the nsexec constructor.
+// The pidfd and root are passed as ExtraFiles, i.e. fd 3 and fd 4.
+func (c *containerContext) env() []string {
+	return []string{
+		"_DROPLET_NSEXEC_PIDFD=3",
+		"_DROPLET_NSEXEC_ROOTFD=4",
+		"_DROPLET_NSEXEC_FLAGS=" + strconv.Itoa(c.nsFlags),
+	}
+}
+
+// extraFiles returns the files inherited by the hook-exec process.
+func (c *containerContext) extraFiles() []*os.File {
+	return []*os.File{c.pidfd, c.root}
+}
+
+// cgroupFd returns the container cgroup fd, or -1 if there is none.
+func (c *containerContext) cgroupFd() int {
+	if c.cgroup == nil {
+		return -1
+	}
+	return int(c.cgroup.Fd())
+}
+
+func (c *containerContext) close() {
+	for _, f := range []*os.File{c.pidfd, c.root, c.cgroup} {
+		if f != nil {
+			_ = f.Close()
+		}
+	}
+}
@@ -3,14 +3,18 @@ package hook
 import (
 	"bytes"
 	"droplet/internal/logs"
+	"droplet/internal/nsexec"
 	"droplet/internal/spec"
 	"droplet/internal/status"
 	"droplet/internal/utils"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -33,6 +37,7 @@ func NewHookController() *HookController {
 	return &HookController{
 		commandFactory:         utils.NewCommandFactory(),
 		containerStatusManager: status.NewStatusHandler(),
+		containerContextOpener: newProcContainerContextOpener(),
 	}
 }
 
@@ -41,11 +46,13 @@ func NewHookController() *HookController {
 // It is responsible for:
 //   - Reading container state from state.json
 //   - Preparing the environment and stdin for each hook process
-//   - Optionally entering the container namespaces via nsenter
-//   - Executing the hook commands in sequence
+//   - Optionally entering the container namespaces and cgroup
+//   - Executing the hook commands in order (optionally in parallel groups)
+//   - Capturing hook output to per-hook log files
 type HookController struct {
 	commandFactory         utils.CommandFactory
 	containerStatusManager status.ContainerStatusManager
+	containerContextOpener containerContextOpener
 }
 
 // RunCreateRuntimeHooks executes the createRuntime hook list in the host
@@ -60,7 +67,7 @@ func (c *HookController) RunCreateRuntimeHooks(containerId string, hookList []sp
 }
 
 // RunCreateContainerHooks executes the createContainer hook list in the
-// container's namespaces using nsenter. If the list is nil or empty,
+// container's namespaces and cgroup. If the list is nil or empty,
 // it is a no-op.
 //
 // This corresponds to the OCI createContainer lifecycle phase.
@@ -68,11 +75,11 @@ func (c *HookController) RunCreateContainerHooks(containerId string, hookList []
 	if hookList == nil || len(hookList) == 0 {
 		return nil
 	}
-	return c.runHookListWithNsenter(containerId, "createContainer", hookList)
+	return c.runHookListInContainer(containerId, "createContainer", hookList)
 }
 
 // RunStartContainerHooks executes the startContainer hook list in the
-// container's namespaces using nsenter. If the list is nil or empty,
+// container's namespaces and cgroup. If the list is nil or empty,
 // it is a no-op.
 //
 // This corresponds to the OCI startContainer lifecycle phase.
@@ -80,12 +87,15 @@ func (c *HookController) RunStartContainerHooks(containerId string, hookList []s
 	if hookList == nil || len(hookList) == 0 {
 		return nil
 	}
-	return c.runHookListWithNsenter(containerId, "startContainer", hookList)
+	return c.runHookListInContainer(containerId, "startContainer", hookList)
 }
 
 // RunPoststartHooks executes the poststart hook list in the host
 // namespaces. If the list is nil or empty, it is a no-op.
 //
+// Failures are reported as warnings unless overridden by the
+// io.raind.hooks.onFailure annotation.
+//
 // This corresponds to the OCI poststart lifecycle phase.
 func (c *HookController) RunPoststartHooks(containerId string, hookList []spec.HookObject) error {
 	if hookList == nil || len(hookList) == 0 {
@@ -94,6 +104,11 @@ func (c *HookController) RunPoststartHooks(containerId string, hookList []spec.H
 	return c.runHookList(containerId, "poststart", hookList)
 }
 
+// RunStopContainerHooks executes the stopContainer hook list in the host
+// namespaces. If the list is nil or empty, it is a no-op.
+//
+// Failures are reported as warnings unless overridden by the
+// io.raind.hooks.onFailure annotation.
 func (c *HookController) RunStopContainerHooks(containerId string, hookList []spec.HookObject) error {
 	if hookList == nil || len(hookList) == 0 {
 		return nil
@@ -104,6 +119,9 @@ func (c *HookController) RunStopContainerHooks(containerId string, hookList []sp
 // RunPoststopHooks executes the poststop hook list in the host
 // namespaces. If the list is nil or empty, it is a no-op.
 //
+// Failures are reported as warnings unless overridden by the
+// io.raind.hooks.onFailure annotation.
+//
 // This corresponds to the OCI poststop lifecycle phase.
 func (c *HookController) RunPoststopHooks(containerId string, hookList []spec.HookObject) error {
 	if hookList == nil || len(hookList) == 0 {
@@ -112,108 +130,70 @@ func (c *HookController) RunPoststopHooks(containerId string, hookList []spec.Ho
 	return c.runHookList(containerId, "poststop", hookList)
 }
 
+// hookRunConfig is the input shared by every hook of a phase.
+type hookRunConfig struct {
+	stateJson string
+	policies  failurePolicies
+	groups    parallelGroups
+}
+
+// hookCommand is a hook process prepared for execution.
+type hookCommand struct {
+	cmd         utils.CommandExecutor
+	sysProcAttr *syscall.SysProcAttr
+}
+
 // runHookList executes a list of hooks in the host namespaces.
 //
 // For each hook:
 //   - Validates that the hook path is non-empty
 //   - Reads state.json and passes it as stdin to the hook
 //   - Inherits the current environment and appends hook-specific variables
-//   - Directs stdout and stderr to the runtime's stdio
+//   - Writes stdout and stderr to the hook log file
+//   - Kills the hook's process group if its timeout expires
 //
-// If any hook fails, execution stops and an error is returned which includes
-// the phase name and index in the hook list.
+// A failing hook is handled according to its failure policy (see
+// failurePolicies). If the policy is abort, execution stops and an error
+// is returned which includes the phase name and index in the hook list.
 func (c *HookController) runHookList(containerId string, phase string, hookList []spec.HookObject) error {
 	// read state.json
-	stateJson, err := c.containerStatusManager.ReadStatusFile(containerId)
+	config, err := c.readState(containerId)
 	if err != nil {
 		return err
 	}
 
-	for i, hook := range hookList {
-		start := time.Now()
-
-		if hook.Path == "" {
-			return fmt.Errorf("hook %s[%d]: empty path", phase, i)
-		}
-
-		// set args
-		args := hook.Args
-		if len(args) == 0 {
-			args = []string{}
-		}
-
-		// prepare hook environment
-		var stderr bytes.Buffer
-		cmd := c.commandFactory.Command(hook.Path, args...)
+	return c.runPhase(containerId, phase, hookList, config, func(hook spec.HookObject) hookCommand {
+		cmd := c.commandFactory.Command(hook.Path, hookArgs(hook)...)
 		cmd.SetEnv(hook.Env)
-		cmd.SetStdin(bytes.NewReader([]byte(stateJson)))
-		cmd.SetStdout(os.Stdout)
-		cmd.SetStderr(&stderr)
-
-		// execute hook
-		err := cmd.Run()
-		exitCode := 0
-		if err != nil {
-			if ee, ok := err.(*exec.ExitError); ok {
-				exitCode = ee.ExitCode()
-			} else {
-				exitCode = -1
-			}
-		}
-		st := stderr.Bytes()
-		if len(st) > 1024 {
-			st = st[len(st)-1024:]
-		}
-		result := "success"
-		if err != nil {
-			result = "fail"
-		}
-
-		duration := time.Since(start)
-
-		// audit log
-		rec := logs.HookResult{
-			Phase:       phase,
-			Path:        hook.Path,
-			ArgsSHA256:  utils.Sha256Bytes([]byte(strings.Join(args, ","))),
-			StdinSHA256: utils.Sha256Bytes([]byte(stateJson)),
-			StdinBytes:  len([]byte(stateJson)),
-			ExitCode:    exitCode,
-			DurationMS:  duration.Milliseconds(),
-			StderrTail:  string(st),
-		}
-
-		_ = logs.RecordHookAuditLog(logs.AuditHookRecord{
-			ContainerId: containerId,
-			Event:       "hook",
-			Hook:        rec,
-			Result:      result,
-		})
-
-		if err != nil {
-			return fmt.Errorf("hook %s[%d] failed: %w", phase, i, err)
-		}
-
-	}
-
-	return nil
+		return hookCommand{cmd: cmd, sysProcAttr: &syscall.SysProcAttr{}}
+	})
 }
 
-// runHookListWithNsenter executes a list of hooks inside the container's
-// namespaces using nsenter.
+// runHookListInContainer executes a list of hooks inside the container's
+// namespaces and cgroup.
+//
+// The hooks are run by re-executing this binary as `hook-exec`, whose
+// nsexec constructor joins the namespaces of the init process (including
+// the user and cgroup namespaces) before the Go runtime starts. The
+// process is created directly in the container cgroup (CLONE_INTO_CGROUP)
+// and the hook path is resolved against the init process's root directory.
 //
 // For each hook:
 //   - Validates that the hook path is non-empty
-//   - Resolves the container init PID from state.json
-//   - Builds an nsenter command targeting the container namespaces
 //   - Passes state.json as stdin and appends hook environment variables
-//   - Directs stdout and stderr to the runtime's stdio
+//   - Writes stdout and stderr to the hook log file
+//   - Kills the hook's process group if its timeout expires
 //
-// If any hook fails, execution stops and an error is returned which includes
-// the phase name and index in the hook list.
-func (c *HookController) runHookListWithNsenter(containerId string, phase string, hookList []spec.HookObject) error {
+// A failing hook is handled according to its failure policy (see
+// failurePolicies). If the policy is abort, execution stops and an error
+// is returned which includes the phase name and index in the hook list.
+func (c *HookController) runHookListInContainer(containerId string, phase string, hookList []spec.HookObject) error {
+	if !nsexec.Enabled {
+		return fmt.Errorf("hook %s: in-container hooks require a cgo enabled build", phase)
+	}
+
 	// read state.json
-	stateJson, err := c.containerStatusManager.ReadStatusFile(containerId)
+	config, err := c.readState(containerId)
 	if err != nil {
 		return err
 	}
@@ -224,79 +204,269 @@ func (c *HookController) runHookListWithNsenter(containerId string, phase string
 		return err
 	}
 
-	for i, hook := range hookList {
-		start := time.Now()
+	// open namespaces, root directory and cgroup of the container
+	containerCtx, err := c.containerContextOpener.open(containerId, initPid)
+	if err != nil {
+		return fmt.Errorf("hook %s: %w", phase, err)
+	}
+	defer containerCtx.close()
+
+	return c.runPhase(containerId, phase, hookList, config, func(hook spec.HookObject) hookCommand {
+		// prepare hook-exec subcommand
+		hookExecArgs := append([]string{"hook-exec", hook.Path}, hookArgs(hook)...)
+		cmd := c.commandFactory.Command(os.Args[0], hookExecArgs...)
+		cmd.SetEnv(hook.Env)
+		cmd.SetEnv(containerCtx.env())
+		cmd.SetExtraFiles(containerCtx.extraFiles())
+		sysProcAttr := &syscall.SysProcAttr{}
+		if fd := containerCtx.cgroupFd(); fd >= 0 {
+			sysProcAttr.UseCgroupFD = true
+			sysProcAttr.CgroupFD = fd
+		}
+		return hookCommand{cmd: cmd, sysProcAttr: sysProcAttr}
+	})
+}
+
+// hookArgs returns the arguments passed after the hook path.
+func hookArgs(hook spec.HookObject) []string {
+	if len(hook.Args) == 0 {
+		return []string{}
+	}
+	return hook.Args
+}
 
+// runPhase executes the hooks of a phase in the order planned from the
+// io.raind.hooks.parallel annotation and records their results for the
+// `hooks` command.
+//
+// Hooks of a parallel group are started together and the group is
+// waited for as a whole; if any of them is aborted, the error of the
+// lowest index is returned after the group has exited.
+func (c *HookController) runPhase(containerId string, phase string, hookList []spec.HookObject,
+	config hookRunConfig, prepare func(hook spec.HookObject) hookCommand) error {
+	for i, hook := range hookList {
 		if hook.Path == "" {
 			return fmt.Errorf("hook %s[%d]: empty path", phase, i)
 		}
+	}
+	plan, err := config.groups.plan(phase, len(hookList))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(utils.HookLogDir(containerId), 0o750); err != nil {
+		return err
+	}
 
-		// set args
-		args := hook.Args
-		if len(args) == 0 {
-			args = []string{}
+	var results []HookRunResult
+	defer func() {
+		_ = writeHookResults(containerId, phase, results)
+	}()
+
+	for _, group := range plan {
+		commands := make([]hookCommand, len(group))
+		for gi, index := range group {
+			commands[gi] = prepare(hookList[index])
 		}
 
-		// prepare hook environment with nsenter
-		nsenterArgs := []string{
-			"nsenter",
-			"-t", strconv.Itoa(initPid),
-			"-m", "-u", "-i", "-n", "-p",
-			"--",
-			hook.Path,
+		groupResults := make([]HookRunResult, len(group))
+		errs := make([]error, len(group))
+		var wg sync.WaitGroup
+		for gi, index := range group {
+			wg.Add(1)
+			go func(gi int, index int) {
+				defer wg.Done()
+				groupResults[gi], errs[gi] = c.runHook(containerId, phase, index, hookList[index],
+					commands[gi], config.stateJson, config.policies.lookup(phase, index))
+			}(gi, index)
 		}
-		nsenterArgs = append(nsenterArgs, args...)
+		wg.Wait()
 
-		var stderr bytes.Buffer
-		cmd := c.commandFactory.Command("/usr/bin/nsenter", nsenterArgs...)
-		cmd.SetEnv(hook.Env)
-		cmd.SetStdin(bytes.NewReader([]byte(stateJson)))
-		cmd.SetStdout(os.Stdout)
-		cmd.SetStderr(&stderr)
-
-		// execute hook
-		err := cmd.Run()
-		exitCode := 0
-		if err != nil {
-			if ee, ok := err.(*exec.ExitError); ok {
-				exitCode = ee.ExitCode()
-			} else {
-				exitCode = -1
+		results = append(results, groupResults...)
+		for _, err := range errs {
+			if err != nil {
+				return err
 			}
 		}
-		st := stderr.Bytes()
-		if len(st) > 1024 {
-			st = st[len(st)-1024:]
+	}
+
+	return nil
+}
+
+// readState returns the raw state.json passed to hooks on stdin together
+// with the hook failure policies and parallel groups from the container
+// annotations.
+func (c *HookController) readState(containerId string) (hookRunConfig, error) {
+	stateJson, err := c.containerStatusManager.ReadStatusFile(containerId)
+	if err != nil {
+		return hookRunConfig{}, err
+	}
+	var statusObject status.StatusObject
+	if err := json.Unmarshal([]byte(stateJson), &statusObject); err != nil {
+		return hookRunConfig{}, err
+	}
+	policies, err := parseFailurePolicies(statusObject.Annotations.HooksOnFailure())
+	if err != nil {
+		return hookRunConfig{}, err
+	}
+	groups, err := parseParallelGroups(statusObject.Annotations.HooksParallel())
+	if err != nil {
+		return hookRunConfig{}, err
+	}
+	return hookRunConfig{
+		stateJson: stateJson,
+		policies:  policies,
+		groups:    groups,
+	}, nil
+}
+
+// runHook executes a single prepared hook command, records the result in
+// the audit log and applies the failure policy.
+//
+// stdout and stderr of the hook are written to
+// logs/hooks/<phase>-<index>.log, which is truncated on every run.
+// It returns an error only if the hook failed and the policy is abort.
+func (c *HookController) runHook(containerId string, phase string, index int, hook spec.HookObject,
+	command hookCommand, stateJson string, policy FailurePolicy) (HookRunResult, error) {
+	logPath := utils.HookLogPath(containerId, phase, index)
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return HookRunResult{}, err
+	}
+	defer logFile.Close()
+
+	var stderr bytes.Buffer
+	cmd := command.cmd
+	cmd.SetStdin(bytes.NewReader([]byte(stateJson)))
+	cmd.SetStdout(logFile)
+	cmd.SetStderr(io.MultiWriter(logFile, &stderr))
+
+	// execute hook
+	startedAt := time.Now()
+	elapsed, timedOut, err := c.executeHook(cmd, command.sysProcAttr, hook.Timeout)
+	exitCode := 0
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			exitCode = ee.ExitCode()
+		} else {
+			exitCode = -1
 		}
-		result := "success"
-		if err != nil {
+	}
+	st := stderr.Bytes()
+	if len(st) > 1024 {
+		st = st[len(st)-1024:]
+	}
+	result := "success"
+	if err != nil {
+		switch policy {
+		case FailureAbort:
 			result = "fail"
+		case FailureWarn:
+			result = "warn"
+		case FailureIgnore:
+			result = "ignore"
 		}
+	}
 
-		duration := time.Since(start)
-
-		// audit log
-		rec := logs.HookResult{
-			Phase:       phase,
-			Path:        hook.Path,
-			ArgsSHA256:  utils.Sha256Bytes([]byte(strings.Join(args, ","))),
-			StdinSHA256: utils.Sha256Bytes([]byte(stateJson)),
-			StdinBytes:  len([]byte(stateJson)),
-			ExitCode:    exitCode,
-			DurationMS:  duration.Milliseconds(),
-			StderrTail:  string(st),
-		}
+	// audit log
+	rec := logs.HookResult{
+		Phase:       phase,
+		Path:        hook.Path,
+		ArgsSHA256:  utils.Sha256Bytes([]byte(strings.Join(hook.Args, ","))),
+		StdinSHA256: utils.Sha256Bytes([]byte(stateJson)),
+		StdinBytes:  len([]byte(stateJson)),
+		ExitCode:    exitCode,
+		DurationMS:  elapsed.Milliseconds(),
+		StderrTail:  string(st),
+		TimedOut:    timedOut,
+	}
+	if hook.Timeout != nil {
+		rec.TimeoutMS = int64(*hook.Timeout) * 1000
+	}
+
+	_ = logs.RecordHookAuditLog(logs.AuditHookRecord{
+		ContainerId: containerId,
+		Event:       "hook",
+		Hook:        rec,
+		Result:      result,
+	})
+
+	runResult := HookRunResult{
+		Phase:      phase,
+		Index:      index,
+		Path:       hook.Path,
+		Result:     result,
+		ExitCode:   exitCode,
+		TimedOut:   timedOut,
+		StartedAt:  startedAt,
+		DurationMS: elapsed.Milliseconds(),
+		Log:        logPath,
+	}
+	if err == nil {
+		return runResult, nil
+	}
+	runResult.Error = err.Error()
+
+	switch policy {
+	case FailureWarn:
+		fmt.Fprintf(os.Stderr, "warning: hook %s[%d] failed: %v\n", phase, index, err)
+		return runResult, nil
+	case FailureIgnore:
+		return runResult, nil
+	default:
+		return runResult, fmt.Errorf("hook %s[%d] failed: %w", phase, index, err)
+	}
+}
 
-		_ = logs.RecordHookAuditLog(logs.AuditHookRecord{
-			ContainerId: containerId,
-			Event:       "hook",
-			Hook:        rec,
-			Result:      result,
-		})
+// hookKillGracePeriod bounds how long executeHook waits for a hook to be
+// reaped after it was killed on timeout.
+const hookKillGracePeriod = 2 * time.Second
 
-		if err != nil {
-			return fmt.Errorf("hook %s[%d] failed: %w", phase, i, err)
+// executeHook starts a hook process and waits for it to exit.
+//
+// The hook is started in its own process group so that, when the OCI
+// timeout (in seconds) expires, the hook and any processes it spawned
+// can be killed together. A nil timeout waits indefinitely.
+//
+// It returns the elapsed time and whether the hook was killed by the timeout.
+func (c *HookController) executeHook(cmd utils.CommandExecutor, sysProcAttr *syscall.SysProcAttr, timeout *int) (time.Duration, bool, error) {
+	if timeout != nil && *timeout <= 0 {
+		return 0, false, fmt.Errorf("invalid timeout: %d", *timeout)
+	}
+
+	start := time.Now()
+	sysProcAttr.Setpgid = true
+	cmd.SetSysProcAttr(sysProcAttr)
+	if err := cmd.Start(); err != nil {
+		return time.Since(start), false, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	if timeout == nil {
+		err := <-done
+		return time.Since(start), false, err
+	}
+
+	timer := time.NewTimer(time.Duration(*timeout) * time.Second)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return time.Since(start), false, err
+	case <-timer.C:
+		// kill the whole process group (pgid == pid of the hook)
+		if pid := cmd.Pid(); pid > 0 {
+			_ = syscall.Kill(-pid, syscall.SIGKILL)
+		}
+		// a descendant that left the process group may keep stdio open,
+		// so do not wait for it forever
+		select {
+		case <-done:
+		case <-time.After(hookKillGracePeriod):
 		}
+		return time.Since(start), true, fmt.Errorf("timed out after %ds", *timeout)
 	}
-	return nil
 }
@@ -0,0 +1,464 @@
+package hook
+
+import (
+	"droplet/internal/logs"
+	"droplet/internal/spec"
+	"droplet/internal/status"
+	"droplet/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// == fakes ==
+
+type fakeCommand struct {
+	startErr error
+	waitErr  error
+}
+
+func (f *fakeCommand) Start() error                             { return f.startErr }
+func (f *fakeCommand) Wait() error                              { return f.waitErr }
+func (f *fakeCommand) Run() error                               { return f.waitErr }
+func (f *fakeCommand) Pid() int                                 { return -1 }
+func (f *fakeCommand) SetEnv(envv []string)                     {}
+func (f *fakeCommand) SetStdout(w io.Writer)                    {}
+func (f *fakeCommand) SetStderr(w io.Writer)                    {}
+func (f *fakeCommand) SetStdin(r io.Reader)                     {}
+func (f *fakeCommand) SetSysProcAttr(attr *syscall.SysProcAttr) {}
+func (f *fakeCommand) SetExtraFiles(files []*os.File)           {}
+
+type fakeCommandFactory struct {
+	errs  map[string]error
+	names []string
+	args  [][]string
+}
+
+func (f *fakeCommandFactory) Command(name string, args ...string) utils.CommandExecutor {
+	f.names = append(f.names, name)
+	f.args = append(f.args, args)
+	// hooks run via nsenter carry the hook path as an argument
+	if err, ok := f.errs[name]; ok {
+		return &fakeCommand{waitErr: err}
+	}
+	for _, a := range args {
+		if err, ok := f.errs[a]; ok {
+			return &fakeCommand{waitErr: err}
+		}
+	}
+	return &fakeCommand{}
+}
+
+type fakeStatusManager struct {
+	state string
+	pid   int
+}
+
+func (f *fakeStatusManager) CreateStatusFile(containerId string, pid int, s status.ContainerStatus, rootfs string, bundle string, annotation spec.AnnotationObject) error {
+	return nil
+}
+func (f *fakeStatusManager) RemoveStatusFile(containerId string) error { return nil }
+func (f *fakeStatusManager) ReadStatusFile(containerId string) (string, error) {
+	return f.state, nil
+}
+func (f *fakeStatusManager) UpdateStatus(containerId string, s status.ContainerStatus, pid int, shimPid int) error {
+	return nil
+}
+func (f *fakeStatusManager) RecordExit(containerId string, exit status.ExitInfo) error {
+	return nil
+}
+func (f *fakeStatusManager) RecordLogFormat(containerId string, format string) error {
+	return nil
+}
+func (f *fakeStatusManager) GetPidFromId(containerId string) (int, error) { return f.pid, nil }
+func (f *fakeStatusManager) GetStatusFromId(containerId string) (status.ContainerStatus, error) {
+	return status.RUNNING, nil
+}
+func (f *fakeStatusManager) GetProcIdentityFromId(containerId string) (utils.ProcIdentity, error) {
+	return utils.ProcIdentity{Pid: f.pid}, nil
+}
+func (f *fakeStatusManager) GetShimPidFromId(containerId string) (int, error) { return 0, nil }
+func (f *fakeStatusManager) GetShimIdentityFromId(containerId string) (utils.ProcIdentity, error) {
+	return utils.ProcIdentity{}, nil
+}
+func (f *fakeStatusManager) GetBundleFromId(containerId string) (string, error) {
+	return "/bundle", nil
+}
+func (f *fakeStatusManager) ListContainers() ([]status.StatusObject, error) { return nil, nil }
+
+type fakeContainerContextOpener struct{}
+
+func (f *fakeContainerContextOpener) open(containerId string, pid int) (*containerContext, error) {
+	return &containerContext{nsFlags: syscall.CLONE_NEWNS | syscall.CLONE_NEWPID}, nil
+}
+
+func newTestHookController(t *testing.T, hooksAnnotation string, errs map[string]error) (*HookController, *fakeCommandFactory) {
+	t.Helper()
+	return newTestHookControllerWithAnnotation(t, spec.AnnotationObject{spec.AnnotationKeyHooksOnFailure: hooksAnnotation}, errs)
+}
+
+func newTestHookControllerWithAnnotation(t *testing.T, annotation spec.AnnotationObject, errs map[string]error) (*HookController, *fakeCommandFactory) {
+	t.Helper()
+	// hook logs are written under the state root
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	state, err := json.Marshal(status.StatusObject{
+		Id:          "111111",
+		Status:      "running",
+		Pid:         12345,
+		Annotations: annotation,
+	})
+	assert.Nil(t, err)
+
+	factory := &fakeCommandFactory{errs: errs}
+	return &HookController{
+		commandFactory:         factory,
+		containerStatusManager: &fakeStatusManager{state: string(state), pid: 12345},
+		containerContextOpener: &fakeContainerContextOpener{},
+	}, factory
+}
+
+var errHookFailed = errors.New("exit status 1")
+
+// == tests ==
+
+func TestRunCreateRuntimeHooks_FailureAborts(t *testing.T) {
+	// == arrange ==
+	controller, factory := newTestHookController(t, "", map[string]error{"/bin/hook1": errHookFailed})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunCreateRuntimeHooks("111111", hooks)
+
+	// == assert ==
+	assert.EqualError(t, err, "hook createRuntime[0] failed: exit status 1")
+	assert.Equal(t, []string{"/bin/hook1"}, factory.names)
+}
+
+func TestRunCreateContainerHooks_FailureAborts(t *testing.T) {
+	// == arrange ==
+	controller, factory := newTestHookController(t, "", map[string]error{"/bin/hook1": errHookFailed})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunCreateContainerHooks("111111", hooks)
+
+	// == assert ==
+	assert.EqualError(t, err, "hook createContainer[0] failed: exit status 1")
+	assert.Equal(t, 1, len(factory.names))
+	assert.Equal(t, []string{"hook-exec", "/bin/hook1"}, factory.args[0])
+}
+
+func TestRunStartContainerHooks_FailureAborts(t *testing.T) {
+	// == arrange ==
+	controller, _ := newTestHookController(t, "", map[string]error{"/bin/hook2": errHookFailed})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunStartContainerHooks("111111", hooks)
+
+	// == assert ==
+	assert.EqualError(t, err, "hook startContainer[1] failed: exit status 1")
+}
+
+func TestRunPoststartHooks_FailureWarns(t *testing.T) {
+	// == arrange ==
+	controller, factory := newTestHookController(t, "", map[string]error{"/bin/hook1": errHookFailed})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunPoststartHooks("111111", hooks)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/bin/hook1", "/bin/hook2"}, factory.names)
+}
+
+func TestRunPoststopHooks_FailureWarns(t *testing.T) {
+	// == arrange ==
+	controller, factory := newTestHookController(t, "", map[string]error{"/bin/hook1": errHookFailed})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunPoststopHooks("111111", hooks)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(factory.names))
+}
+
+func TestRunStopContainerHooks_FailureWarns(t *testing.T) {
+	// == arrange ==
+	controller, _ := newTestHookController(t, "", map[string]error{"/bin/hook1": errHookFailed})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}}
+
+	// == act ==
+	err := controller.RunStopContainerHooks("111111", hooks)
+
+	// == assert ==
+	assert.Nil(t, err)
+}
+
+func TestRunPoststartHooks_PhaseAbortAnnotation(t *testing.T) {
+	// == arrange ==
+	controller, factory := newTestHookController(t, `{"poststart":"abort"}`, map[string]error{"/bin/hook1": errHookFailed})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunPoststartHooks("111111", hooks)
+
+	// == assert ==
+	assert.EqualError(t, err, "hook poststart[0] failed: exit status 1")
+	assert.Equal(t, 1, len(factory.names))
+}
+
+func TestRunCreateRuntimeHooks_HookIgnoreAnnotation(t *testing.T) {
+	// == arrange ==
+	controller, factory := newTestHookController(t, `{"createRuntime[0]":"ignore"}`, map[string]error{
+		"/bin/hook1": errHookFailed,
+		"/bin/hook2": errHookFailed,
+	})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunCreateRuntimeHooks("111111", hooks)
+
+	// == assert ==
+	assert.EqualError(t, err, "hook createRuntime[1] failed: exit status 1")
+	assert.Equal(t, 2, len(factory.names))
+}
+
+func TestRunCreateRuntimeHooks_HookOverridesPhase(t *testing.T) {
+	// == arrange ==
+	controller, _ := newTestHookController(t, `{"createRuntime":"warn","createRuntime[1]":"abort"}`, map[string]error{
+		"/bin/hook1": errHookFailed,
+		"/bin/hook2": errHookFailed,
+	})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunCreateRuntimeHooks("111111", hooks)
+
+	// == assert ==
+	assert.EqualError(t, err, "hook createRuntime[1] failed: exit status 1")
+}
+
+func TestRunPoststartHooks_InvalidAnnotation(t *testing.T) {
+	// == arrange ==
+	controller, factory := newTestHookController(t, `{"poststart":"retry"}`, nil)
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}}
+
+	// == act ==
+	err := controller.RunPoststartHooks("111111", hooks)
+
+	// == assert ==
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(factory.names))
+}
+
+func TestRunCreateRuntimeHooks_InvalidTimeout(t *testing.T) {
+	// == arrange ==
+	controller, _ := newTestHookController(t, "", nil)
+	timeout := 0
+	hooks := []spec.HookObject{{Path: "/bin/hook1", Timeout: &timeout}}
+
+	// == act ==
+	err := controller.RunCreateRuntimeHooks("111111", hooks)
+
+	// == assert ==
+	assert.EqualError(t, err, "hook createRuntime[0] failed: invalid timeout: 0")
+}
+
+func TestParseFailurePolicies_Lookup(t *testing.T) {
+	// == arrange ==
+	annotation := `{"poststop":"abort","createContainer[2]":"warn"}`
+
+	// == act ==
+	policies, err := parseFailurePolicies(annotation)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, FailureAbort, policies.lookup("poststop", 0))
+	assert.Equal(t, FailureWarn, policies.lookup("createContainer", 2))
+	assert.Equal(t, FailureAbort, policies.lookup("createContainer", 1))
+	assert.Equal(t, FailureWarn, policies.lookup("poststart", 0))
+}
+
+func TestParseFailurePolicies_InvalidKey(t *testing.T) {
+	// == arrange ==
+	annotation := `{"poststop[x]":"abort"}`
+
+	// == act ==
+	_, err := parseFailurePolicies(annotation)
+
+	// == assert ==
+	assert.NotNil(t, err)
+}
+
+func TestRunPoststartHooks_RecordsResults(t *testing.T) {
+	// == arrange ==
+	controller, _ := newTestHookController(t, "", map[string]error{"/bin/hook2": errHookFailed})
+	hooks := []spec.HookObject{{Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunPoststartHooks("111111", hooks)
+	results, readErr := ReadHookResults("111111")
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Nil(t, readErr)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "success", results[0].Result)
+	assert.Equal(t, "warn", results[1].Result)
+	assert.Equal(t, "exit status 1", results[1].Error)
+	assert.FileExists(t, results[1].Log)
+	assert.Equal(t, "poststart-1.log", filepath.Base(results[1].Log))
+}
+
+func TestRunCreateRuntimeHooks_ParallelGroupAborts(t *testing.T) {
+	// == arrange ==
+	controller, factory := newTestHookControllerWithAnnotation(t,
+		spec.AnnotationObject{spec.AnnotationKeyHooksParallel: `{"createRuntime":[[1,0]]}`},
+		map[string]error{"/bin/hook1": errHookFailed},
+	)
+	hooks := []spec.HookObject{{Path: "/bin/hook0"}, {Path: "/bin/hook1"}, {Path: "/bin/hook2"}}
+
+	// == act ==
+	err := controller.RunCreateRuntimeHooks("111111", hooks)
+
+	// == assert ==
+	assert.EqualError(t, err, "hook createRuntime[1] failed: exit status 1")
+	assert.ElementsMatch(t, []string{"/bin/hook0", "/bin/hook1"}, factory.names)
+}
+
+func TestParallelGroups_Plan(t *testing.T) {
+	// == arrange ==
+	groups, err := parseParallelGroups(`{"poststart":[[4,3],[0,1]]}`)
+	assert.Nil(t, err)
+
+	// == act ==
+	plan, planErr := groups.plan("poststart", 5)
+	other, otherErr := groups.plan("poststop", 2)
+
+	// == assert ==
+	assert.Nil(t, planErr)
+	assert.Nil(t, otherErr)
+	assert.Equal(t, [][]int{{0, 1}, {2}, {3, 4}}, plan)
+	assert.Equal(t, [][]int{{0}, {1}}, other)
+}
+
+func TestParallelGroups_PlanInvalidIndex(t *testing.T) {
+	// == arrange ==
+	groups, err := parseParallelGroups(`{"poststart":[[0,1],[1]]}`)
+	assert.Nil(t, err)
+
+	// == act ==
+	_, dupErr := groups.plan("poststart", 2)
+	_, rangeErr := groups.plan("poststart", 1)
+
+	// == assert ==
+	assert.NotNil(t, dupErr)
+	assert.NotNil(t, rangeErr)
+}
+
+// runTimedOutHook runs script with sh under a timeout of one second, using
+// the real command factory, and returns the recorded result, the audit
+// record of the hook and the time the phase took.
+func runTimedOutHook(t *testing.T, script string) (HookRunResult, logs.HookResult, time.Duration) {
+	t.Helper()
+	controller, _ := newTestHookController(t, "", nil)
+	controller.commandFactory = utils.NewCommandFactory()
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	auditLogger, err := logs.OpenFileLogger(auditPath, 0)
+	assert.Nil(t, err)
+	logs.AuditLogger = auditLogger
+	t.Cleanup(func() {
+		logs.AuditLogger = nil
+		_ = auditLogger.Close()
+	})
+	timeout := 1
+	hooks := []spec.HookObject{{Path: "/bin/sh", Args: []string{"-c", script}, Timeout: &timeout}}
+
+	start := time.Now()
+	err = controller.RunPoststartHooks("111111", hooks)
+	elapsed := time.Since(start)
+	assert.Nil(t, err)
+
+	results, err := ReadHookResults("111111")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	data, err := os.ReadFile(auditPath)
+	assert.Nil(t, err)
+	var rec struct {
+		Hook logs.HookResult `json:"hook"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &rec))
+	return results[0], rec.Hook, elapsed
+}
+
+// readPidFile reads the pid a hook wrote to path.
+func readPidFile(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	assert.Nil(t, err)
+	return pid
+}
+
+// processGone reports whether pid has exited; a zombie that its new parent
+// has not reaped yet counts as exited.
+func processGone(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+func TestRunPoststartHooks_TimeoutKillsProcessGroup(t *testing.T) {
+	// == arrange ==
+	pidFile := filepath.Join(t.TempDir(), "pidfile")
+
+	// == act ==
+	result, rec, elapsed := runTimedOutHook(t, "sleep 30 & echo $! > "+pidFile+"; sleep 30")
+
+	// == assert ==
+	assert.GreaterOrEqual(t, elapsed, time.Second)
+	assert.Less(t, elapsed, 3*time.Second)
+	assert.True(t, result.TimedOut)
+	assert.Equal(t, "warn", result.Result)
+	assert.Equal(t, "timed out after 1s", result.Error)
+	assert.True(t, rec.TimedOut)
+	assert.Equal(t, int64(1000), rec.TimeoutMS)
+	// the grandchild in the process group of the hook is killed as well
+	grandchild := readPidFile(t, pidFile)
+	assert.Eventually(t, func() bool { return processGone(grandchild) }, time.Second, 10*time.Millisecond)
+}
+
+func TestRunPoststartHooks_TimeoutGracePeriod(t *testing.T) {
+	// == arrange ==
+	// the grandchild leaves the process group and keeps stderr open, so
+	// the hook is only waited for during the grace period
+	pidFile := filepath.Join(t.TempDir(), "pidfile")
+
+	// == act ==
+	result, _, elapsed := runTimedOutHook(t, "setsid sleep 30 & echo $! > "+pidFile+"; sleep 30")
+	escaped := readPidFile(t, pidFile)
+	_ = syscall.Kill(escaped, syscall.SIGKILL)
+
+	// == assert ==
+	assert.GreaterOrEqual(t, elapsed, time.Second+hookKillGracePeriod)
+	assert.Less(t, elapsed, 2*time.Second+hookKillGracePeriod)
+	assert.True(t, result.TimedOut)
+}
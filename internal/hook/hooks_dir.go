@@ -0,0 +1,245 @@
+package hook
+
+import (
+	"droplet/internal/spec"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// hooksDirVersion is the supported version of the oci-hooks.d format.
+const hooksDirVersion = "1.0.0"
+
+// HookConfig is a single hook definition in the hooks directory.
+//
+// The format follows oci-hooks(5):
+//
+//	{
+//	  "version": "1.0.0",
+//	  "hook": {"path": "/usr/libexec/hook", "args": ["hook", "arg"]},
+//	  "when": {"annotations": {"^io\\.example\\.gpu$": "true"}},
+//	  "stages": ["createRuntime", "poststop"]
+//	}
+type HookConfig struct {
+	Version string          `json:"version"`
+	Hook    spec.HookObject `json:"hook"`
+	When    HookWhen        `json:"when"`
+	Stages  []string        `json:"stages"`
+}
+
+// HookWhen describes the conditions under which a hook is injected.
+//
+// All conditions that are set must match. Annotation keys and values
+// and command entries are regular expressions.
+type HookWhen struct {
+	Always        *bool             `json:"always,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+	Commands      []string          `json:"commands,omitempty"`
+	HasBindMounts *bool             `json:"hasBindMounts,omitempty"`
+}
+
+// MergedHook is a hook injected from the hooks directory.
+type MergedHook struct {
+	Source string          `json:"source"`
+	Stage  string          `json:"stage"`
+	Hook   spec.HookObject `json:"hook"`
+}
+
+// hooksDirEntry is a hook definition together with the file it was read from.
+type hooksDirEntry struct {
+	path   string
+	config HookConfig
+}
+
+// loadHooksDir reads every *.json file in dir, sorted by file name.
+//
+// A missing directory is not an error and yields no hooks.
+func loadHooksDir(dir string) ([]hooksDirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	var loaded []hooksDirEntry
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var config HookConfig
+		if err := json.Unmarshal(b, &config); err != nil {
+			return nil, fmt.Errorf("hooks.d: %s: %w", path, err)
+		}
+		if err := config.validate(); err != nil {
+			return nil, fmt.Errorf("hooks.d: %s: %w", path, err)
+		}
+		loaded = append(loaded, hooksDirEntry{path: path, config: config})
+	}
+	return loaded, nil
+}
+
+// MergeHooksDir evaluates the hooks directory against the spec and returns
+// the hooks to inject, in file name order. The spec itself is not modified;
+// use ApplyMergedHooks to merge the result.
+func MergeHooksDir(dir string, s spec.Spec) ([]MergedHook, error) {
+	loaded, err := loadHooksDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []MergedHook
+	for _, entry := range loaded {
+		match, err := entry.config.When.match(s)
+		if err != nil {
+			return nil, fmt.Errorf("hooks.d: %s: %w", entry.path, err)
+		}
+		if !match {
+			continue
+		}
+		for _, stage := range entry.config.Stages {
+			merged = append(merged, MergedHook{
+				Source: entry.path,
+				Stage:  stage,
+				Hook:   entry.config.Hook,
+			})
+		}
+	}
+	return merged, nil
+}
+
+// ApplyMergedHooks appends the merged hooks to the matching stages of
+// the spec's hook lifecycle, after the hooks defined in config.json.
+//
+// Droplet does not run the deprecated prestart stage. The OCI runtime
+// spec calls prestart hooks at the same point and in the same namespace
+// as createRuntime hooks, so they are run as createRuntime hooks.
+func ApplyMergedHooks(s *spec.Spec, merged []MergedHook) {
+	for _, m := range merged {
+		switch m.Stage {
+		case "prestart", "createRuntime":
+			s.Hooks.CreateRuntime = append(s.Hooks.CreateRuntime, m.Hook)
+		case "createContainer":
+			s.Hooks.CreateContainer = append(s.Hooks.CreateContainer, m.Hook)
+		case "startContainer":
+			s.Hooks.StartContainer = append(s.Hooks.StartContainer, m.Hook)
+		case "poststart":
+			s.Hooks.Poststart = append(s.Hooks.Poststart, m.Hook)
+		case "stopContainer":
+			s.Hooks.StopContainer = append(s.Hooks.StopContainer, m.Hook)
+		case "poststop":
+			s.Hooks.Poststop = append(s.Hooks.Poststop, m.Hook)
+		}
+	}
+}
+
+func (c HookConfig) validate() error {
+	if c.Version != hooksDirVersion {
+		return fmt.Errorf("unsupported version: %q", c.Version)
+	}
+	if c.Hook.Path == "" {
+		return fmt.Errorf("hook.path is required")
+	}
+	if len(c.Stages) == 0 {
+		return fmt.Errorf("stages is required")
+	}
+	for _, stage := range c.Stages {
+		switch stage {
+		case "prestart", "createRuntime", "createContainer", "startContainer",
+			"poststart", "stopContainer", "poststop":
+		default:
+			return fmt.Errorf("unknown stage: %s", stage)
+		}
+	}
+	w := c.When
+	if w.Always == nil && w.HasBindMounts == nil && len(w.Annotations) == 0 && len(w.Commands) == 0 {
+		return fmt.Errorf("when requires at least one condition")
+	}
+	return nil
+}
+
+// match reports whether every condition that is set matches the spec.
+func (w HookWhen) match(s spec.Spec) (bool, error) {
+	if w.Always != nil && !*w.Always {
+		return false, nil
+	}
+
+	if w.HasBindMounts != nil && *w.HasBindMounts != hasBindMounts(s.Mounts) {
+		return false, nil
+	}
+
+	if len(w.Annotations) > 0 {
+		for keyPattern, valuePattern := range w.Annotations {
+			keyRe, err := regexp.Compile(keyPattern)
+			if err != nil {
+				return false, err
+			}
+			valueRe, err := regexp.Compile(valuePattern)
+			if err != nil {
+				return false, err
+			}
+			found := false
+			for key, value := range s.Annotations {
+				if keyRe.MatchString(key) && valueRe.MatchString(value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false, nil
+			}
+		}
+	}
+
+	if len(w.Commands) > 0 {
+		if len(s.Process.Args) == 0 {
+			return false, nil
+		}
+		found := false
+		for _, pattern := range w.Commands {
+			matched, err := regexp.MatchString(pattern, s.Process.Args[0])
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func hasBindMounts(mounts []spec.MountObject) bool {
+	for _, m := range mounts {
+		if m.Type == "bind" {
+			return true
+		}
+		for _, opt := range m.Options {
+			if opt == "bind" || opt == "rbind" {
+				return true
+			}
+		}
+	}
+	return false
+}
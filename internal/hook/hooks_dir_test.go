@@ -0,0 +1,122 @@
+package hook
+
+import (
+	"droplet/internal/spec"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeHookConfig(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestMergeHooksDir_AlwaysAndOrder(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	writeHookConfig(t, dir, "20-log.json", `{"version":"1.0.0","hook":{"path":"/bin/log"},"when":{"always":true},"stages":["poststop"]}`)
+	writeHookConfig(t, dir, "10-net.json", `{"version":"1.0.0","hook":{"path":"/bin/net"},"when":{"always":true},"stages":["createRuntime","poststop"]}`)
+	writeHookConfig(t, dir, "README", `not a hook`)
+
+	// == act ==
+	merged, err := MergeHooksDir(dir, spec.Spec{})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(merged))
+	assert.Equal(t, "createRuntime", merged[0].Stage)
+	assert.Equal(t, "/bin/net", merged[1].Hook.Path)
+	assert.Equal(t, "/bin/log", merged[2].Hook.Path)
+	assert.Equal(t, filepath.Join(dir, "20-log.json"), merged[2].Source)
+}
+
+func TestMergeHooksDir_AnnotationMatcher(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	writeHookConfig(t, dir, "net.json", `{"version":"1.0.0","hook":{"path":"/bin/net"},"when":{"annotations":{"^io\\.raind\\.net\\.config$":"bridge"}},"stages":["createRuntime"]}`)
+	matched := spec.Spec{Annotations: spec.AnnotationObject{spec.AnnotationKeyNet: `{"bridge":"raind0"}`}}
+	unmatched := spec.Spec{}
+
+	// == act ==
+	mergedMatched, errMatched := MergeHooksDir(dir, matched)
+	mergedUnmatched, errUnmatched := MergeHooksDir(dir, unmatched)
+
+	// == assert ==
+	assert.Nil(t, errMatched)
+	assert.Nil(t, errUnmatched)
+	assert.Equal(t, 1, len(mergedMatched))
+	assert.Equal(t, 0, len(mergedUnmatched))
+}
+
+func TestMergeHooksDir_CommandsAndBindMounts(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	writeHookConfig(t, dir, "sh.json", `{"version":"1.0.0","hook":{"path":"/bin/h"},"when":{"commands":["^/bin/(ba)?sh$"],"hasBindMounts":true},"stages":["poststart"]}`)
+	s := spec.Spec{
+		Process: spec.ProcessObject{Args: []string{"/bin/sh"}},
+		Mounts:  []spec.MountObject{{Destination: "/data", Source: "/srv", Options: []string{"rbind"}}},
+	}
+	noBind := spec.Spec{Process: spec.ProcessObject{Args: []string{"/bin/sh"}}}
+
+	// == act ==
+	merged, err := MergeHooksDir(dir, s)
+	mergedNoBind, errNoBind := MergeHooksDir(dir, noBind)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Nil(t, errNoBind)
+	assert.Equal(t, 1, len(merged))
+	assert.Equal(t, 0, len(mergedNoBind))
+}
+
+func TestMergeHooksDir_MissingDir(t *testing.T) {
+	// == arrange ==
+	dir := filepath.Join(t.TempDir(), "not-exist")
+
+	// == act ==
+	merged, err := MergeHooksDir(dir, spec.Spec{})
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Nil(t, merged)
+}
+
+func TestMergeHooksDir_InvalidConfig(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	writeHookConfig(t, dir, "bad.json", `{"version":"1.0.0","hook":{"path":"/bin/h"},"when":{},"stages":["poststart"]}`)
+
+	// == act ==
+	_, err := MergeHooksDir(dir, spec.Spec{})
+
+	// == assert ==
+	assert.NotNil(t, err)
+}
+
+func TestApplyMergedHooks_AppendsAfterConfig(t *testing.T) {
+	// == arrange ==
+	s := spec.Spec{Hooks: spec.HookLifecycleObject{Poststop: []spec.HookObject{{Path: "/bin/config"}}}}
+	merged := []MergedHook{{Stage: "poststop", Hook: spec.HookObject{Path: "/bin/merged"}}}
+
+	// == act ==
+	ApplyMergedHooks(&s, merged)
+
+	// == assert ==
+	assert.Equal(t, []spec.HookObject{{Path: "/bin/config"}, {Path: "/bin/merged"}}, s.Hooks.Poststop)
+}
+
+func TestApplyMergedHooks_PrestartRunsAsCreateRuntime(t *testing.T) {
+	// == arrange ==
+	s := spec.Spec{Hooks: spec.HookLifecycleObject{CreateRuntime: []spec.HookObject{{Path: "/bin/config"}}}}
+	merged := []MergedHook{{Stage: "prestart", Hook: spec.HookObject{Path: "/bin/merged"}}}
+
+	// == act ==
+	ApplyMergedHooks(&s, merged)
+
+	// == assert ==
+	assert.Equal(t, []spec.HookObject{{Path: "/bin/config"}, {Path: "/bin/merged"}}, s.Hooks.CreateRuntime)
+	assert.Empty(t, s.Hooks.Prestart)
+}
@@ -0,0 +1,99 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// FailurePolicy decides what happens when a hook exits with an error.
+type FailurePolicy string
+
+const (
+	// FailureAbort stops the hook list and returns the error to the caller.
+	FailureAbort FailurePolicy = "abort"
+	// FailureWarn prints a warning and continues with the next hook.
+	FailureWarn FailurePolicy = "warn"
+	// FailureIgnore continues with the next hook without a warning.
+	FailureIgnore FailurePolicy = "ignore"
+)
+
+// defaultFailurePolicy returns the OCI behavior for the given phase.
+//
+// Failures of createRuntime, createContainer and startContainer hooks
+// abort the lifecycle. Hooks that run after the container has started or
+// stopped cannot undo anything, so their failures are only reported.
+func defaultFailurePolicy(phase string) FailurePolicy {
+	switch phase {
+	case "createRuntime", "createContainer", "startContainer":
+		return FailureAbort
+	default:
+		return FailureWarn
+	}
+}
+
+// hookKeyPattern matches "<phase>" or "<phase>[<index>]".
+var hookKeyPattern = regexp.MustCompile(`^([A-Za-z]+)(?:\[(\d+)\])?$`)
+
+// failurePolicies holds the per-hook overrides parsed from the
+// io.raind.hooks.onFailure annotation.
+//
+// The annotation value is a JSON object whose keys are either a phase
+// name (applies to every hook in the phase) or "<phase>[<index>]"
+// (applies to a single hook), e.g.
+//
+//	{"poststart": "abort", "createRuntime[1]": "ignore"}
+type failurePolicies struct {
+	phase map[string]FailurePolicy
+	hook  map[string]FailurePolicy
+}
+
+// parseFailurePolicies parses the io.raind.hooks.onFailure annotation.
+// An empty annotation yields no overrides.
+func parseFailurePolicies(annotation string) (failurePolicies, error) {
+	policies := failurePolicies{
+		phase: map[string]FailurePolicy{},
+		hook:  map[string]FailurePolicy{},
+	}
+	if annotation == "" {
+		return policies, nil
+	}
+
+	var raw map[string]string
+	if err := json.Unmarshal([]byte(annotation), &raw); err != nil {
+		return policies, fmt.Errorf("invalid hook failure policy annotation: %w", err)
+	}
+	for key, value := range raw {
+		policy := FailurePolicy(value)
+		switch policy {
+		case FailureAbort, FailureWarn, FailureIgnore:
+		default:
+			return policies, fmt.Errorf("invalid hook failure policy %q for %s", value, key)
+		}
+
+		m := hookKeyPattern.FindStringSubmatch(key)
+		if m == nil {
+			return policies, fmt.Errorf("invalid hook failure policy key: %s", key)
+		}
+		if m[2] == "" {
+			policies.phase[m[1]] = policy
+		} else {
+			policies.hook[key] = policy
+		}
+	}
+	return policies, nil
+}
+
+// lookup returns the policy for the index-th hook of the phase.
+// A per-hook override wins over a per-phase override, which wins over
+// the OCI default.
+func (p failurePolicies) lookup(phase string, index int) FailurePolicy {
+	if policy, ok := p.hook[phase+"["+strconv.Itoa(index)+"]"]; ok {
+		return policy
+	}
+	if policy, ok := p.phase[phase]; ok {
+		return policy
+	}
+	return defaultFailurePolicy(phase)
+}
@@ -0,0 +1,82 @@
+package hook
+
+import (
+	"droplet/internal/utils"
+	"os"
+	"sort"
+	"time"
+)
+
+// HookRunResult is the result of the last run of a single hook, shown by
+// the `hooks` command.
+type HookRunResult struct {
+	Phase      string    `json:"phase"`
+	Index      int       `json:"index"`
+	Path       string    `json:"path"`
+	Result     string    `json:"result"`
+	ExitCode   int       `json:"exitCode"`
+	TimedOut   bool      `json:"timedOut,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMS int64     `json:"durationMs"`
+	Log        string    `json:"log"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// phase order used to sort the results
+var phaseOrder = map[string]int{
+	"createRuntime":   0,
+	"createContainer": 1,
+	"startContainer":  2,
+	"poststart":       3,
+	"stopContainer":   4,
+	"poststop":        5,
+}
+
+// ReadHookResults returns the results of the last run of each hook of
+// the container, ordered by phase and index. A container whose hooks have
+// never run has no results.
+func ReadHookResults(containerId string) ([]HookRunResult, error) {
+	var results []HookRunResult
+	if err := utils.ReadJsonFile(utils.HookResultsPath(containerId), &results); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return results, nil
+}
+
+// writeHookResults replaces the results of a phase with the given ones.
+//
+// The read-modify-write holds the state lock of the container, as phases
+// of concurrent lifecycle commands may finish at the same time, and the
+// file is replaced atomically so that readers never see a partial file.
+func writeHookResults(containerId string, phase string, phaseResults []HookRunResult) error {
+	lock, err := utils.LockFile(utils.ContainerStateLockPath(containerId))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	current, err := ReadHookResults(containerId)
+	if err != nil {
+		// a corrupted file only loses the history
+		current = nil
+	}
+
+	var results []HookRunResult
+	for _, r := range current {
+		if r.Phase != phase {
+			results = append(results, r)
+		}
+	}
+	results = append(results, phaseResults...)
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Phase != results[j].Phase {
+			return phaseOrder[results[i].Phase] < phaseOrder[results[j].Phase]
+		}
+		return results[i].Index < results[j].Index
+	})
+
+	return utils.WriteJsonFileAtomic(utils.HookResultsPath(containerId), results)
+}
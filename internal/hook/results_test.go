@@ -0,0 +1,38 @@
+package hook
+
+import (
+	"droplet/internal/utils"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteHookResults_ConcurrentPhases(t *testing.T) {
+	// == arrange ==
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	assert.Nil(t, os.MkdirAll(utils.HookLogDir("c1"), 0755))
+	phases := []string{"createRuntime", "createContainer", "startContainer", "poststart", "stopContainer", "poststop"}
+
+	// == act ==
+	var wg sync.WaitGroup
+	for _, phase := range phases {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, writeHookResults("c1", phase, []HookRunResult{{Phase: phase, Result: "success"}}))
+		}()
+	}
+	wg.Wait()
+
+	// == assert ==
+	// no phase overwrote the results of another
+	results, err := ReadHookResults("c1")
+	assert.Nil(t, err)
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Phase)
+	}
+	assert.Equal(t, phases, got)
+}
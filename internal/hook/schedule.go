@@ -0,0 +1,67 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// parallelGroups holds the parallel groups parsed from the
+// io.raind.hooks.parallel annotation.
+//
+// The annotation value is a JSON object keyed by phase whose values are
+// lists of hook index groups. Hooks in the same group run concurrently;
+// groups and ungrouped hooks run in hook list order, e.g.
+//
+//	{"poststart": [[0, 1], [3, 4]]}
+//
+// runs poststart[0] and [1] together, then [2], then [3] and [4] together.
+type parallelGroups map[string][][]int
+
+// parseParallelGroups parses the io.raind.hooks.parallel annotation.
+// An empty annotation yields no groups.
+func parseParallelGroups(annotation string) (parallelGroups, error) {
+	groups := parallelGroups{}
+	if annotation == "" {
+		return groups, nil
+	}
+	if err := json.Unmarshal([]byte(annotation), &groups); err != nil {
+		return nil, fmt.Errorf("invalid hook parallel annotation: %w", err)
+	}
+	return groups, nil
+}
+
+// plan returns the execution order of a phase with n hooks as a list of
+// index groups. Each group is started once the previous group has exited.
+func (p parallelGroups) plan(phase string, n int) ([][]int, error) {
+	groupOf := map[int]int{}
+	for gi, group := range p[phase] {
+		for _, index := range group {
+			if index < 0 || index >= n {
+				return nil, fmt.Errorf("hook parallel group %s: index %d out of range", phase, index)
+			}
+			if _, ok := groupOf[index]; ok {
+				return nil, fmt.Errorf("hook parallel group %s: index %d listed twice", phase, index)
+			}
+			groupOf[index] = gi
+		}
+	}
+
+	var plan [][]int
+	started := map[int]bool{}
+	for i := 0; i < n; i++ {
+		gi, ok := groupOf[i]
+		if !ok {
+			plan = append(plan, []int{i})
+			continue
+		}
+		if started[gi] {
+			continue
+		}
+		started[gi] = true
+		group := append([]int{}, p[phase][gi]...)
+		sort.Ints(group)
+		plan = append(plan, group)
+	}
+	return plan, nil
+}
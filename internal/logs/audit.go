@@ -2,6 +2,7 @@ package logs
 
 import (
 	"droplet/internal/spec"
+	"droplet/internal/status"
 	"droplet/internal/utils"
 	"log"
 	"time"
@@ -9,30 +10,47 @@ import (
 
 type AuditRecord struct {
 	ContainerId string
+	// Bundle is the bundle directory of the container; if empty, it is
+	// read from state.json
+	Bundle      string
 	Event       string
 	Stage       string
 	Pid         int
 	Command     *[]string
 	Signals     *[]string
 	Spec        *spec.Spec
+	MergedHooks []MergedHook
+	Removed     []string
 	Result      string
 	Error       error
 }
 
 func RecordAuditLog(auditRecord AuditRecord) error {
+	bundle := auditRecord.Bundle
+	if bundle == "" {
+		bundle, _ = status.NewStatusHandler().GetBundleFromId(auditRecord.ContainerId)
+	}
+	var configPath string
+	if bundle != "" {
+		configPath = utils.BundleConfigFilePath(bundle)
+	}
+
 	rec := &Record{
 		TS:          time.Now(),
-		LogVersion:  "0.1.0",
+		LogVersion:  AuditLogVersion,
 		Event:       auditRecord.Event,
 		Runtime:     "droplet",
 		RuntimeVer:  "0.1.0",
 		ContainerId: auditRecord.ContainerId,
 
-		Bundle:     utils.ContainerDir(auditRecord.ContainerId),
-		ConfigPath: utils.ConfigFilePath(auditRecord.ContainerId),
+		Bundle:     bundle,
+		ConfigPath: configPath,
 		StatePath:  utils.ContainerStatePath(auditRecord.ContainerId),
 		Pid:        auditRecord.Pid,
 
+		MergedHooks: auditRecord.MergedHooks,
+		Removed:     auditRecord.Removed,
+
 		Result: auditRecord.Result,
 	}
 
@@ -51,7 +69,9 @@ func RecordAuditLog(auditRecord AuditRecord) error {
 	}
 
 	if auditRecord.Spec != nil {
-		rec.Oci.ProcessArg0 = auditRecord.Spec.Process.Args[0]
+		if len(auditRecord.Spec.Process.Args) > 0 {
+			rec.Oci.ProcessArg0 = auditRecord.Spec.Process.Args[0]
+		}
 		rec.Namespaces = mapNamespace(auditRecord.Spec.LinuxSpec)
 		rec.Capabilities = &CapsInfo{
 			Bounding:    auditRecord.Spec.Process.Capabilities.Bounding,
@@ -60,8 +80,10 @@ func RecordAuditLog(auditRecord AuditRecord) error {
 			Inheritable: auditRecord.Spec.Process.Capabilities.Inheritable,
 			Ambient:     auditRecord.Spec.Process.Capabilities.Ambient,
 		}
-		rec.Seccomp = &SeccompInfo{
-			DefaultAction: auditRecord.Spec.LinuxSpec.Seccomp.DefaultAction,
+		if auditRecord.Spec.LinuxSpec.Seccomp != nil {
+			rec.Seccomp = &SeccompInfo{
+				DefaultAction: auditRecord.Spec.LinuxSpec.Seccomp.DefaultAction,
+			}
 		}
 		rec.LSM = &LsmInfo{
 			AppArmor: &AppArmorInfo{
@@ -79,7 +101,7 @@ func RecordAuditLog(auditRecord AuditRecord) error {
 	}
 
 	if err := AuditLogger.WriteRecord(rec); err != nil {
-		log.Printf("audit log write failed: %v", err)
+		log.Printf("warning: audit log write failed: %v", err)
 	}
 
 	return nil
@@ -95,7 +117,7 @@ type AuditHookRecord struct {
 func RecordHookAuditLog(auditHookRecord AuditHookRecord) error {
 	rec := &Record{
 		TS:          time.Now(),
-		LogVersion:  "0.1.0",
+		LogVersion:  AuditLogVersion,
 		Event:       auditHookRecord.Event,
 		Runtime:     "droplet",
 		RuntimeVer:  "0.1.0",
@@ -107,7 +129,7 @@ func RecordHookAuditLog(auditHookRecord AuditHookRecord) error {
 	}
 
 	if err := AuditLogger.WriteRecord(rec); err != nil {
-		log.Printf("audit log write failed: %v", err)
+		log.Printf("warning: audit log write failed: %v", err)
 	}
 
 	return nil
@@ -0,0 +1,383 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ConsoleLogFormat is the on-disk format of the container output logs.
+type ConsoleLogFormat string
+
+const (
+	// ConsoleLogRaw writes the output as-is.
+	ConsoleLogRaw ConsoleLogFormat = "raw"
+	// ConsoleLogJSON writes one JSON object per line, like the docker
+	// json-file driver: {"time":...,"stream":...,"log":...}.
+	ConsoleLogJSON ConsoleLogFormat = "json"
+	// ConsoleLogCRI writes the CRI log format:
+	// "<RFC3339Nano time> <stream> <F|P> <content>".
+	ConsoleLogCRI ConsoleLogFormat = "cri"
+)
+
+// output streams
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// ConsoleLogConfig configures a ConsoleLog. A MaxSize of 0 disables
+// rotation.
+type ConsoleLogConfig struct {
+	Format   ConsoleLogFormat
+	MaxSize  int64 // rotate once the file would exceed this many bytes
+	MaxFiles int   // number of files kept, including the current one
+}
+
+// ConsoleLogEntry is a line of the json format.
+type ConsoleLogEntry struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Log    string    `json:"log"`
+}
+
+// ParseConsoleLogConfig parses the io.raind.log.* annotations. Empty values
+// select the raw format without rotation.
+func ParseConsoleLogConfig(format, maxSize, maxFiles string) (ConsoleLogConfig, error) {
+	cfg := ConsoleLogConfig{Format: ConsoleLogRaw, MaxFiles: 1}
+
+	switch f := ConsoleLogFormat(format); f {
+	case "":
+	case ConsoleLogRaw, ConsoleLogJSON, ConsoleLogCRI:
+		cfg.Format = f
+	default:
+		return ConsoleLogConfig{}, fmt.Errorf("unknown log format: %q", format)
+	}
+
+	if maxSize != "" {
+		size, err := parseByteSize(maxSize)
+		if err != nil {
+			return ConsoleLogConfig{}, err
+		}
+		cfg.MaxSize = size
+	}
+
+	if maxFiles != "" {
+		n, err := strconv.Atoi(maxFiles)
+		if err != nil || n < 1 {
+			return ConsoleLogConfig{}, fmt.Errorf("invalid log max files: %q", maxFiles)
+		}
+		cfg.MaxFiles = n
+	}
+	return cfg, nil
+}
+
+// parseByteSize parses a size such as "1048576", "512k", "10m" or "1g".
+func parseByteSize(value string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	s = strings.TrimSuffix(s, "b")
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		unit, s = 1024, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		unit, s = 1024*1024, strings.TrimSuffix(s, "m")
+	case strings.HasSuffix(s, "g"):
+		unit, s = 1024*1024*1024, strings.TrimSuffix(s, "g")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid log max size: %q", value)
+	}
+	return n * unit, nil
+}
+
+// RotatedLogPath returns the path of the n-th rotated file of path; 0 is
+// the current file.
+func RotatedLogPath(path string, n int) string {
+	if n == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// ConsoleLog writes container output to a log file in the configured
+// format, rotating it by size.
+//
+// Several ConsoleLogs may write to the same path, e.g. the exec sessions of
+// a container sharing exec_console.log: each write and rotation is made
+// under an flock on the log file, and a writer whose file was rotated by
+// another one reopens the path before writing.
+type ConsoleLog struct {
+	mu   sync.Mutex
+	path string
+	cfg  ConsoleLogConfig
+	f    *os.File
+	now  func() time.Time
+}
+
+// OpenConsoleLog opens path for appending.
+func OpenConsoleLog(path string, cfg ConsoleLogConfig) (*ConsoleLog, error) {
+	if cfg.Format == "" {
+		cfg.Format = ConsoleLogRaw
+	}
+	if cfg.MaxFiles < 1 {
+		cfg.MaxFiles = 1
+	}
+	l := &ConsoleLog{path: path, cfg: cfg, now: time.Now}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *ConsoleLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|unix.O_NOFOLLOW, 0640)
+	if err != nil {
+		return err
+	}
+	l.f = f
+	return nil
+}
+
+// lock takes the flock of the current log file. A file that is no longer
+// at the path, because another writer rotated it, is replaced by the file
+// at the path first. l.mu must be held.
+func (l *ConsoleLog) lock() error {
+	for {
+		if err := flock(l.f, unix.LOCK_EX); err != nil {
+			return err
+		}
+		st, err := l.f.Stat()
+		if err != nil {
+			_ = flock(l.f, unix.LOCK_UN)
+			return err
+		}
+		if cur, err := os.Lstat(l.path); err == nil && os.SameFile(st, cur) {
+			return nil
+		}
+		// closing the file drops its flock
+		_ = l.f.Close()
+		l.f = nil
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+}
+
+func flock(f *os.File, how int) error {
+	for {
+		err := unix.Flock(int(f.Fd()), how)
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
+
+// Reopen closes and reopens the log file, e.g. after it was moved away by
+// an external log rotation.
+func (l *ConsoleLog) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		_ = l.f.Close()
+		l.f = nil
+	}
+	return l.open()
+}
+
+func (l *ConsoleLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Stream returns a writer that records its input as the given stream.
+func (l *ConsoleLog) Stream(stream string) io.Writer {
+	return &consoleStream{log: l, stream: stream}
+}
+
+type consoleStream struct {
+	log    *ConsoleLog
+	stream string
+}
+
+func (s *consoleStream) Write(p []byte) (int, error) {
+	if err := s.log.WriteStream(s.stream, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteStream records p as output of stream.
+func (l *ConsoleLog) WriteStream(stream string, p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+	data, err := l.encode(stream, p)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return fmt.Errorf("console log closed")
+	}
+	if err := l.lock(); err != nil {
+		return err
+	}
+	if l.cfg.MaxSize > 0 {
+		// the size of the file, which the other writers append to as well
+		st, err := l.f.Stat()
+		if err != nil {
+			_ = flock(l.f, unix.LOCK_UN)
+			return err
+		}
+		if st.Size() > 0 && st.Size()+int64(len(data)) > l.cfg.MaxSize {
+			if err := l.rotate(); err != nil {
+				return err
+			}
+			if err := l.lock(); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = l.f.Write(data)
+	_ = flock(l.f, unix.LOCK_UN)
+	return err
+}
+
+// encode formats p. The json and cri formats emit one entry per line; a
+// trailing incomplete line is emitted at once (as a "P" partial entry in
+// cri) rather than buffered.
+func (l *ConsoleLog) encode(stream string, p []byte) ([]byte, error) {
+	if l.cfg.Format == ConsoleLogRaw {
+		return p, nil
+	}
+
+	ts := l.now().UTC()
+	var buf bytes.Buffer
+	for len(p) > 0 {
+		line := p
+		complete := false
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line, complete = p[:i+1], true
+		}
+		p = p[len(line):]
+
+		switch l.cfg.Format {
+		case ConsoleLogJSON:
+			b, err := json.Marshal(ConsoleLogEntry{Time: ts, Stream: stream, Log: string(line)})
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(b)
+			buf.WriteByte('\n')
+		case ConsoleLogCRI:
+			tag := "P"
+			if complete {
+				tag = "F"
+				line = line[:len(line)-1]
+			}
+			buf.WriteString(ts.Format(time.RFC3339Nano))
+			buf.WriteByte(' ')
+			buf.WriteString(stream)
+			buf.WriteByte(' ')
+			buf.WriteString(tag)
+			buf.WriteByte(' ')
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// rotate shifts path.N-1 -> path.N ... path -> path.1, dropping the files
+// beyond MaxFiles, and starts a new file. l.mu and the flock of the current
+// file must be held; the flock is dropped with the file.
+func (l *ConsoleLog) rotate() error {
+	// the files are shifted before the flock is dropped, so that no other
+	// writer appends to the file being rotated
+	err := l.shift()
+	_ = l.f.Close()
+	l.f = nil
+	if err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *ConsoleLog) shift() error {
+	last := l.cfg.MaxFiles - 1
+	if last == 0 {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	_ = os.Remove(RotatedLogPath(l.path, last))
+	for i := last - 1; i >= 0; i-- {
+		err := os.Rename(RotatedLogPath(l.path, i), RotatedLogPath(l.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseConsoleLogLine parses a line of a console log, including its
+// trailing newline if it has one. A raw line is returned as stdout output
+// with no time. Partial reports that the output line continues in the next
+// entry of the stream: a cri "P" entry, or a json or raw entry without a
+// trailing newline.
+func ParseConsoleLogLine(format ConsoleLogFormat, line []byte) (entry ConsoleLogEntry, partial bool, err error) {
+	if format != ConsoleLogRaw {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+	}
+	switch format {
+	case ConsoleLogJSON:
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return ConsoleLogEntry{}, false, fmt.Errorf("invalid json log line: %w", err)
+		}
+		return entry, !strings.HasSuffix(entry.Log, "\n"), nil
+	case ConsoleLogCRI:
+		fields := bytes.SplitN(line, []byte{' '}, 4)
+		if len(fields) < 3 {
+			return ConsoleLogEntry{}, false, fmt.Errorf("invalid cri log line: %q", line)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, string(fields[0]))
+		if err != nil {
+			return ConsoleLogEntry{}, false, fmt.Errorf("invalid cri log time: %w", err)
+		}
+		var content []byte
+		if len(fields) == 4 {
+			content = fields[3]
+		}
+		entry = ConsoleLogEntry{Time: ts, Stream: string(fields[1])}
+		switch string(fields[2]) {
+		case "F":
+			entry.Log = string(content) + "\n"
+		case "P":
+			entry.Log, partial = string(content), true
+		default:
+			return ConsoleLogEntry{}, false, fmt.Errorf("invalid cri log tag: %q", fields[2])
+		}
+		return entry, partial, nil
+	default:
+		return ConsoleLogEntry{Stream: StreamStdout, Log: string(line)}, !bytes.HasSuffix(line, []byte{'\n'}), nil
+	}
+}
@@ -0,0 +1,180 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixedNow() time.Time {
+	return time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+}
+
+func TestParseConsoleLogConfig(t *testing.T) {
+	// == act ==
+	def, defErr := ParseConsoleLogConfig("", "", "")
+	cfg, cfgErr := ParseConsoleLogConfig("cri", "10m", "3")
+	_, formatErr := ParseConsoleLogConfig("syslog", "", "")
+	_, sizeErr := ParseConsoleLogConfig("", "ten", "")
+	_, filesErr := ParseConsoleLogConfig("", "", "0")
+
+	// == assert ==
+	assert.Nil(t, defErr)
+	assert.Equal(t, ConsoleLogConfig{Format: ConsoleLogRaw, MaxFiles: 1}, def)
+	assert.Nil(t, cfgErr)
+	assert.Equal(t, ConsoleLogConfig{Format: ConsoleLogCRI, MaxSize: 10 * 1024 * 1024, MaxFiles: 3}, cfg)
+	assert.NotNil(t, formatErr)
+	assert.NotNil(t, sizeErr)
+	assert.NotNil(t, filesErr)
+}
+
+func TestConsoleLog_AppendsRaw(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "console.log")
+	assert.Nil(t, os.WriteFile(path, []byte("old\n"), 0640))
+	l, err := OpenConsoleLog(path, ConsoleLogConfig{Format: ConsoleLogRaw})
+	assert.Nil(t, err)
+
+	// == act ==
+	_, err = l.Stream(StreamStdout).Write([]byte("new\n"))
+	assert.Nil(t, l.Close())
+
+	// == assert ==
+	assert.Nil(t, err)
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "old\nnew\n", string(data))
+}
+
+func TestConsoleLog_JSON(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "console.log")
+	l, err := OpenConsoleLog(path, ConsoleLogConfig{Format: ConsoleLogJSON})
+	assert.Nil(t, err)
+	l.now = fixedNow
+
+	// == act ==
+	err = l.WriteStream(StreamStderr, []byte("a\nb"))
+	assert.Nil(t, l.Close())
+
+	// == assert ==
+	assert.Nil(t, err)
+	data, _ := os.ReadFile(path)
+	assert.Equal(t,
+		`{"time":"2026-01-02T03:04:05.000000006Z","stream":"stderr","log":"a\n"}`+"\n"+
+			`{"time":"2026-01-02T03:04:05.000000006Z","stream":"stderr","log":"b"}`+"\n",
+		string(data))
+}
+
+func TestConsoleLog_CRI(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "console.log")
+	l, err := OpenConsoleLog(path, ConsoleLogConfig{Format: ConsoleLogCRI})
+	assert.Nil(t, err)
+	l.now = fixedNow
+
+	// == act ==
+	err = l.WriteStream(StreamStdout, []byte("full\npart"))
+	assert.Nil(t, l.Close())
+
+	// == assert ==
+	assert.Nil(t, err)
+	data, _ := os.ReadFile(path)
+	assert.Equal(t,
+		"2026-01-02T03:04:05.000000006Z stdout F full\n"+
+			"2026-01-02T03:04:05.000000006Z stdout P part\n",
+		string(data))
+}
+
+func TestConsoleLog_Rotate(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "console.log")
+	l, err := OpenConsoleLog(path, ConsoleLogConfig{Format: ConsoleLogRaw, MaxSize: 4, MaxFiles: 3})
+	assert.Nil(t, err)
+
+	// == act ==
+	for _, s := range []string{"111\n", "222\n", "333\n", "444\n"} {
+		assert.Nil(t, l.WriteStream(StreamStdout, []byte(s)))
+	}
+	assert.Nil(t, l.Close())
+
+	// == assert ==
+	cur, _ := os.ReadFile(path)
+	first, _ := os.ReadFile(RotatedLogPath(path, 1))
+	second, _ := os.ReadFile(RotatedLogPath(path, 2))
+	_, err = os.Stat(RotatedLogPath(path, 3))
+	assert.Equal(t, "444\n", string(cur))
+	assert.Equal(t, "333\n", string(first))
+	assert.Equal(t, "222\n", string(second))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConsoleLog_Reopen(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "console.log")
+	l, err := OpenConsoleLog(path, ConsoleLogConfig{Format: ConsoleLogRaw})
+	assert.Nil(t, err)
+	assert.Nil(t, l.WriteStream(StreamStdout, []byte("before\n")))
+	assert.Nil(t, os.Rename(path, path+".moved"))
+
+	// == act ==
+	assert.Nil(t, l.Reopen())
+	assert.Nil(t, l.WriteStream(StreamStdout, []byte("after\n")))
+	assert.Nil(t, l.Close())
+
+	// == assert ==
+	cur, _ := os.ReadFile(path)
+	moved, _ := os.ReadFile(path + ".moved")
+	assert.Equal(t, "after\n", string(cur))
+	assert.Equal(t, "before\n", string(moved))
+}
+
+func TestConsoleLog_SharedRotate(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "exec_console.log")
+	cfg := ConsoleLogConfig{Format: ConsoleLogRaw, MaxSize: 40, MaxFiles: 100}
+	a, err := OpenConsoleLog(path, cfg)
+	assert.Nil(t, err)
+	b, err := OpenConsoleLog(path, cfg)
+	assert.Nil(t, err)
+
+	// == act ==
+	var wg sync.WaitGroup
+	for name, l := range map[string]*ConsoleLog{"a": a, "b": b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				assert.Nil(t, l.WriteStream(StreamStdout, []byte(fmt.Sprintf("%s-%02d\n", name, i))))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, a.Close())
+	assert.Nil(t, b.Close())
+
+	// == assert ==
+	// every line is kept once, and no file grows beyond MaxSize
+	var lines []string
+	for n := 0; n < cfg.MaxFiles; n++ {
+		data, err := os.ReadFile(RotatedLogPath(path, n))
+		if os.IsNotExist(err) {
+			break
+		}
+		assert.Nil(t, err)
+		assert.LessOrEqual(t, int64(len(data)), cfg.MaxSize)
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")...)
+	}
+	assert.Len(t, lines, 100)
+	sort.Strings(lines)
+	assert.Equal(t, "a-00", lines[0])
+	assert.Equal(t, "b-49", lines[99])
+	assert.Equal(t, len(lines), len(slices.Compact(lines)))
+}
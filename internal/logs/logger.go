@@ -76,6 +76,9 @@ func (l *FileLogger) Close() error {
 }
 
 func (l *FileLogger) WriteRecord(rec *Record) error {
+	if l == nil {
+		return errors.New("logger not initialized")
+	}
 	if rec == nil {
 		return errors.New("nil record")
 	}
@@ -2,6 +2,14 @@ package logs
 
 import "time"
 
+// AuditLogVersion is the schema version of Record, written as
+// log_version. Bump it when a field changes; readers must ignore fields
+// they do not know.
+//
+//	0.1.0  initial records
+//	0.2.0  removed (prune)
+const AuditLogVersion = "0.2.0"
+
 type Record struct {
 	TS          time.Time `json:"ts"`
 	LogVersion  string    `json:"log_version"`
@@ -24,6 +32,8 @@ type Record struct {
 	Seccomp      *SeccompInfo    `json:"seccomp,omitempty"`
 	LSM          *LsmInfo        `json:"lsm,omitempty"`
 	Hook         *HookResult     `json:"hook,omitempty"`
+	MergedHooks  []MergedHook    `json:"merged_hooks,omitempty"`
+	Removed      []string        `json:"removed,omitempty"`
 
 	Result string   `json:"result,omitempty"`
 	Error  *ErrInfo `json:"error,omitempty"`
@@ -79,6 +89,16 @@ type HookResult struct {
 	ExitCode   int    `json:"exit_code,omitempty"`
 	DurationMS int64  `json:"duration_ms,omitempty"`
 	StderrTail string `json:"stderr_tail,omitempty"`
+
+	TimeoutMS int64 `json:"timeout_ms,omitempty"`
+	TimedOut  bool  `json:"timed_out,omitempty"`
+}
+
+// MergedHook is a hook injected from the hooks directory.
+type MergedHook struct {
+	Source string `json:"source,omitempty"`
+	Stage  string `json:"stage,omitempty"`
+	Path   string `json:"path,omitempty"`
 }
 
 type ErrInfo struct {
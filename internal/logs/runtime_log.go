@@ -0,0 +1,111 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// runtime log format (--log-format)
+const (
+	RuntimeLogFormatText = "text"
+	RuntimeLogFormatJson = "json"
+)
+
+// SetupRuntimeLog redirects the runtime's own log output (the standard
+// logger) according to the global --log and --log-format flags.
+//
+// Messages are always mirrored to stderr as plain text so that errors stay
+// visible to interactive users; the log file receives them in the selected
+// format. With --log-format json and no --log, stderr receives JSON lines,
+// as runc does. The level of a message is taken from an "error: " or
+// "warning: " prefix; other messages are logged as info.
+func SetupRuntimeLog(path string, format string) error {
+	switch format {
+	case "", RuntimeLogFormatText:
+		format = RuntimeLogFormatText
+	case RuntimeLogFormatJson:
+		// supported
+	default:
+		return fmt.Errorf("invalid log format: %q (text|json)", format)
+	}
+
+	if path == "" {
+		if format == RuntimeLogFormatJson {
+			log.SetFlags(0)
+			log.SetOutput(&runtimeLogWriter{out: os.Stderr, format: format})
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	if format == RuntimeLogFormatJson {
+		log.SetFlags(0)
+	}
+	log.SetOutput(&runtimeLogWriter{out: f, mirror: os.Stderr, format: format})
+	return nil
+}
+
+// runtimeLogRecord is a single JSON log line (runc compatible keys).
+type runtimeLogRecord struct {
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+	Time  string `json:"time"`
+}
+
+// runtime log levels, selected by a "<level>: " prefix of the message
+const (
+	RuntimeLogLevelError   = "error"
+	RuntimeLogLevelWarning = "warning"
+	RuntimeLogLevelInfo    = "info"
+)
+
+// runtimeLogLevel returns the level of msg and msg without its level
+// prefix. A message without a prefix is informational.
+func runtimeLogLevel(msg string) (string, string) {
+	for _, level := range []string{RuntimeLogLevelError, RuntimeLogLevelWarning} {
+		if rest, ok := strings.CutPrefix(msg, level+": "); ok {
+			return level, rest
+		}
+	}
+	return RuntimeLogLevelInfo, msg
+}
+
+// runtimeLogWriter writes each log message to out in the configured format
+// and, if set, mirrors the raw message to mirror.
+type runtimeLogWriter struct {
+	out    io.Writer
+	mirror io.Writer
+	format string
+}
+
+func (w *runtimeLogWriter) Write(p []byte) (int, error) {
+	if w.mirror != nil {
+		_, _ = w.mirror.Write(p)
+	}
+
+	if w.format != RuntimeLogFormatJson {
+		return w.out.Write(p)
+	}
+
+	level, msg := runtimeLogLevel(strings.TrimRight(string(p), "\n"))
+	b, err := json.Marshal(runtimeLogRecord{
+		Level: level,
+		Msg:   msg,
+		Time:  time.Now().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.out.Write(append(b, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,63 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeLogWriter_JSONLevels(t *testing.T) {
+	tests := []struct {
+		msg       string
+		wantLevel string
+		wantMsg   string
+	}{
+		{msg: "error: container c1 does not exist\n", wantLevel: "error", wantMsg: "container c1 does not exist"},
+		{msg: "warning: audit log write failed\n", wantLevel: "warning", wantMsg: "audit log write failed"},
+		{msg: "init started pid=1\n", wantLevel: "info", wantMsg: "init started pid=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantLevel, func(t *testing.T) {
+			// == arrange ==
+			var out, mirror bytes.Buffer
+			w := &runtimeLogWriter{out: &out, mirror: &mirror, format: RuntimeLogFormatJson}
+
+			// == act ==
+			n, err := w.Write([]byte(tt.msg))
+
+			// == assert ==
+			assert.Nil(t, err)
+			assert.Equal(t, len(tt.msg), n)
+			var rec runtimeLogRecord
+			assert.Nil(t, json.Unmarshal(out.Bytes(), &rec))
+			assert.Equal(t, tt.wantLevel, rec.Level)
+			assert.Equal(t, tt.wantMsg, rec.Msg)
+			assert.NotEmpty(t, rec.Time)
+			// the mirror keeps the message as it is
+			assert.Equal(t, tt.msg, mirror.String())
+		})
+	}
+}
+
+func TestRuntimeLogWriter_Text(t *testing.T) {
+	// == arrange ==
+	var out bytes.Buffer
+	w := &runtimeLogWriter{out: &out, format: RuntimeLogFormatText}
+
+	// == act ==
+	_, err := w.Write([]byte("error: failed\n"))
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "error: failed\n", out.String())
+}
+
+func TestSetupRuntimeLog_InvalidFormat(t *testing.T) {
+	// == act ==
+	err := SetupRuntimeLog("", "yaml")
+
+	// == assert ==
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,9 @@
+// Package nsexec runs lifecycle hooks inside the namespaces of a running
+// container.
+//
+// The work is done by a C constructor (nsexec.c) that runs before the Go
+// runtime starts, since a multithreaded Go process cannot join a user or
+// mount namespace. Importing this package links the constructor into the
+// binary; it does nothing unless the process was started by the hook
+// controller as `droplet hook-exec`.
+package nsexec
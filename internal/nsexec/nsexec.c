@@ -0,0 +1,161 @@
+// nsexec runs a hook inside the namespaces of a running container.
+//
+// It is executed as a constructor, i.e. before the Go runtime starts any
+// threads, because setns(2) refuses to join a user namespace from a
+// multithreaded process and to join a mount namespace while sharing
+// filesystem attributes with other threads.
+//
+// The runtime re-executes itself as `droplet hook-exec <path> [args...]`
+// with the following environment:
+//
+//	_DROPLET_NSEXEC_PIDFD  pidfd of the container init process
+//	_DROPLET_NSEXEC_ROOTFD O_PATH fd of the init process's root directory
+//	_DROPLET_NSEXEC_FLAGS  CLONE_NEW* flags of the namespaces to join
+//
+// The exit status of the hook is propagated as the exit status of this
+// process (128+signal if the hook was killed).
+#define _GNU_SOURCE
+#include <errno.h>
+#include <fcntl.h>
+#include <grp.h>
+#include <sched.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#define ENV_PIDFD "_DROPLET_NSEXEC_PIDFD"
+#define ENV_ROOTFD "_DROPLET_NSEXEC_ROOTFD"
+#define ENV_FLAGS "_DROPLET_NSEXEC_FLAGS"
+
+extern char **environ;
+
+static void bail(const char *msg)
+{
+	fprintf(stderr, "nsexec: %s: %s\n", msg, strerror(errno));
+	_exit(127);
+}
+
+static int env_int(const char *name)
+{
+	const char *value = getenv(name);
+	if (value == NULL) {
+		errno = EINVAL;
+		bail(name);
+	}
+	return atoi(value);
+}
+
+// read_cmdline returns a NULL terminated argv read from /proc/self/cmdline.
+// glibc passes argv to constructors, but other libcs do not.
+static char **read_cmdline(void)
+{
+	int fd = open("/proc/self/cmdline", O_RDONLY | O_CLOEXEC);
+	if (fd < 0)
+		bail("open /proc/self/cmdline");
+
+	size_t size = 0, cap = 4096;
+	char *buf = malloc(cap);
+	if (buf == NULL)
+		bail("malloc");
+	for (;;) {
+		if (size == cap) {
+			cap *= 2;
+			buf = realloc(buf, cap);
+			if (buf == NULL)
+				bail("realloc");
+		}
+		ssize_t n = read(fd, buf + size, cap - size);
+		if (n < 0) {
+			if (errno == EINTR)
+				continue;
+			bail("read /proc/self/cmdline");
+		}
+		if (n == 0)
+			break;
+		size += n;
+	}
+	close(fd);
+
+	size_t argc = 0;
+	for (size_t i = 0; i < size; i++)
+		if (buf[i] == '\0')
+			argc++;
+
+	char **argv = calloc(argc + 1, sizeof(char *));
+	if (argv == NULL)
+		bail("calloc");
+	char *p = buf;
+	for (size_t i = 0; i < argc; i++) {
+		argv[i] = p;
+		p += strlen(p) + 1;
+	}
+	return argv;
+}
+
+void nsexec(void)
+{
+	if (getenv(ENV_PIDFD) == NULL)
+		return;
+
+	int pidfd = env_int(ENV_PIDFD);
+	int rootfd = env_int(ENV_ROOTFD);
+	int flags = env_int(ENV_FLAGS);
+	unsetenv(ENV_PIDFD);
+	unsetenv(ENV_ROOTFD);
+	unsetenv(ENV_FLAGS);
+
+	// argv: droplet hook-exec <path> [args...]
+	char **argv = read_cmdline();
+	if (argv[0] == NULL || argv[1] == NULL || argv[2] == NULL) {
+		errno = EINVAL;
+		bail("missing hook path");
+	}
+	char **hook_argv = &argv[2];
+
+	// 1. join namespaces (the user namespace is joined first by the kernel)
+	if (flags != 0 && setns(pidfd, flags) < 0)
+		bail("setns");
+	close(pidfd);
+
+	// 2. become root of the container user namespace
+	if (flags & CLONE_NEWUSER) {
+		// setgroups may be denied by /proc/<pid>/setgroups
+		setgroups(0, NULL);
+		if (setresgid(0, 0, 0) < 0)
+			bail("setresgid");
+		if (setresuid(0, 0, 0) < 0)
+			bail("setresuid");
+	}
+
+	// 3. resolve paths against the container root
+	if (fchdir(rootfd) < 0)
+		bail("fchdir");
+	if (chroot(".") < 0)
+		bail("chroot");
+	if (chdir("/") < 0)
+		bail("chdir");
+	close(rootfd);
+
+	// 4. fork so that the hook becomes a member of the pid namespace
+	pid_t child = fork();
+	if (child < 0)
+		bail("fork");
+	if (child == 0) {
+		execve(hook_argv[0], hook_argv, environ);
+		bail(hook_argv[0]);
+	}
+
+	int status;
+	while (waitpid(child, &status, 0) < 0) {
+		if (errno != EINTR)
+			bail("waitpid");
+	}
+	if (WIFEXITED(status))
+		_exit(WEXITSTATUS(status));
+	if (WIFSIGNALED(status))
+		_exit(128 + WTERMSIG(status));
+	_exit(127);
+}
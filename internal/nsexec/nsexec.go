@@ -0,0 +1,15 @@
+//go:build linux && cgo
+
+package nsexec
+
+/*
+#cgo CFLAGS: -Wall
+extern void nsexec(void);
+void __attribute__((constructor)) nsexec_init(void) {
+	nsexec();
+}
+*/
+import "C"
+
+// Enabled reports whether the nsexec constructor is linked into the binary.
+const Enabled = true
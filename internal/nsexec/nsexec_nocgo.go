@@ -0,0 +1,6 @@
+//go:build !linux || !cgo
+
+package nsexec
+
+// Enabled reports whether the nsexec constructor is linked into the binary.
+const Enabled = false
@@ -2,5 +2,6 @@ package oci
 
 var (
 	OCIVersion        = "1.3.0"
+	OCIVersionMin     = "1.0.0"
 	AnnotationVersion = "0.1.0"
 )
@@ -0,0 +1,48 @@
+package spec
+
+// Features is the OCI runtime features document (features.json) reported
+// by `droplet features`.
+//
+// See https://github.com/opencontainers/runtime-spec/blob/main/features.md
+type Features struct {
+	OciVersionMin                      string            `json:"ociVersionMin,omitempty"`
+	OciVersionMax                      string            `json:"ociVersionMax,omitempty"`
+	Hooks                              []string          `json:"hooks,omitempty"`
+	MountOptions                       []string          `json:"mountOptions,omitempty"`
+	Linux                              *LinuxFeatures    `json:"linux,omitempty"`
+	Annotations                        map[string]string `json:"annotations,omitempty"`
+	PotentiallyUnsafeConfigAnnotations []string          `json:"potentiallyUnsafeConfigAnnotations,omitempty"`
+}
+
+type LinuxFeatures struct {
+	Namespaces   []string         `json:"namespaces,omitempty"`
+	Capabilities []string         `json:"capabilities,omitempty"`
+	Cgroup       *CgroupFeatures  `json:"cgroup,omitempty"`
+	Seccomp      *SeccompFeatures `json:"seccomp,omitempty"`
+	Apparmor     *LsmFeatures     `json:"apparmor,omitempty"`
+	Selinux      *LsmFeatures     `json:"selinux,omitempty"`
+	IntelRdt     *LsmFeatures     `json:"intelRdt,omitempty"`
+}
+
+type CgroupFeatures struct {
+	V1          *bool `json:"v1,omitempty"`
+	V2          *bool `json:"v2,omitempty"`
+	Systemd     *bool `json:"systemd,omitempty"`
+	SystemdUser *bool `json:"systemdUser,omitempty"`
+	Rdma        *bool `json:"rdma,omitempty"`
+}
+
+type SeccompFeatures struct {
+	Enabled        *bool    `json:"enabled,omitempty"`
+	Actions        []string `json:"actions,omitempty"`
+	Operators      []string `json:"operators"`
+	Archs          []string `json:"archs,omitempty"`
+	KnownFlags     []string `json:"knownFlags"`
+	SupportedFlags []string `json:"supportedFlags"`
+}
+
+// LsmFeatures is shared by apparmor, selinux and intelRdt, which only
+// report whether the feature is enabled.
+type LsmFeatures struct {
+	Enabled *bool `json:"enabled,omitempty"`
+}
@@ -23,6 +23,7 @@ type NetOption struct {
 }
 
 type ImageOption struct {
+	RootfsType string
 	ImageLayer []string
 	UpperDir   string
 	WorkDir    string
@@ -46,12 +47,13 @@ type HookLifecycleOption struct {
 }
 
 type ConfigOptions struct {
-	Rootfs    string
-	Mounts    []MountOption
-	Process   ProcessOption
-	Namespace []string
-	Hostname  string
-	Net       NetOption
-	Image     ImageOption
-	Hooks     HookLifecycleOption
+	Rootfs      string
+	Mounts      []MountOption
+	Process     ProcessOption
+	Namespace   []string
+	Hostname    string
+	Net         NetOption
+	Image       ImageOption
+	Hooks       HookLifecycleOption
+	Annotations map[string]string
 }
@@ -1,7 +1,8 @@
 package spec
 
 type RootObject struct {
-	Path string `json:"path"`
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly,omitempty"`
 }
 
 type MountObject struct {
@@ -82,11 +83,33 @@ type LinuxSpecObject struct {
 	AppArmorProfile string            `json:"apparmorProfile,omitempty"`
 }
 
-type AnnotationObject struct {
-	Version string `json:"io.raind.runtime.annotation.version"`
-	Net     string `json:"io.raind.net.config"`
-	Image   string `json:"io.raind.image.config"`
-}
+// droplet specific annotation keys
+const (
+	AnnotationKeyVersion        = "io.raind.runtime.annotation.version"
+	AnnotationKeyNet            = "io.raind.net.config"
+	AnnotationKeyImage          = "io.raind.image.config"
+	AnnotationKeyHooksOnFailure = "io.raind.hooks.onFailure"
+	AnnotationKeyHooksParallel  = "io.raind.hooks.parallel"
+	AnnotationKeyAttachInput    = "io.raind.attach.input"
+	AnnotationKeyLogFormat      = "io.raind.log.format"
+	AnnotationKeyLogMaxSize     = "io.raind.log.maxSize"
+	AnnotationKeyLogMaxFiles    = "io.raind.log.maxFiles"
+)
+
+// AnnotationObject holds the annotations of a container. Every key is kept
+// as it is, including keys droplet does not interpret; the io.raind.* keys
+// droplet uses are read with the accessors below.
+type AnnotationObject map[string]string
+
+func (a AnnotationObject) Version() string        { return a[AnnotationKeyVersion] }
+func (a AnnotationObject) Net() string            { return a[AnnotationKeyNet] }
+func (a AnnotationObject) Image() string          { return a[AnnotationKeyImage] }
+func (a AnnotationObject) HooksOnFailure() string { return a[AnnotationKeyHooksOnFailure] }
+func (a AnnotationObject) HooksParallel() string  { return a[AnnotationKeyHooksParallel] }
+func (a AnnotationObject) AttachInput() string    { return a[AnnotationKeyAttachInput] }
+func (a AnnotationObject) LogFormat() string      { return a[AnnotationKeyLogFormat] }
+func (a AnnotationObject) LogMaxSize() string     { return a[AnnotationKeyLogMaxSize] }
+func (a AnnotationObject) LogMaxFiles() string    { return a[AnnotationKeyLogMaxFiles] }
 
 type HookObject struct {
 	Path    string   `json:"path"`
@@ -113,7 +136,7 @@ type Spec struct {
 	Hostname    string              `json:"hostname"`
 	LinuxSpec   LinuxSpecObject     `json:"linux"`
 	Hooks       HookLifecycleObject `json:"hooks,omitempty"`
-	Annotations AnnotationObject    `json:"annotations"`
+	Annotations AnnotationObject    `json:"annotations,omitempty"`
 }
 
 // Annotation: io.raind.net.config
@@ -139,6 +162,17 @@ type NetConfigObject struct {
 }
 
 // Annotation: io.raind.image.config
+//
+// rootfsType selects how the container root filesystem is prepared:
+//   - bind             : use root.path as-is (no image layers required)
+//   - overlay          : overlayfs with persistent upper/work directories
+//   - overlay-volatile : overlayfs with upper/work on tmpfs, discarded on delete
+const (
+	RootfsTypeBind            = "bind"
+	RootfsTypeOverlay         = "overlay"
+	RootfsTypeOverlayVolatile = "overlay-volatile"
+)
+
 type ImageConfigObject struct {
 	RootfsType string   `json:"rootfsType"`
 	ImageLayer []string `json:"imageLayer"`
@@ -146,6 +180,9 @@ type ImageConfigObject struct {
 	WorkDir    string   `json:"workDir"`
 }
 
+// SpecHash pins config.json, and the hooks.json merged from the hooks
+// directory if there is one, between create and init.
 type SpecHash struct {
-	Sha256 string `json:"sha256"`
+	Sha256      string `json:"sha256"`
+	HooksSha256 string `json:"hooksSha256,omitempty"`
 }
@@ -3,6 +3,7 @@ package spec
 import (
 	"droplet/internal/oci"
 	"droplet/internal/utils"
+	"fmt"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -210,8 +211,12 @@ func buildNetSpec(opts ConfigOptions) NetConfigObject {
 }
 
 func buildImageSpec(opts ConfigOptions) ImageConfigObject {
+	rootfsType := opts.Image.RootfsType
+	if rootfsType == "" {
+		rootfsType = RootfsTypeOverlay
+	}
 	return ImageConfigObject{
-		RootfsType: "overlay",
+		RootfsType: rootfsType,
 		ImageLayer: opts.Image.ImageLayer,
 		UpperDir:   opts.Image.UpperDir,
 		WorkDir:    opts.Image.WorkDir,
@@ -305,11 +310,16 @@ func buildHookSpec(opts ConfigOptions) HookLifecycleObject {
 func buildAnnotationSpec(opts ConfigOptions) AnnotationObject {
 	netSpec, _ := utils.JsonToString(buildNetSpec(opts))
 	imageSpec, _ := utils.JsonToString(buildImageSpec(opts))
-	return AnnotationObject{
-		Version: oci.AnnotationVersion,
-		Net:     netSpec,
-		Image:   imageSpec,
+	annotation := AnnotationObject{
+		AnnotationKeyVersion: oci.AnnotationVersion,
+		AnnotationKeyNet:     netSpec,
+		AnnotationKeyImage:   imageSpec,
+	}
+	// --annotation values are written as given, including io.raind.* keys
+	for k, v := range opts.Annotations {
+		annotation[k] = v
 	}
+	return annotation
 }
 
 func buildSpec(opts ConfigOptions) Spec {
@@ -360,6 +370,34 @@ func CreateConfigFile(path string, opts ConfigOptions) error {
 	return nil
 }
 
+// ParseImageConfig decodes the io.raind.image.config annotation.
+//
+// An empty annotation is accepted and treated as a plain "bind" rootfs so
+// that standard OCI bundles without droplet annotations work unmodified.
+// An annotation without rootfsType falls back to "overlay" for compatibility
+// with config.json files generated by older versions.
+func ParseImageConfig(imageAnnotation string) (ImageConfigObject, error) {
+	if strings.TrimSpace(imageAnnotation) == "" {
+		return ImageConfigObject{RootfsType: RootfsTypeBind}, nil
+	}
+
+	var imageConfig ImageConfigObject
+	if err := utils.StringToJson(imageAnnotation, &imageConfig); err != nil {
+		return ImageConfigObject{}, err
+	}
+
+	switch imageConfig.RootfsType {
+	case "":
+		imageConfig.RootfsType = RootfsTypeOverlay
+	case RootfsTypeBind, RootfsTypeOverlay, RootfsTypeOverlayVolatile:
+		// supported
+	default:
+		return ImageConfigObject{}, fmt.Errorf("unsupported rootfsType: %q", imageConfig.RootfsType)
+	}
+
+	return imageConfig, nil
+}
+
 func LoadConfigFile(path string) (Spec, error) {
 	var spec Spec
 
@@ -0,0 +1,119 @@
+package spec
+
+import (
+	"droplet/internal/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigFile_KeepsUnknownAnnotations(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{
+		"ociVersion": "1.0.2",
+		"root": {"path": "rootfs"},
+		"annotations": {
+			"io.raind.log.format": "cri",
+			"org.opencontainers.image.ref.name": "alpine",
+			"com.example.list": "a,b=c"
+		}
+	}`
+	assert.Nil(t, os.WriteFile(path, []byte(config), 0644))
+
+	// == act ==
+	spec, err := LoadConfigFile(path)
+	assert.Nil(t, err)
+	assert.Nil(t, utils.WriteJsonToFile(path, spec))
+	reloaded, reloadErr := LoadConfigFile(path)
+
+	// == assert ==
+	assert.Nil(t, reloadErr)
+	assert.Equal(t, "cri", spec.Annotations.LogFormat())
+	assert.Equal(t, "", spec.Annotations.Net())
+	assert.Equal(t, AnnotationObject{
+		AnnotationKeyLogFormat:              "cri",
+		"org.opencontainers.image.ref.name": "alpine",
+		"com.example.list":                  "a,b=c",
+	}, reloaded.Annotations)
+}
+
+func TestCreateConfigFile_Annotations(t *testing.T) {
+	// == arrange ==
+	path := filepath.Join(t.TempDir(), "config.json")
+	opts := ConfigOptions{
+		Rootfs:      "rootfs",
+		Annotations: map[string]string{"org.example.team": "web", AnnotationKeyAttachInput: "all"},
+	}
+
+	// == act ==
+	err := CreateConfigFile(path, opts)
+
+	// == assert ==
+	assert.Nil(t, err)
+	spec, err := LoadConfigFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "web", spec.Annotations["org.example.team"])
+	assert.Equal(t, "all", spec.Annotations.AttachInput())
+	assert.NotEmpty(t, spec.Annotations.Version())
+	assert.NotEmpty(t, spec.Annotations.Image())
+}
+
+func TestParseImageConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		want       ImageConfigObject
+		wantErr    bool
+	}{
+		{
+			name:       "empty annotation is bind",
+			annotation: "",
+			want:       ImageConfigObject{RootfsType: RootfsTypeBind},
+		},
+		{
+			name:       "missing rootfsType is overlay",
+			annotation: `{"imageLayer":["/layers/alpine"],"upperDir":"/c/diff","workDir":"/c/work"}`,
+			want: ImageConfigObject{
+				RootfsType: RootfsTypeOverlay,
+				ImageLayer: []string{"/layers/alpine"},
+				UpperDir:   "/c/diff",
+				WorkDir:    "/c/work",
+			},
+		},
+		{
+			name:       "overlay-volatile",
+			annotation: `{"rootfsType":"overlay-volatile","imageLayer":["/layers/alpine"]}`,
+			want: ImageConfigObject{
+				RootfsType: RootfsTypeOverlayVolatile,
+				ImageLayer: []string{"/layers/alpine"},
+			},
+		},
+		{
+			name:       "unknown rootfsType",
+			annotation: `{"rootfsType":"zfs"}`,
+			wantErr:    true,
+		},
+		{
+			name:       "invalid json",
+			annotation: `{"rootfsType":`,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// == act ==
+			got, err := ParseImageConfig(tt.annotation)
+
+			// == assert ==
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
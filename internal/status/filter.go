@@ -0,0 +1,103 @@
+package status
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ListFilter selects containers for list. Values of the same key are
+// alternatives; different keys must all match.
+//
+//	status=running           the container is running
+//	id=c1                    the container id is c1
+//	annotation=key           the annotation key is set
+//	annotation=key=value     the annotation key is set to value
+type ListFilter struct {
+	statuses    []string
+	ids         []string
+	annotations []annotationFilter
+}
+
+type annotationFilter struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// filter keys
+var listFilterKeys = []string{"status", "id", "annotation"}
+
+// ParseListFilter parses --filter values. A value may hold several
+// comma separated filters, e.g. "status=running,annotation=k=v".
+//
+// Within an annotation filter, a comma only separates filters when it is
+// followed by a filter key and "=", so annotation values may contain
+// commas: "annotation=k=a,b" selects the value "a,b". The --filter flag is not split by the cli itself, since
+// the app disables the slice flag separator.
+func ParseListFilter(values []string) (ListFilter, error) {
+	var f ListFilter
+	for _, value := range values {
+		for _, term := range splitFilterTerms(value) {
+			if term == "" {
+				continue
+			}
+			key, arg, ok := strings.Cut(term, "=")
+			if !ok || arg == "" {
+				return ListFilter{}, fmt.Errorf("invalid filter: %q", term)
+			}
+			switch key {
+			case "status":
+				s, err := ParseContainerStatus(arg)
+				if err != nil {
+					return ListFilter{}, err
+				}
+				f.statuses = append(f.statuses, s.String())
+			case "id":
+				f.ids = append(f.ids, arg)
+			case "annotation":
+				k, v, hasValue := strings.Cut(arg, "=")
+				f.annotations = append(f.annotations, annotationFilter{key: k, value: v, hasValue: hasValue})
+			default:
+				return ListFilter{}, fmt.Errorf("unknown filter: %q", key)
+			}
+		}
+	}
+	return f, nil
+}
+
+// splitFilterTerms splits value at the commas, except those inside an
+// annotation value.
+func splitFilterTerms(value string) []string {
+	var terms []string
+	for _, part := range strings.Split(value, ",") {
+		if len(terms) > 0 && strings.HasPrefix(terms[len(terms)-1], "annotation=") && !startsFilterTerm(part) {
+			terms[len(terms)-1] += "," + part
+			continue
+		}
+		terms = append(terms, part)
+	}
+	return terms
+}
+
+func startsFilterTerm(s string) bool {
+	key, _, ok := strings.Cut(s, "=")
+	return s == "" || (ok && slices.Contains(listFilterKeys, key))
+}
+
+// Match reports whether the container passes the filter.
+func (f ListFilter) Match(st StatusObject) bool {
+	if len(f.statuses) > 0 && !slices.Contains(f.statuses, st.Status) {
+		return false
+	}
+	if len(f.ids) > 0 && !slices.Contains(f.ids, st.Id) {
+		return false
+	}
+	for _, a := range f.annotations {
+		v, ok := st.Annotations[a.key]
+		if !ok || (a.hasValue && v != a.value) {
+			return false
+		}
+	}
+	return true
+}
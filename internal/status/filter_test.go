@@ -0,0 +1,79 @@
+package status
+
+import (
+	"droplet/internal/spec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListFilter_Match(t *testing.T) {
+	// == arrange ==
+	running := StatusObject{Id: "c1", Status: RUNNING.String(),
+		Annotations: spec.AnnotationObject{"team": "web", "tier": ""}}
+	stopped := StatusObject{Id: "c2", Status: STOPPED.String(),
+		Annotations: spec.AnnotationObject{"team": "db"}}
+
+	tests := []struct {
+		filter  []string
+		running bool
+		stopped bool
+	}{
+		{nil, true, true},
+		{[]string{"status=running"}, true, false},
+		{[]string{"status=running,status=stopped"}, true, true},
+		{[]string{"annotation=team=db"}, false, true},
+		{[]string{"annotation=tier"}, true, false},
+		{[]string{"status=running", "annotation=team=db"}, false, false},
+		{[]string{"id=c2"}, false, true},
+	}
+
+	for _, tt := range tests {
+		// == act ==
+		f, err := ParseListFilter(tt.filter)
+
+		// == assert ==
+		assert.Nil(t, err)
+		assert.Equal(t, tt.running, f.Match(running), tt.filter)
+		assert.Equal(t, tt.stopped, f.Match(stopped), tt.filter)
+	}
+}
+
+func TestParseListFilter_CommaInAnnotationValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  ListFilter
+	}{
+		{"annotation=k=a,b", ListFilter{
+			annotations: []annotationFilter{{key: "k", value: "a,b", hasValue: true}},
+		}},
+		{"annotation=k=a,b,status=running", ListFilter{
+			statuses:    []string{RUNNING.String()},
+			annotations: []annotationFilter{{key: "k", value: "a,b", hasValue: true}},
+		}},
+		{"status=running,annotation=k=v,id=c1", ListFilter{
+			statuses:    []string{RUNNING.String()},
+			ids:         []string{"c1"},
+			annotations: []annotationFilter{{key: "k", value: "v", hasValue: true}},
+		}},
+	}
+
+	for _, tt := range tests {
+		// == act ==
+		f, err := ParseListFilter([]string{tt.value})
+
+		// == assert ==
+		assert.Nil(t, err, tt.value)
+		assert.Equal(t, tt.want, f, tt.value)
+	}
+}
+
+func TestParseListFilter_Invalid(t *testing.T) {
+	for _, value := range []string{"status=paused", "name=c1", "status", "annotation=", "status=running,b"} {
+		// == act ==
+		_, err := ParseListFilter([]string{value})
+
+		// == assert ==
+		assert.NotNil(t, err, value)
+	}
+}
@@ -0,0 +1,163 @@
+package status
+
+import (
+	"bytes"
+	"droplet/internal/spec"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// StateVersion is the version of the state.json schema written by this
+// droplet. Bump it, and append a migration to stateMigrations, when a
+// field changes its meaning or format; new optional fields need no bump.
+//
+//	0  unversioned (every state written before stateVersion existed)
+//	1  stateVersion added; unset io.raind.* annotations are omitted
+const StateVersion = 1
+
+// stateMigrations[n] upgrades a state of version n to version n+1. They
+// work on the raw fields, as an old state may not decode into the
+// current StatusObject.
+var stateMigrations = []func(raw map[string]json.RawMessage) error{
+	migrateStateV0,
+}
+
+// migrateStateV0 drops the io.raind.* annotations that older versions
+// wrote as empty strings when they were unset, and a null annotations
+// object.
+func migrateStateV0(raw map[string]json.RawMessage) error {
+	data, ok := raw["annotations"]
+	if !ok {
+		return nil
+	}
+	var annotations map[string]string
+	if err := json.Unmarshal(data, &annotations); err != nil {
+		// left to the tolerant decoding
+		return nil
+	}
+	if annotations == nil {
+		delete(raw, "annotations")
+		return nil
+	}
+	for _, key := range []string{spec.AnnotationKeyVersion, spec.AnnotationKeyNet, spec.AnnotationKeyImage} {
+		if v, ok := annotations[key]; ok && v == "" {
+			delete(annotations, key)
+		}
+	}
+	b, err := json.Marshal(annotations)
+	if err != nil {
+		return err
+	}
+	raw["annotations"] = b
+	return nil
+}
+
+// stateFields is StatusObject without its JSON methods.
+type stateFields StatusObject
+
+// stateKeys are the JSON keys of the fields of StatusObject.
+var stateKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(stateFields{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}()
+
+// UnmarshalJSON decodes a state of any version.
+//
+// A state of an older version is migrated to StateVersion. Decoding is
+// tolerant: a field of an unexpected type is left at its zero value
+// instead of failing the whole state. Such fields, and fields this
+// version does not know, e.g. from a newer droplet, are kept and written
+// back unchanged unless the field is set again.
+func (s *StatusObject) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		return fmt.Errorf("invalid state: %s", data)
+	}
+
+	// 1. migrate
+	version := 0
+	if v, ok := raw["stateVersion"]; ok {
+		_ = json.Unmarshal(v, &version)
+	}
+	if version < 0 {
+		version = 0
+	}
+	migrated := false
+	for ; version < StateVersion; version++ {
+		if err := stateMigrations[version](raw); err != nil {
+			return fmt.Errorf("migrate state from version %d: %w", version, err)
+		}
+		migrated = true
+	}
+
+	// 2. decode field by field
+	var fields stateFields
+	keep := func(key string, value json.RawMessage) {
+		if fields.extra == nil {
+			fields.extra = map[string]json.RawMessage{}
+		}
+		fields.extra[key] = value
+	}
+	for key, value := range raw {
+		if !stateKeys[key] {
+			keep(key, value)
+			continue
+		}
+		field, err := json.Marshal(map[string]json.RawMessage{key: value})
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(field, &fields); err != nil {
+			// kept as it is while the field is left unset
+			keep(key, value)
+		}
+	}
+	fields.StateVersion = version
+	fields.migrated = migrated
+	*s = StatusObject(fields)
+	return nil
+}
+
+// MarshalJSON encodes the state together with the kept fields that are
+// not written by this version.
+func (s StatusObject) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(stateFields(s))
+	if err != nil || len(s.extra) == 0 {
+		return b, err
+	}
+	var written map[string]json.RawMessage
+	if err := json.Unmarshal(b, &written); err != nil {
+		return nil, err
+	}
+	// the kept fields follow the known ones, in key order
+	buf := bytes.NewBuffer(b[:len(b)-1])
+	for _, key := range slices.Sorted(maps.Keys(s.extra)) {
+		if _, ok := written[key]; ok {
+			continue
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(s.extra[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,140 @@
+package status
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestStateVersion_Golden loads every state format in testdata and
+// compares the state written back with its .golden file.
+func TestStateVersion_Golden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "state_*.json"))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, inputs)
+
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			// == arrange ==
+			golden := strings.TrimSuffix(input, ".json") + ".golden"
+
+			// == act ==
+			var st StatusObject
+			err := utils.ReadJsonFile(input, &st)
+			assert.Nil(t, err)
+			got, err := json.MarshalIndent(st, "", "    ")
+			assert.Nil(t, err)
+			got = append(got, '\n')
+
+			// == assert ==
+			if *update {
+				assert.Nil(t, os.WriteFile(golden, got, 0644))
+			}
+			want, err := os.ReadFile(golden)
+			assert.Nil(t, err)
+			assert.Equal(t, string(want), string(got))
+		})
+	}
+}
+
+func TestStateVersion_MigratesBaseline(t *testing.T) {
+	// == arrange ==
+	var st StatusObject
+
+	// == act ==
+	err := utils.ReadJsonFile(filepath.Join("testdata", "state_v0_baseline.json"), &st)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, StateVersion, st.StateVersion)
+	assert.True(t, st.migrated)
+	assert.Equal(t, 4242, st.Pid)
+	assert.False(t, st.InitIdentity().Verifiable())
+	assert.Equal(t, spec.AnnotationObject{
+		spec.AnnotationKeyVersion: "0.1.0",
+		spec.AnnotationKeyImage:   `{"rootfsType":"overlay"}`,
+	}, st.Annotations)
+	assert.True(t, st.StartedAt.IsZero())
+	assert.Nil(t, st.ExitCode)
+}
+
+func TestStateVersion_DecodesExitFormat(t *testing.T) {
+	// == arrange ==
+	var st StatusObject
+
+	// == act ==
+	err := utils.ReadJsonFile(filepath.Join("testdata", "state_v0_exit.json"), &st)
+
+	// == assert ==
+	assert.Nil(t, err)
+	if assert.NotNil(t, st.ExitCode) {
+		assert.Equal(t, 137, *st.ExitCode)
+	}
+	assert.Equal(t, "SIGKILL", st.ExitSignal)
+	assert.True(t, st.OomKilled)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 1, 0, 0, time.UTC), st.FinishedAt)
+	assert.Equal(t, spec.AnnotationObject{spec.AnnotationKeyLogFormat: "json"}, st.Annotations)
+}
+
+func TestStateVersion_KeepsFieldsOfNewerVersion(t *testing.T) {
+	// == arrange ==
+	var st StatusObject
+
+	// == act ==
+	err := utils.ReadJsonFile(filepath.Join("testdata", "state_future.json"), &st)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, 7, st.StateVersion)
+	assert.False(t, st.migrated)
+	assert.Equal(t, 4242, st.Pid)
+	// owner changed its type and is left unset rather than failing the load
+	assert.Equal(t, "", st.Owner)
+	b, err := json.Marshal(st)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"checkpoint":{"path":"/var/lib/raind/checkpoints/c1"`)
+	assert.Contains(t, string(b), `"owner":{"uid":0}`)
+	assert.Contains(t, string(b), `"stateVersion":7`)
+}
+
+func TestStateVersion_InvalidState(t *testing.T) {
+	for _, data := range []string{`[]`, `null`, `{"id":`} {
+		// == act ==
+		var st StatusObject
+		err := json.Unmarshal([]byte(data), &st)
+
+		// == assert ==
+		assert.NotNil(t, err, data)
+	}
+}
+
+func TestStatusHandler_WritesMigratedState(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	legacy, err := os.ReadFile(filepath.Join("testdata", "state_v0_exit.json"))
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(utils.ContainerStatePath("c1"), legacy, 0644))
+
+	// == act ==
+	raw, rawErr := h.ReadRawStatusFile("c1")
+	_, statusErr := h.GetStatusFromId("c1")
+
+	// == assert ==
+	assert.Nil(t, rawErr)
+	assert.Equal(t, string(legacy), raw)
+	assert.Nil(t, statusErr)
+	stored, err := h.ReadRawStatusFile("c1")
+	assert.Nil(t, err)
+	assert.Contains(t, stored, `"stateVersion": 1`)
+	assert.NotContains(t, stored, `"io.raind.net.config"`)
+}
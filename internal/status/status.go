@@ -2,19 +2,105 @@ package status
 
 import (
 	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 )
 
 type StatusObject struct {
-	OciVersion string                `json:"ociVersion"`
-	Id         string                `json:"id"`
-	Status     string                `json:"status"`
-	Pid        int                   `json:"pid"`
-	ShimPid    int                   `json:"shimPid"`
-	Rootfs     string                `json:"rootfs"`
-	Bundle     string                `json:"bundle"`
-	Annotaion  spec.AnnotationObject `json:"annotations"`
+	OciVersion   string                `json:"ociVersion"`
+	StateVersion int                   `json:"stateVersion"`
+	Id           string                `json:"id"`
+	Status       string                `json:"status"`
+	Pid          int                   `json:"pid"`
+	ShimPid      int                   `json:"shimPid"`
+	Rootfs       string                `json:"rootfs"`
+	Bundle       string                `json:"bundle"`
+	Annotations  spec.AnnotationObject `json:"annotations,omitempty"`
+
+	// set when state.json is created
+	Created time.Time `json:"created,omitzero"`
+	Owner   string    `json:"owner,omitempty"`
+
+	// identities of the init process and the shim, recorded with Pid and
+	// ShimPid so that a reused pid is not taken for the container
+	InitStartTime uint64 `json:"initStartTime,omitempty"`
+	ShimStartTime uint64 `json:"shimStartTime,omitempty"`
+	BootId        string `json:"bootId,omitempty"`
+
+	// format of console.log, recorded by the shim; a state without it
+	// has a raw log
+	LogFormat string `json:"logFormat,omitempty"`
+
+	// set when the container starts running
+	StartedAt time.Time `json:"startedAt,omitzero"`
+	// set when the exit of the container process is observed by its
+	// parent; a container stopped without it has no ExitCode
+	ExitCode   *int      `json:"exitCode,omitempty"`
+	ExitSignal string    `json:"exitSignal,omitempty"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	OomKilled  bool      `json:"oomKilled,omitempty"`
+
+	// unknown or undecodable fields, e.g. of a newer state version,
+	// written back unchanged
+	extra map[string]json.RawMessage
+	// loaded from an older state version
+	migrated bool
+}
+
+// InitIdentity returns the recorded identity of the init process.
+func (s StatusObject) InitIdentity() utils.ProcIdentity {
+	return utils.ProcIdentity{Pid: s.Pid, StartTime: s.InitStartTime, BootId: s.BootId}
+}
+
+// ShimIdentity returns the recorded identity of the shim.
+func (s StatusObject) ShimIdentity() utils.ProcIdentity {
+	return utils.ProcIdentity{Pid: s.ShimPid, StartTime: s.ShimStartTime, BootId: s.BootId}
+}
+
+// setPid records pid and, for a running process, its identity.
+func (s *StatusObject) setPid(pid int) {
+	s.Pid = pid
+	s.InitStartTime = s.identify(pid)
+	s.dropUnusedBootId()
+}
+
+// setShimPid records the shim pid and, for a running shim, its identity.
+func (s *StatusObject) setShimPid(pid int) {
+	s.ShimPid = pid
+	s.ShimStartTime = s.identify(pid)
+	s.dropUnusedBootId()
+}
+
+// identify returns the start time of the running process pid, or 0, and
+// records the boot it runs in.
+func (s *StatusObject) identify(pid int) uint64 {
+	if pid <= 0 {
+		return 0
+	}
+	identity, err := utils.NewProcIdentity(pid)
+	if err != nil {
+		return 0
+	}
+	s.BootId = identity.BootId
+	return identity.StartTime
+}
+
+// dropUnusedBootId clears BootId once no start time refers to it.
+func (s *StatusObject) dropUnusedBootId() {
+	if s.InitStartTime == 0 && s.ShimStartTime == 0 {
+		s.BootId = ""
+	}
+}
+
+// ExitInfo describes how the container process exited.
+type ExitInfo struct {
+	ExitCode   int    // exit code, or 128+signal if it was killed
+	ExitSignal string // name of the killing signal, e.g. SIGKILL
+	FinishedAt time.Time
+	OomKilled  bool
 }
 
 // container status
@@ -4,8 +4,11 @@ import (
 	"droplet/internal/oci"
 	"droplet/internal/spec"
 	"droplet/internal/utils"
+	"encoding/json"
 	"os"
-	"syscall"
+	"os/user"
+	"strconv"
+	"time"
 )
 
 // ContainerStatusManager defines the operations required to manage
@@ -19,9 +22,14 @@ type ContainerStatusManager interface {
 	RemoveStatusFile(containerId string) error
 	ReadStatusFile(containerId string) (string, error)
 	UpdateStatus(containerId string, status ContainerStatus, pid int, shimPid int) error
+	RecordExit(containerId string, exit ExitInfo) error
+	RecordLogFormat(containerId string, format string) error
 	GetPidFromId(containerId string) (int, error)
+	GetProcIdentityFromId(containerId string) (utils.ProcIdentity, error)
 	GetStatusFromId(containerId string) (ContainerStatus, error)
 	GetShimPidFromId(containerId string) (int, error)
+	GetShimIdentityFromId(containerId string) (utils.ProcIdentity, error)
+	GetBundleFromId(containerId string) (string, error)
 	ListContainers() ([]StatusObject, error)
 }
 
@@ -36,9 +44,14 @@ func NewStatusHandler() *StatusHandler {
 
 // StatusHandler manages the lifecycle of container status files.
 //
+// Every read-modify-write of state.json holds the state lock of the
+// container, and state.json is always replaced atomically, so concurrent
+// commands never lose an update and readers never see a partial file.
+//
 // It is responsible for:
 //   - Creating state.json when a container is created
 //   - Updating status and PID fields
+//   - Recording the start time and the exit of the container process
 //   - Deleting state.json when a container is removed
 //   - Recomputing status based on the liveness of the container process
 type StatusHandler struct {
@@ -49,64 +62,124 @@ type StatusHandler struct {
 // for the given container ID.
 //
 // It populates the file with the provided PID, status, rootfs, bundle
-// path and annotations, along with the current OCI version.
+// path and annotations, along with the current OCI version, the creation
+// time and the user that created the container.
 func (h *StatusHandler) CreateStatusFile(containerId string, pid int, status ContainerStatus,
 	rootfs string, bundle string, annotation spec.AnnotationObject) error {
 	stateFilePath := utils.ContainerStatePath(containerId)
 	statusObject := StatusObject{
-		OciVersion: oci.OCIVersion,
-		Id:         containerId,
-		Status:     status.String(),
-		Pid:        pid,
-		ShimPid:    0,
-		Rootfs:     rootfs,
-		Bundle:     bundle,
-		Annotaion:  annotation,
+		OciVersion:   oci.OCIVersion,
+		StateVersion: StateVersion,
+		Id:           containerId,
+		Status:       status.String(),
+		ShimPid:      0,
+		Rootfs:       rootfs,
+		Bundle:       bundle,
+		Annotations:  annotation,
+		Created:      time.Now().UTC(),
+		Owner:        currentOwner(),
+	}
+	statusObject.setPid(pid)
+
+	lock, err := utils.LockFile(utils.ContainerStateLockPath(containerId))
+	if err != nil {
+		return err
 	}
+	defer lock.Unlock()
 
-	if err := utils.WriteJsonToFile(stateFilePath, statusObject); err != nil {
+	if err := utils.WriteJsonFileAtomic(stateFilePath, statusObject); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// currentOwner returns the name of the user running droplet, or its uid if
+// the user has no name.
+func currentOwner() string {
+	uid := strconv.Itoa(os.Getuid())
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return uid
+	}
+	return u.Username
+}
+
+// modify applies fn to state.json under the state lock and writes the
+// result back if fn reports a change.
+func (h *StatusHandler) modify(containerId string, fn func(statusObject *StatusObject) bool) error {
+	stateFilePath := utils.ContainerStatePath(containerId)
+	// the lock file lives next to state.json, so a missing state is
+	// reported as such instead of creating the lock in a missing directory
+	if _, err := os.Stat(stateFilePath); err != nil {
+		return err
+	}
+	lock, err := utils.LockFile(utils.ContainerStateLockPath(containerId))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// load status file
+	var statusObject StatusObject
+	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
+		return err
+	}
+
+	// a migrated state is written back in the current version
+	if !fn(&statusObject) && !statusObject.migrated {
+		return nil
+	}
+
+	// write status file
+	return utils.WriteJsonFileAtomic(stateFilePath, statusObject)
+}
+
 // RemoveStatusFile deletes the status file (state.json) associated
 // with the given container ID.
 func (h *StatusHandler) RemoveStatusFile(containerId string) error {
 	stateFilePath := utils.ContainerStatePath(containerId)
+	lock, err := utils.LockFile(utils.ContainerStateLockPath(containerId))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 	if err := h.syscallHandler.Remove(stateFilePath); err != nil {
 		return err
 	}
 	return nil
 }
 
-// ReadStatusFile returns the raw JSON string from the status file
-// for the given container ID.
+// ReadStatusFile returns the state of the given container ID as JSON,
+// migrated to the current state version.
 //
 // Before returning, it recomputes the status based on the current
 // process liveness (e.g., updates RUNNING to STOPPED if the PID
 // no longer exists), ensuring the file contents are up to date.
 func (h *StatusHandler) ReadStatusFile(containerId string) (string, error) {
 	stateFilePath := utils.ContainerStatePath(containerId)
-	// load status file
+
+	// recompute status
+	if err := h.recomputeStatus(containerId); err != nil {
+		return "", err
+	}
+
+	// read file
 	var statusObject StatusObject
 	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
 		return "", err
 	}
-	pid := statusObject.Pid
-	currentStatus, parseErr := ParseContainerStatus(statusObject.Status)
-	if parseErr != nil {
-		return "", parseErr
-	}
-
-	// recompute status
-	if err := h.recomputeStatus(containerId, pid, currentStatus); err != nil {
+	data, err := json.MarshalIndent(statusObject, "", "    ")
+	if err != nil {
 		return "", err
 	}
+	return string(data), nil
+}
 
-	// read file
-	data, err := os.ReadFile(stateFilePath)
+// ReadRawStatusFile returns the status file of the given container ID as
+// it is stored, without recomputing or migrating it.
+func (h *StatusHandler) ReadRawStatusFile(containerId string) (string, error) {
+	data, err := os.ReadFile(utils.ContainerStatePath(containerId))
 	if err != nil {
 		return "", err
 	}
@@ -116,33 +189,50 @@ func (h *StatusHandler) ReadStatusFile(containerId string) (string, error) {
 // UpdateStatus updates the status and/or PID fields in the status file
 // for the given container ID.
 //
-// If status is in the valid range, it is written. If pid is non-negative,
-// it replaces the existing PID.
+// If status is in the valid range, it is written. If pid or shimPid is
+// non-negative, it replaces the existing PID, or shim PID, and the
+// recorded identity of the process.
+// The first transition to RUNNING records the start time.
 func (h *StatusHandler) UpdateStatus(containerId string, status ContainerStatus, pid int, shimPid int) error {
-	stateFilePath := utils.ContainerStatePath(containerId)
-	// load status file
-	var statusObject StatusObject
-	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
-		return err
-	}
-
-	// update
-	if status >= 0 && status <= 3 {
-		statusObject.Status = status.String()
-	}
-	if pid >= 0 {
-		statusObject.Pid = pid
-	}
-	if shimPid >= 0 {
-		statusObject.ShimPid = shimPid
-	}
+	return h.modify(containerId, func(statusObject *StatusObject) bool {
+		if status == RUNNING && statusObject.StartedAt.IsZero() {
+			statusObject.StartedAt = time.Now().UTC()
+		}
+		if status >= 0 && status <= 3 {
+			statusObject.Status = status.String()
+		}
+		if pid >= 0 {
+			statusObject.setPid(pid)
+		}
+		if shimPid >= 0 {
+			statusObject.setShimPid(shimPid)
+		}
+		return true
+	})
+}
 
-	// write status file
-	if err := utils.WriteJsonToFile(stateFilePath, statusObject); err != nil {
-		return err
-	}
+// RecordExit records how the container process exited and marks the
+// container stopped.
+func (h *StatusHandler) RecordExit(containerId string, exit ExitInfo) error {
+	return h.modify(containerId, func(statusObject *StatusObject) bool {
+		statusObject.Status = STOPPED.String()
+		statusObject.setPid(0)
+		statusObject.setShimPid(0)
+		exitCode := exit.ExitCode
+		statusObject.ExitCode = &exitCode
+		statusObject.ExitSignal = exit.ExitSignal
+		statusObject.FinishedAt = exit.FinishedAt.UTC()
+		statusObject.OomKilled = exit.OomKilled
+		return true
+	})
+}
 
-	return nil
+// RecordLogFormat records the format the shim writes console.log in.
+func (h *StatusHandler) RecordLogFormat(containerId string, format string) error {
+	return h.modify(containerId, func(statusObject *StatusObject) bool {
+		statusObject.LogFormat = format
+		return true
+	})
 }
 
 // GetPidFromId returns the PID recorded in the status file for the
@@ -157,6 +247,19 @@ func (h *StatusHandler) GetPidFromId(containerId string) (int, error) {
 	return statusObject.Pid, nil
 }
 
+// GetProcIdentityFromId returns the recorded identity of the init process
+// for the given container ID, which verifies the PID before it is
+// signaled.
+func (h *StatusHandler) GetProcIdentityFromId(containerId string) (utils.ProcIdentity, error) {
+	stateFilePath := utils.ContainerStatePath(containerId)
+	// load status file
+	var statusObject StatusObject
+	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
+		return utils.ProcIdentity{}, err
+	}
+	return statusObject.InitIdentity(), nil
+}
+
 func (h *StatusHandler) GetShimPidFromId(containerId string) (int, error) {
 	stateFilePath := utils.ContainerStatePath(containerId)
 	// load status file
@@ -167,6 +270,34 @@ func (h *StatusHandler) GetShimPidFromId(containerId string) (int, error) {
 	return statusObject.ShimPid, nil
 }
 
+// GetShimIdentityFromId returns the recorded identity of the shim for the
+// given container ID. A container without a shim has a zero identity.
+func (h *StatusHandler) GetShimIdentityFromId(containerId string) (utils.ProcIdentity, error) {
+	stateFilePath := utils.ContainerStatePath(containerId)
+	// load status file
+	var statusObject StatusObject
+	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
+		return utils.ProcIdentity{}, err
+	}
+	return statusObject.ShimIdentity(), nil
+}
+
+// GetBundleFromId returns the bundle directory recorded for the given
+// container ID. A state written before bundles were recorded has none;
+// such containers use the container directory as their bundle.
+func (h *StatusHandler) GetBundleFromId(containerId string) (string, error) {
+	stateFilePath := utils.ContainerStatePath(containerId)
+	// load status file
+	var statusObject StatusObject
+	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
+		return "", err
+	}
+	if statusObject.Bundle == "" {
+		return utils.ContainerDir(containerId), nil
+	}
+	return statusObject.Bundle, nil
+}
+
 // GetStatusFromId returns the current ContainerStatus for the given
 // container ID.
 //
@@ -175,22 +306,13 @@ func (h *StatusHandler) GetShimPidFromId(containerId string) (int, error) {
 // before being returned.
 func (h *StatusHandler) GetStatusFromId(containerId string) (ContainerStatus, error) {
 	stateFilePath := utils.ContainerStatePath(containerId)
-	// load status file
-	var statusObject StatusObject
-	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
-		return -1, err
-	}
-	pid := statusObject.Pid
-	currentStatus, parseErr := ParseContainerStatus(statusObject.Status)
-	if parseErr != nil {
-		return -1, parseErr
-	}
 
 	// recompute status
-	if err := h.recomputeStatus(containerId, pid, currentStatus); err != nil {
+	if err := h.recomputeStatus(containerId); err != nil {
 		return -1, err
 	}
 
+	var statusObject StatusObject
 	if err := utils.ReadJsonFile(stateFilePath, &statusObject); err != nil {
 		return -1, err
 	}
@@ -205,48 +327,36 @@ func (h *StatusHandler) GetStatusFromId(containerId string) (ContainerStatus, er
 // recomputeStatus recomputes and updates the status in the status file
 // based on the liveness of the recorded PID.
 //
-// Currently, if the status is RUNNING but the process is no longer
-// alive, it updates the status to STOPPED and clears the PID.
-func (h *StatusHandler) recomputeStatus(containerId string, pid int, currentStatus ContainerStatus) error {
-	if currentStatus == RUNNING {
-		alive, _ := h.pidAlive(pid)
-		if !alive {
-			if err := h.UpdateStatus(containerId, STOPPED, 0, 0); err != nil {
-				return err
-			}
+// Currently, if the status is RUNNING but neither the process nor its
+// shim is alive, it updates the status to STOPPED and clears the PIDs.
+// While the shim runs, it records the exit itself, so the status is left
+// to it. A process at the recorded PID with another start time is not the
+// container process, so a reused PID does not keep the container running.
+// The check and the update happen under the state lock, so a concurrent
+// update is never overwritten with a stale status.
+func (h *StatusHandler) recomputeStatus(containerId string) error {
+	var parseErr error
+	err := h.modify(containerId, func(statusObject *StatusObject) bool {
+		currentStatus, err := ParseContainerStatus(statusObject.Status)
+		if err != nil {
+			parseErr = err
+			return false
 		}
+		if currentStatus != RUNNING {
+			return false
+		}
+		if statusObject.InitIdentity().Alive() || statusObject.ShimIdentity().Alive() {
+			return false
+		}
+		statusObject.Status = STOPPED.String()
+		statusObject.setPid(0)
+		statusObject.setShimPid(0)
+		return true
+	})
+	if err != nil {
+		return err
 	}
-	return nil
-}
-
-// pidAlive reports whether a process with the given PID appears to be alive.
-//
-// It sends signal 0 to the PID:
-//   - nil        => process exists and is accessible
-//   - ESRCH      => process does not exist
-//   - EPERM      => process exists but cannot be signaled due to permissions
-func (h *StatusHandler) pidAlive(pid int) (bool, error) {
-	if pid <= 0 {
-		// process not exist
-		return false, nil
-	}
-
-	// send 0 signal to process
-	err := h.syscallHandler.Kill(pid, 0)
-	if err == nil {
-		// process exist
-		return true, nil
-	}
-	if err == syscall.ESRCH {
-		// no such process
-		return false, nil
-	}
-	if err == syscall.EPERM {
-		// operation not permitted, but process exist
-		return true, nil
-	}
-
-	return false, nil
+	return parseErr
 }
 
 func (h *StatusHandler) ListContainers() ([]StatusObject, error) {
@@ -274,11 +384,11 @@ func (h *StatusHandler) ListContainers() ([]StatusObject, error) {
 		}
 
 		// recompute status
-		currentStatus, err := ParseContainerStatus(statusObject.Status)
-		if err != nil {
-			return nil, err
-		}
-		if err := h.recomputeStatus(statusObject.Id, statusObject.Pid, currentStatus); err != nil {
+		if err := h.recomputeStatus(containerId); err != nil {
+			if os.IsNotExist(err) {
+				// removed meanwhile
+				continue
+			}
 			return nil, err
 		}
 
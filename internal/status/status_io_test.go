@@ -0,0 +1,295 @@
+package status
+
+import (
+	"droplet/internal/spec"
+	"droplet/internal/utils"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStatusHandler(t *testing.T, containerId string) *StatusHandler {
+	t.Helper()
+	t.Setenv("RAIND_ROOT_DIR", t.TempDir())
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir(containerId), 0755))
+	h := NewStatusHandler()
+	assert.Nil(t, h.CreateStatusFile(containerId, 0, CREATING, "/rootfs", "/bundle", spec.AnnotationObject{}))
+	return h
+}
+
+func readStatusObject(t *testing.T, containerId string) StatusObject {
+	t.Helper()
+	var st StatusObject
+	assert.Nil(t, utils.ReadJsonFile(utils.ContainerStatePath(containerId), &st))
+	return st
+}
+
+func TestStatusHandler_UpdateStatusRecordsStartedAt(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	assert.Nil(t, h.UpdateStatus("c1", CREATED, 42, 41))
+	created := readStatusObject(t, "c1")
+
+	// == act ==
+	err := h.UpdateStatus("c1", RUNNING, -1, -1)
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.True(t, created.StartedAt.IsZero())
+	st := readStatusObject(t, "c1")
+	assert.False(t, st.StartedAt.IsZero())
+	assert.Nil(t, st.ExitCode)
+}
+
+func TestStatusHandler_RecordExit(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	assert.Nil(t, h.UpdateStatus("c1", RUNNING, 42, 41))
+	finishedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// == act ==
+	err := h.RecordExit("c1", ExitInfo{ExitCode: 137, ExitSignal: "SIGKILL", FinishedAt: finishedAt, OomKilled: true})
+
+	// == assert ==
+	assert.Nil(t, err)
+	st := readStatusObject(t, "c1")
+	assert.Equal(t, STOPPED.String(), st.Status)
+	assert.Equal(t, 0, st.Pid)
+	assert.Equal(t, 0, st.ShimPid)
+	assert.Equal(t, 137, *st.ExitCode)
+	assert.Equal(t, "SIGKILL", st.ExitSignal)
+	assert.Equal(t, finishedAt, st.FinishedAt)
+	assert.True(t, st.OomKilled)
+}
+
+func TestStatusHandler_RecordExitZero(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+
+	// == act ==
+	err := h.RecordExit("c1", ExitInfo{FinishedAt: time.Now()})
+
+	// == assert ==
+	assert.Nil(t, err)
+	raw, err := os.ReadFile(utils.ContainerStatePath("c1"))
+	assert.Nil(t, err)
+	// a clean exit is recorded, not omitted
+	assert.True(t, strings.Contains(string(raw), `"exitCode": 0`))
+	assert.False(t, strings.Contains(string(raw), "exitSignal"))
+}
+
+func TestStatusHandler_ConcurrentUpdatesAreNotLost(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	const rounds = 200
+
+	// == act ==
+	// one writer sets pid, another shimPid; without the state lock either
+	// could write back a stale copy of the other field
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= rounds; i++ {
+			assert.Nil(t, h.UpdateStatus("c1", -1, i, -1))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= rounds; i++ {
+			assert.Nil(t, h.UpdateStatus("c1", -1, -1, i))
+		}
+	}()
+	// readers never see a partial file
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, err := h.GetStatusFromId("c1")
+				assert.Nil(t, err)
+				_, err = h.ReadStatusFile("c1")
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	// == assert ==
+	st := readStatusObject(t, "c1")
+	assert.Equal(t, rounds, st.Pid)
+	assert.Equal(t, rounds, st.ShimPid)
+}
+
+func TestStatusHandler_RecomputeDoesNotOverwriteExit(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	// a running container whose pid is gone, recomputed by several readers
+	// while its exit is recorded
+	assert.Nil(t, h.UpdateStatus("c1", RUNNING, 1<<22, 0))
+
+	// == act ==
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := h.GetStatusFromId("c1")
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	assert.Nil(t, h.RecordExit("c1", ExitInfo{ExitCode: 2, FinishedAt: time.Now()}))
+	wg.Wait()
+
+	// == assert ==
+	st := readStatusObject(t, "c1")
+	assert.Equal(t, STOPPED.String(), st.Status)
+	if assert.NotNil(t, st.ExitCode) {
+		assert.Equal(t, 2, *st.ExitCode)
+	}
+}
+
+func TestStatusHandler_RecordsInitIdentity(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+
+	// == act ==
+	err := h.UpdateStatus("c1", RUNNING, os.Getpid(), 0)
+
+	// == assert ==
+	assert.Nil(t, err)
+	st := readStatusObject(t, "c1")
+	assert.NotZero(t, st.InitStartTime)
+	assert.NotEmpty(t, st.BootId)
+	identity, err := h.GetProcIdentityFromId("c1")
+	assert.Nil(t, err)
+	assert.True(t, identity.Alive())
+}
+
+func TestStatusHandler_RecordsShimIdentity(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+
+	// == act ==
+	err := h.UpdateStatus("c1", RUNNING, 0, os.Getpid())
+
+	// == assert ==
+	assert.Nil(t, err)
+	st := readStatusObject(t, "c1")
+	assert.NotZero(t, st.ShimStartTime)
+	assert.NotEmpty(t, st.BootId)
+	assert.True(t, st.ShimIdentity().Alive())
+	// a shim recorded for a process started earlier is not taken for it
+	st.ShimStartTime--
+	assert.False(t, st.ShimIdentity().Alive())
+
+	// cleared together with the exit
+	assert.Nil(t, h.RecordExit("c1", ExitInfo{ExitCode: 0, FinishedAt: time.Now()}))
+	st = readStatusObject(t, "c1")
+	assert.Zero(t, st.ShimStartTime)
+	assert.Empty(t, st.BootId)
+}
+
+func TestStatusHandler_RunningWhileShimAlive(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	// init is gone, the shim has not recorded the exit yet
+	assert.Nil(t, h.UpdateStatus("c1", RUNNING, 1<<22, os.Getpid()))
+
+	// == act ==
+	containerStatus, err := h.GetStatusFromId("c1")
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, RUNNING, containerStatus)
+	assert.Equal(t, os.Getpid(), readStatusObject(t, "c1").ShimPid)
+}
+
+func TestStatusHandler_ReusedPidIsStopped(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	assert.Nil(t, h.UpdateStatus("c1", RUNNING, os.Getpid(), 0))
+	// the pid is alive, but it was recorded for a process started earlier
+	st := readStatusObject(t, "c1")
+	st.InitStartTime--
+	assert.Nil(t, utils.WriteJsonFileAtomic(utils.ContainerStatePath("c1"), st))
+
+	// == act ==
+	containerStatus, err := h.GetStatusFromId("c1")
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, STOPPED, containerStatus)
+	st = readStatusObject(t, "c1")
+	assert.Zero(t, st.Pid)
+	assert.Zero(t, st.InitStartTime)
+}
+
+func TestStatusHandler_CreateStatusFileKeepsAnnotations(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	annotation := spec.AnnotationObject{
+		spec.AnnotationKeyLogFormat: "json",
+		"org.example.team":          "web",
+	}
+
+	// == act ==
+	err := h.CreateStatusFile("c1", 0, CREATED, "/rootfs", "/bundle", annotation)
+
+	// == assert ==
+	assert.Nil(t, err)
+	st := readStatusObject(t, "c1")
+	assert.Equal(t, annotation, st.Annotations)
+	assert.False(t, st.Created.IsZero())
+	assert.NotEmpty(t, st.Owner)
+	data, err := os.ReadFile(utils.ContainerStatePath("c1"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"org.example.team": "web"`)
+}
+
+func TestStatusHandler_UpdateMissingState(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	assert.Nil(t, h.RemoveStatusFile("c1"))
+
+	// == act ==
+	err := h.UpdateStatus("c1", RUNNING, 1, 1)
+
+	// == assert ==
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStatusHandler_GetBundleFromId(t *testing.T) {
+	// == arrange ==
+	h := newTestStatusHandler(t, "c1")
+	assert.Nil(t, os.MkdirAll(utils.ContainerDir("c2"), 0755))
+	assert.Nil(t, h.CreateStatusFile("c2", 0, CREATING, "/rootfs", "", nil))
+
+	// == act ==
+	bundle, err := h.GetBundleFromId("c1")
+	legacy, legacyErr := h.GetBundleFromId("c2")
+	_, missingErr := h.GetBundleFromId("c3")
+
+	// == assert ==
+	assert.Nil(t, err)
+	assert.Equal(t, "/bundle", bundle)
+	// a state without a bundle uses the container directory
+	assert.Nil(t, legacyErr)
+	assert.Equal(t, utils.ContainerDir("c2"), legacy)
+	assert.True(t, os.IsNotExist(missingErr))
+}
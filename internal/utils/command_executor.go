@@ -136,6 +136,7 @@ type KernelSyscallHandler interface {
 	Unmount(target string, flags int) error
 	PivotRoot(newroot string, putold string) error
 	Chdir(path string) error
+	Chroot(path string) error
 	Mkdir(path string, mode uint32) error
 	MkdirAll(path string, perm os.FileMode) error
 	Rmdir(path string) error
@@ -237,6 +238,14 @@ func (k *kernelSyscall) Chdir(path string) error {
 	return syscall.Chdir(path)
 }
 
+// Chroot changes the root directory of the calling process.
+//
+// It wraps syscall.Chroot and is used instead of pivot_root when the
+// container is started with --no-pivot.
+func (k *kernelSyscall) Chroot(path string) error {
+	return syscall.Chroot(path)
+}
+
 // Mkdir creates a single directory using the mkdir(2) syscall.
 //
 // Unlike MkdirAll, this does not create parent directories.
@@ -29,6 +29,16 @@ func WriteJsonToFile(path string, v any) error {
 	return encoder.Encode(v)
 }
 
+// WriteJsonFileAtomic writes v as indented JSON to path through
+// WriteFileAtomic.
+func WriteJsonFileAtomic(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, append(data, '\n'), 0o644)
+}
+
 func ReadJsonFile(path string, v any) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
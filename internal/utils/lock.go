@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrLocked is returned by TryLockFile when the lock is held elsewhere.
+var ErrLocked = errors.New("file is locked")
+
+// FileLock is an exclusive flock(2) held on a lock file.
+type FileLock struct {
+	f *os.File
+}
+
+// LockFile takes an exclusive flock on the file at path, creating it if
+// needed, and blocks until the lock is available.
+//
+// A lock file may be removed and recreated while a caller waits for it
+// (e.g. by delete and a new create), so once the lock is taken the path
+// must still refer to the locked file; otherwise the lock is retried on
+// the new file.
+func LockFile(path string) (*FileLock, error) {
+	return lockFile(path, unix.LOCK_EX)
+}
+
+// TryLockFile is LockFile without blocking: it returns ErrLocked if the
+// lock is held elsewhere.
+func TryLockFile(path string) (*FileLock, error) {
+	return lockFile(path, unix.LOCK_EX|unix.LOCK_NB)
+}
+
+func lockFile(path string, how int) (*FileLock, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|unix.O_CLOEXEC, 0600)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			err = unix.Flock(int(f.Fd()), how)
+			if !errors.Is(err, unix.EINTR) {
+				break
+			}
+		}
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			_ = f.Close()
+			return nil, ErrLocked
+		}
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+
+		locked, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(locked, current) {
+			return &FileLock{f: f}, nil
+		}
+		_ = f.Close()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// Unlock releases the lock. It may be called more than once.
+func (l *FileLock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := l.f.Close() // closing the file releases the flock
+	l.f = nil
+	return err
+}
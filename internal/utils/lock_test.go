@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockFile_SerializesReadModifyWrite(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "lock")
+	counterPath := filepath.Join(dir, "counter")
+	assert.Nil(t, WriteFileAtomic(counterPath, []byte("0"), 0o644))
+
+	// == act ==
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				lock, err := LockFile(lockPath)
+				if !assert.Nil(t, err) {
+					return
+				}
+				data, _ := os.ReadFile(counterPath)
+				n, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+				assert.Nil(t, WriteFileAtomic(counterPath, []byte(strconv.Itoa(n+1)), 0o644))
+				assert.Nil(t, lock.Unlock())
+			}
+		}()
+	}
+	wg.Wait()
+
+	// == assert ==
+	data, err := os.ReadFile(counterPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "400", string(data))
+}
+
+func TestLockFile_RelocksReplacedFile(t *testing.T) {
+	// == arrange ==
+	lockPath := filepath.Join(t.TempDir(), "lock")
+	held, err := LockFile(lockPath)
+	assert.Nil(t, err)
+	got := make(chan *FileLock)
+	go func() {
+		lock, _ := LockFile(lockPath)
+		got <- lock
+	}()
+
+	// == act ==
+	// the waiter is blocked on the old file, which is replaced before the
+	// lock is released
+	assert.Nil(t, os.Remove(lockPath))
+	assert.Nil(t, os.WriteFile(lockPath, nil, 0600))
+	assert.Nil(t, held.Unlock())
+	lock := <-got
+
+	// == assert ==
+	assert.NotNil(t, lock)
+	locked, err := lock.f.Stat()
+	assert.Nil(t, err)
+	current, err := os.Stat(lockPath)
+	assert.Nil(t, err)
+	assert.True(t, os.SameFile(locked, current))
+	assert.Nil(t, lock.Unlock())
+	assert.Nil(t, lock.Unlock())
+}
+
+func TestWriteFileAtomic_ReplacesWithPerm(t *testing.T) {
+	// == arrange ==
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	assert.Nil(t, os.WriteFile(path, []byte("old"), 0600))
+
+	// == act ==
+	err := WriteFileAtomic(path, []byte("new"), 0o644)
+
+	// == assert ==
+	assert.Nil(t, err)
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "new", string(data))
+	st, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0o644), st.Mode().Perm())
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1) // no temp file left behind
+}
+
+func TestTryLockFile_ReturnsErrLocked(t *testing.T) {
+	// == arrange ==
+	lockPath := filepath.Join(t.TempDir(), "lock")
+	held, err := LockFile(lockPath)
+	assert.Nil(t, err)
+
+	// == act ==
+	_, busyErr := TryLockFile(lockPath)
+	assert.Nil(t, held.Unlock())
+	lock, freeErr := TryLockFile(lockPath)
+
+	// == assert ==
+	assert.Equal(t, ErrLocked, busyErr)
+	assert.Nil(t, freeErr)
+	assert.Nil(t, lock.Unlock())
+}
@@ -1,12 +1,14 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 )
 
 const (
 	AuditLog      = "/etc/raind/log/droplet_audit.log"
+	HooksDir      = "/etc/raind/hooks.d"
 	cgroupRootDir = "/sys/fs/cgroup/raind"
 )
 
@@ -17,6 +19,18 @@ func DefaultRootDir() string {
 	return "/etc/raind/container"
 }
 
+// SetRootDir overrides the state root directory (--root).
+//
+// The value is exported through RAIND_ROOT_DIR so that subprocesses
+// re-executed from this binary (init, shim, exec-shim) resolve the same paths.
+func SetRootDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	return os.Setenv("RAIND_ROOT_DIR", abs)
+}
+
 // directory for each container
 //
 //	e.g. /etc/raind/container/<container-id>
@@ -24,22 +38,43 @@ func ContainerDir(containerId string) string {
 	return filepath.Join(DefaultRootDir(), containerId)
 }
 
-// config.json path
+// config.json path inside a bundle
 //
-//	e.g. /etc/raind/container/<container-id>/config.json
-func ConfigFilePath(containerId string) string {
-	return filepath.Join(ContainerDir(containerId), "config.json")
+//	e.g. /path/to/bundle/config.json
+func BundleConfigFilePath(bundle string) string {
+	return filepath.Join(bundle, "config.json")
 }
 
 func ConfigFileHashPath(containerId string) string {
 	return filepath.Join(ContainerDir(containerId), "config_hash.json")
 }
 
+// hooks merged from the hooks directory at create time
+//
+//	e.g. /etc/raind/container/<container-id>/hooks.json
+func MergedHooksPath(containerId string) string {
+	return filepath.Join(ContainerDir(containerId), "hooks.json")
+}
+
 // state path
 func ContainerStatePath(containerId string) string {
 	return filepath.Join(ContainerDir(containerId), "state.json")
 }
 
+// lock file serializing the lifecycle commands of a container
+//
+//	e.g. /etc/raind/container/<container-id>/lock
+func ContainerLockPath(containerId string) string {
+	return filepath.Join(ContainerDir(containerId), "lock")
+}
+
+// lock file serializing the read-modify-write of state.json
+//
+//	e.g. /etc/raind/container/<container-id>/state.lock
+func ContainerStateLockPath(containerId string) string {
+	return filepath.Join(ContainerDir(containerId), "state.lock")
+}
+
 // fifo path
 //
 //	e.g. /etc/raind/container/<container-id>/exec.fifo
@@ -60,12 +95,43 @@ func InitPidFilePath(containerId string) string {
 	return filepath.Join(ContainerDir(containerId), "init.pid")
 }
 
+// volatile rootfs directory (tmpfs backed upper/work for overlay-volatile)
+//
+//	e.g. /etc/raind/container/<container-id>/volatile
+func VolatileDir(containerId string) string {
+	return filepath.Join(ContainerDir(containerId), "volatile")
+}
+
+// cgroup directory holding the container cgroups
+func CgroupRootDir() string {
+	return cgroupRootDir
+}
+
 // cgroup path
 func CgroupPath(containerId string) string {
 	return filepath.Join(cgroupRootDir, containerId)
 }
 
 // logs
+func LogDir(containerId string) string {
+	return filepath.Join(ContainerDir(containerId), "logs")
+}
+
+// hook logs and the results of the last run of each hook
+//
+//	e.g. /etc/raind/container/<container-id>/logs/hooks/poststart-0.log
+func HookLogDir(containerId string) string {
+	return filepath.Join(LogDir(containerId), "hooks")
+}
+
+func HookLogPath(containerId string, phase string, index int) string {
+	return filepath.Join(HookLogDir(containerId), fmt.Sprintf("%s-%d.log", phase, index))
+}
+
+func HookResultsPath(containerId string) string {
+	return filepath.Join(HookLogDir(containerId), "results.json")
+}
+
 func ShimLogPath(containerId string) string {
 	return filepath.Join(ContainerDir(containerId), "logs", "shim.log")
 }
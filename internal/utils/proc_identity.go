@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bootIdPath identifies the current boot; process start times are only
+// unique within a boot.
+const bootIdPath = "/proc/sys/kernel/random/boot_id"
+
+// ProcIdentity identifies a process across PID reuse by its start time
+// (clock ticks after boot) and the boot it was started in. An identity
+// without a start time, e.g. from a state file written by an older
+// version, only carries the pid and cannot be verified.
+type ProcIdentity struct {
+	Pid       int
+	StartTime uint64
+	BootId    string
+}
+
+// NewProcIdentity reads the identity of the running process pid.
+func NewProcIdentity(pid int) (ProcIdentity, error) {
+	startTime, err := ReadProcStartTime(pid)
+	if err != nil {
+		return ProcIdentity{}, err
+	}
+	bootId, err := ReadBootId()
+	if err != nil {
+		return ProcIdentity{}, err
+	}
+	return ProcIdentity{Pid: pid, StartTime: startTime, BootId: bootId}, nil
+}
+
+// Verifiable reports whether the identity carries a start time.
+func (p ProcIdentity) Verifiable() bool {
+	return p.StartTime != 0
+}
+
+// Alive reports whether the process still runs. A verifiable identity
+// must match the boot and the start time of the process found at its pid;
+// otherwise kill(pid, 0) decides, where EPERM still means alive.
+func (p ProcIdentity) Alive() bool {
+	if p.Pid <= 0 {
+		return false
+	}
+	if !p.Verifiable() {
+		err := unix.Kill(p.Pid, 0)
+		return err == nil || errors.Is(err, unix.EPERM)
+	}
+	return p.matches()
+}
+
+// matches compares the identity with the process currently at its pid.
+func (p ProcIdentity) matches() bool {
+	if bootId, err := ReadBootId(); err != nil || bootId != p.BootId {
+		return false
+	}
+	startTime, err := ReadProcStartTime(p.Pid)
+	return err == nil && startTime == p.StartTime
+}
+
+// Signal delivers sig to the process. With pidfd support the pidfd is
+// opened first and the identity verified afterwards, so the signal cannot
+// reach a process that reused the pid in between. A process that is gone,
+// or whose pid was reused, is reported as ESRCH.
+func (p ProcIdentity) Signal(sig syscall.Signal) error {
+	if p.Pid <= 0 {
+		return unix.ESRCH
+	}
+	pidfd, err := unix.PidfdOpen(p.Pid, 0)
+	if err != nil {
+		if errors.Is(err, unix.ENOSYS) {
+			// no pidfd support: verify and signal, which leaves a small
+			// window for pid reuse
+			if p.Verifiable() && !p.matches() {
+				return unix.ESRCH
+			}
+			return unix.Kill(p.Pid, sig)
+		}
+		return err
+	}
+	defer unix.Close(pidfd)
+
+	if p.Verifiable() && !p.matches() {
+		return unix.ESRCH
+	}
+	return unix.PidfdSendSignal(pidfd, sig, nil, 0)
+}
+
+// ReadProcStartTime returns the start time of pid, in clock ticks after
+// boot, from /proc/<pid>/stat.
+func ReadProcStartTime(pid int) (uint64, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// stat format
+	//  no  value     field
+	// ---+---------+-----------
+	//  1   12345     pid
+	//  2   (bash)    command
+	//  3   S         state
+	//  4   652001    ppid
+	//  5   652095    pgrp
+	//  6   652095    session
+	//  7   34819     tty_nr
+	//  8   679797    tpgid
+	//  9   4194304   flags
+	//  10  220000    minflt
+	//  11  1319082   cminflt
+	//  12  0         majflt
+	//  13  342       cmajflt
+	//  14  175       utime
+	//  15  162       stime
+	//  16  2688      cutime
+	//  17  1141      cstime
+	//  18  20        priority
+	//  19  0         nice
+	//  20  1         num_threads
+	//  21  0         itrealvalue
+	//  22  48825543  **starttime**
+	//  23  6381568   vsize
+	//  24  1280      rss
+	//       :
+	s := string(b)
+	idx := strings.LastIndex(s, ")")
+	if idx < 0 {
+		return 0, fmt.Errorf("invalid stat format")
+	}
+	fields := strings.Fields(s[idx+1:])
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("invalid stat format")
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// ReadBootId returns the id of the current boot.
+func ReadBootId() (string, error) {
+	b, err := os.ReadFile(bootIdPath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestProcIdentity_AliveMatchesStartTime(t *testing.T) {
+	// == arrange ==
+	identity, err := NewProcIdentity(os.Getpid())
+	assert.Nil(t, err)
+	reused := identity
+	reused.StartTime++
+
+	// == act ==
+	alive, reusedAlive := identity.Alive(), reused.Alive()
+
+	// == assert ==
+	assert.True(t, identity.Verifiable())
+	assert.True(t, alive)
+	assert.False(t, reusedAlive)
+}
+
+func TestProcIdentity_AliveRejectsOtherBoot(t *testing.T) {
+	// == arrange ==
+	identity, err := NewProcIdentity(os.Getpid())
+	assert.Nil(t, err)
+	identity.BootId = "00000000-0000-0000-0000-000000000000"
+
+	// == act ==
+	alive := identity.Alive()
+
+	// == assert ==
+	assert.False(t, alive)
+}
+
+func TestProcIdentity_SignalReusedPid(t *testing.T) {
+	// == arrange ==
+	cmd := exec.Command("sleep", "10")
+	assert.Nil(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	identity, err := NewProcIdentity(cmd.Process.Pid)
+	assert.Nil(t, err)
+	identity.StartTime++
+
+	// == act ==
+	err = identity.Signal(syscall.SIGKILL)
+
+	// == assert ==
+	assert.Equal(t, unix.ESRCH, err)
+	// the process that now owns the pid was not signalled
+	assert.Nil(t, unix.Kill(cmd.Process.Pid, 0))
+}
+
+func TestProcIdentity_SignalAndExit(t *testing.T) {
+	// == arrange ==
+	cmd := exec.Command("sleep", "10")
+	assert.Nil(t, cmd.Start())
+	identity, err := NewProcIdentity(cmd.Process.Pid)
+	assert.Nil(t, err)
+
+	// == act ==
+	signalErr := identity.Signal(syscall.SIGKILL)
+	_ = cmd.Wait()
+
+	// == assert ==
+	assert.Nil(t, signalErr)
+	assert.False(t, identity.Alive())
+	assert.Equal(t, unix.ESRCH, identity.Signal(syscall.SIGKILL))
+}
+
+func TestProcIdentity_UnverifiableFallsBackToKill(t *testing.T) {
+	// == arrange ==
+	identity := ProcIdentity{Pid: os.Getpid()}
+
+	// == act ==
+	alive := identity.Alive()
+
+	// == assert ==
+	assert.False(t, identity.Verifiable())
+	assert.True(t, alive)
+	assert.False(t, ProcIdentity{}.Alive())
+}